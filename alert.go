@@ -0,0 +1,114 @@
+package tdigest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// AlertRule describes when the value at a quantile of a digest is worth
+// alerting on, e.g. "p99 above 500ms or up more than 20% from baseline".
+// A rule fires if any of its conditions holds.
+type AlertRule struct {
+	// Name identifies the rule in results.
+	Name string
+
+	// Quantile is the quantile the conditions apply to.
+	Quantile float64
+
+	// Above fires the rule when the value is greater than it.
+	Above *float64
+
+	// IncreaseAbove fires the rule when the value grew from the baseline
+	// by more than this fraction of it, e.g. 0.2 for 20%. It is only
+	// evaluated against a non-empty baseline with a non-zero value.
+	IncreaseAbove *float64
+}
+
+// AlertResult is the outcome of evaluating one rule.
+type AlertResult struct {
+	Rule     string  `json:"rule"`
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+
+	// Baseline is the value at the quantile in the baseline digest, if
+	// one was given.
+	Baseline *float64 `json:"baseline,omitempty"`
+
+	// Increase is (Value - Baseline) / |Baseline|. It is nil when there
+	// is no baseline, or when it's zero since the change is undefined then.
+	Increase *float64 `json:"increase,omitempty"`
+
+	Firing bool `json:"firing"`
+
+	// Reasons explains which conditions made the rule fire.
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// AlertEvaluator evaluates a set of rules against digest snapshots.
+type AlertEvaluator struct {
+	rules []AlertRule
+}
+
+// NewAlertEvaluator creates an AlertEvaluator for rules. Every rule needs a
+// unique name, a quantile between 0 and 1 and at least one condition.
+func NewAlertEvaluator(rules ...AlertRule) (*AlertEvaluator, error) {
+	if len(rules) == 0 {
+		return nil, errors.New("at least one rule is required")
+	}
+
+	seen := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if seen[r.Name] {
+			return nil, fmt.Errorf("duplicate rule %q", r.Name)
+		}
+		seen[r.Name] = true
+
+		if !(r.Quantile >= 0 && r.Quantile <= 1) {
+			return nil, fmt.Errorf("rule %q: quantile %v is not between 0 and 1", r.Name, r.Quantile)
+		}
+		if r.Above == nil && r.IncreaseAbove == nil {
+			return nil, fmt.Errorf("rule %q has no condition", r.Name)
+		}
+	}
+	return &AlertEvaluator{rules: append([]AlertRule(nil), rules...)}, nil
+}
+
+// Evaluate evaluates every rule against current, returning one result per
+// rule in order. baseline may be nil, in which case increases aren't
+// evaluated. current must hold samples.
+func (e *AlertEvaluator) Evaluate(current, baseline *TDigest) ([]AlertResult, error) {
+	if current.count == 0 {
+		return nil, errors.New("cannot evaluate alerts on an empty digest")
+	}
+	if baseline != nil && baseline.count == 0 {
+		baseline = nil
+	}
+
+	results := make([]AlertResult, len(e.rules))
+	for i, r := range e.rules {
+		res := AlertResult{Rule: r.Name, Quantile: r.Quantile, Value: current.Quantile(r.Quantile)}
+		label := percentileLabel(r.Quantile)
+
+		if r.Above != nil && res.Value > *r.Above {
+			res.Reasons = append(res.Reasons, fmt.Sprintf("%s = %g > %g", label, res.Value, *r.Above))
+		}
+
+		if baseline != nil {
+			b := baseline.Quantile(r.Quantile)
+			res.Baseline = &b
+			if b != 0 {
+				increase := (res.Value - b) / math.Abs(b)
+				res.Increase = &increase
+				if r.IncreaseAbove != nil && increase > *r.IncreaseAbove {
+					res.Reasons = append(res.Reasons, fmt.Sprintf("%s up %.1f%% from %g (> %g%%)",
+						label, 100*increase, b, 100**r.IncreaseAbove))
+				}
+			}
+		}
+
+		res.Firing = len(res.Reasons) > 0
+		results[i] = res
+	}
+	return results, nil
+}
@@ -0,0 +1,78 @@
+package tdigest
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func float64p(x float64) *float64 { return &x }
+
+func TestAlertEvaluator(t *testing.T) {
+	e, err := NewAlertEvaluator(
+		AlertRule{Name: "slow", Quantile: 0.99, Above: float64p(500), IncreaseAbove: float64p(0.2)},
+		AlertRule{Name: "median", Quantile: 0.5, Above: float64p(1000)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseline, current := New(100), New(100)
+	for i := 0; i < 1000; i++ {
+		baseline.Add(float64(i)*0.4, 1)
+		current.Add(float64(i)*0.55, 1)
+	}
+
+	results, err := e.Evaluate(current, baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Rule != "slow" || results[1].Rule != "median" {
+		t.Fatalf("Expected one result per rule, in order. Got %+v", results)
+	}
+
+	slow := results[0]
+	if !slow.Firing || len(slow.Reasons) != 2 {
+		t.Errorf("Expected both conditions of the slow rule to fire. Got %+v", slow)
+	}
+	if slow.Increase == nil || math.Abs(*slow.Increase-0.375) > 0.01 {
+		t.Errorf("Expected an increase of about 37.5%%. Got %+v", slow)
+	}
+	if !strings.HasPrefix(slow.Reasons[0], "p99 = ") || !strings.HasPrefix(slow.Reasons[1], "p99 up 37.") {
+		t.Errorf("Unexpected reasons %q", slow.Reasons)
+	}
+	if results[1].Firing || results[1].Reasons != nil {
+		t.Errorf("Expected the median rule not to fire. Got %+v", results[1])
+	}
+
+	if _, err := json.Marshal(results); err != nil {
+		t.Errorf("Results should be serializable. Got %v", err)
+	}
+
+	// Without a baseline, only thresholds are evaluated.
+	results, err = e.Evaluate(current, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := results[0]; !r.Firing || len(r.Reasons) != 1 || r.Baseline != nil || r.Increase != nil {
+		t.Errorf("Expected only the threshold to be evaluated. Got %+v", r)
+	}
+
+	if _, err := e.Evaluate(New(100), baseline); err == nil {
+		t.Errorf("Expected an error evaluating an empty digest")
+	}
+}
+
+func TestNewAlertEvaluator(t *testing.T) {
+	for _, rules := range [][]AlertRule{
+		nil,
+		{{Name: "a", Quantile: 0.5}},
+		{{Name: "a", Quantile: 1.5, Above: float64p(1)}},
+		{{Name: "a", Quantile: 0.5, Above: float64p(1)}, {Name: "a", Quantile: 0.9, Above: float64p(1)}},
+	} {
+		if _, err := NewAlertEvaluator(rules...); err == nil {
+			t.Errorf("Expected rules %+v to be rejected", rules)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package tdigest
+
+import (
+	"errors"
+	"sync"
+)
+
+// SliceAllocator provides the arrays backing the centroids of a digest,
+// so that processes holding huge numbers of digests can manage that memory
+// in large slabs instead of many small heap allocations.
+type SliceAllocator interface {
+	// Alloc returns empty slices with room for at least capacity elements.
+	Alloc(capacity int) (keys []float64, counts []uint64)
+
+	// Free hands back slices obtained from Alloc once the digest is done
+	// with them. They must not be used by the allocator's callers anymore.
+	Free(keys []float64, counts []uint64)
+}
+
+// WithAllocator makes the digest obtain its centroid arrays from alloc.
+func WithAllocator(alloc SliceAllocator) Option {
+	return func(t *TDigest) error {
+		if alloc == nil {
+			return errors.New("SliceAllocator must not be nil")
+		}
+		t.summary.release()
+		t.summary = newAllocatedSummary(estimateCapacity(t.compression), alloc)
+		return nil
+	}
+}
+
+// SlabAllocator is a SliceAllocator that carves slices out of large,
+// shared slabs and recycles freed slices of the same size. Slices are
+// handed out in power of two sizes; requests bigger than a slab are
+// allocated on their own. It is safe for concurrent use.
+type SlabAllocator struct {
+	mu         sync.Mutex
+	slabSize   int
+	keySlab    []float64
+	countSlab  []uint64
+	freeKeys   map[int][][]float64
+	freeCounts map[int][][]uint64
+}
+
+// NewSlabAllocator creates a SlabAllocator whose slabs hold slabSize
+// elements each.
+func NewSlabAllocator(slabSize int) *SlabAllocator {
+	return &SlabAllocator{
+		slabSize:   slabSize,
+		freeKeys:   make(map[int][][]float64),
+		freeCounts: make(map[int][][]uint64),
+	}
+}
+
+// Alloc implements SliceAllocator.
+func (a *SlabAllocator) Alloc(capacity int) ([]float64, []uint64) {
+	size := 8
+	for size < capacity {
+		size *= 2
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if n := len(a.freeKeys[size]); n > 0 {
+		keys, counts := a.freeKeys[size][n-1], a.freeCounts[size][n-1]
+		a.freeKeys[size] = a.freeKeys[size][:n-1]
+		a.freeCounts[size] = a.freeCounts[size][:n-1]
+		return keys, counts
+	}
+
+	if size > a.slabSize {
+		return make([]float64, 0, size), make([]uint64, 0, size)
+	}
+
+	if cap(a.keySlab)-len(a.keySlab) < size {
+		a.keySlab = make([]float64, 0, a.slabSize)
+		a.countSlab = make([]uint64, 0, a.slabSize)
+	}
+
+	// Limit the capacity of the returned slices, so appending to them
+	// never spills into the rest of the slab.
+	n := len(a.keySlab)
+	a.keySlab = a.keySlab[:n+size]
+	a.countSlab = a.countSlab[:n+size]
+
+	return a.keySlab[n : n : n+size], a.countSlab[n : n : n+size]
+}
+
+// Free implements SliceAllocator.
+func (a *SlabAllocator) Free(keys []float64, counts []uint64) {
+	size := cap(keys)
+	if size == 0 || size != cap(counts) || size&(size-1) != 0 {
+		// Not something we handed out
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.freeKeys[size] = append(a.freeKeys[size], keys[:0])
+	a.freeCounts[size] = append(a.freeCounts[size], counts[:0])
+}
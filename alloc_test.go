@@ -0,0 +1,85 @@
+package tdigest
+
+import (
+	"math/rand"
+	"testing"
+)
+
+type countingAllocator struct {
+	*SlabAllocator
+	allocs, frees int
+}
+
+func (a *countingAllocator) Alloc(capacity int) ([]float64, []uint64) {
+	a.allocs++
+	return a.SlabAllocator.Alloc(capacity)
+}
+
+func (a *countingAllocator) Free(keys []float64, counts []uint64) {
+	a.frees++
+	a.SlabAllocator.Free(keys, counts)
+}
+
+func TestAllocator(t *testing.T) {
+	alloc := &countingAllocator{SlabAllocator: NewSlabAllocator(1 << 16)}
+
+	tdigest := New(10, WithAllocator(alloc))
+	for i := 0; i < 100000; i++ {
+		tdigest.Add(rand.Float64(), 1)
+	}
+	tdigest.Compress()
+
+	if alloc.allocs < 2 || alloc.frees != alloc.allocs-1 {
+		t.Errorf("Expected every allocation but the live one to be freed. Got %d allocs, %d frees", alloc.allocs, alloc.frees)
+	}
+	checkSorted(tdigest.summary, t)
+	assertDifferenceSmallerThan(tdigest, 0.5, 0.05, t)
+	assertDifferenceSmallerThan(tdigest, 0.99, 0.01, t)
+
+	// Digests built by other constructors grow through the allocator too.
+	data := make([]float64, 1000)
+	for i := range data {
+		data[i] = rand.Float64()
+	}
+	fromSamples, err := FromSamples(data, WithAllocator(alloc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromSamples.summary.alloc != alloc {
+		t.Errorf("Expected FromSamples to keep the allocator")
+	}
+	assertDifferenceSmallerThan(fromSamples, 0.5, 0.05, t)
+
+	shouldPanic(func() {
+		New(10, WithAllocator(nil))
+	}, t, "A nil allocator should panic!")
+}
+
+func TestSlabAllocator(t *testing.T) {
+	a := NewSlabAllocator(64)
+
+	k1, c1 := a.Alloc(10)
+	k2, _ := a.Alloc(10)
+	if cap(k1) != 16 || cap(c1) != 16 || len(k1) != 0 {
+		t.Fatalf("Expected empty slices rounded up to 16 elements. Got len=%d cap=%d", len(k1), cap(k1))
+	}
+
+	// Appending past the capacity must not clobber neighbouring slices.
+	k2 = append(k2, 42)
+	for i := 0; i < 20; i++ {
+		k1 = append(k1, float64(i))
+	}
+	if k2[0] != 42 {
+		t.Errorf("Slices carved from a slab overlap")
+	}
+
+	a.Free(k2, make([]uint64, 0, 16))
+	k3, _ := a.Alloc(16)
+	if &k3[:1][0] != &k2[:1][0] {
+		t.Errorf("Expected freed slices to be recycled")
+	}
+
+	if k, _ := a.Alloc(1000); cap(k) != 1024 {
+		t.Errorf("Expected big requests to be allocated separately. Got cap=%d", cap(k))
+	}
+}
@@ -0,0 +1,131 @@
+package tdigest
+
+import "sort"
+
+// WithBackgroundCompression moves the compressions triggered by Add off
+// the ingestion path: when the summary grows too big, it is handed to a
+// goroutine to be compressed while new samples go to a fresh staging
+// digest, and both are folded back together once the compression is over.
+// Reads (Quantile, iteration, serialization, merges, ...) wait for a
+// running compression to finish, so results are the same as without the
+// option, give or take the usual randomness of compressions.
+//
+// The digest itself is still not safe for concurrent use, but its
+// CompactionPolicy, ScaleFunction and SliceAllocator are used from the
+// compressing goroutine too, and must be safe for concurrent use.
+func WithBackgroundCompression() Option {
+	return func(t *TDigest) error {
+		t.background = true
+		return nil
+	}
+}
+
+type pendingCompression struct {
+	done       chan struct{}
+	compressed *TDigest
+	staging    *TDigest
+}
+
+// compressInBackground starts compressing the summary in a new goroutine.
+func (t *TDigest) compressInBackground() {
+	old := t.summary
+	p := &pendingCompression{
+		done: make(chan struct{}),
+		compressed: &TDigest{
+			summary:     newAllocatedSummary(estimateCapacity(t.compression), old.alloc),
+			compression: t.compression,
+			compaction:  t.compaction,
+			scale:       t.scale,
+		},
+		staging: &TDigest{
+			summary:     newAllocatedSummary(estimateCapacity(t.compression), old.alloc),
+			compression: t.compression,
+			compaction:  t.compaction,
+			scale:       t.scale,
+		},
+	}
+	t.pending = p
+
+	go func() {
+		old.shuffle()
+		for i := range old.keys {
+			p.compressed.add(old.keys[i], old.counts[i])
+		}
+		old.release()
+		close(p.done)
+	}()
+}
+
+// addPending adds a sample to the staging digest if a compression is
+// still running, reporting whether it did. Otherwise the compression
+// result is folded in and the sample must be added as usual.
+func (t *TDigest) addPending(value float64, count uint64) bool {
+	select {
+	case <-t.pending.done:
+		t.settle()
+		return false
+	default:
+		t.pending.staging.add(value, count)
+		t.count += count
+		return true
+	}
+}
+
+// settle waits for a running compression, if any, and folds its result
+// and the samples staged in the meantime into the digest, along with the
+// samples buffered by WithBufferedAdd.
+func (t *TDigest) settle() {
+	// Folding the staged samples may trigger another compression.
+	for t.pending != nil {
+		p := t.pending
+		<-p.done
+		t.pending = nil
+
+		t.summary = p.compressed.summary
+		t.count = p.compressed.count
+
+		staged := p.staging.summary
+		staged.shuffle()
+		for i := range staged.keys {
+			t.add(staged.keys[i], staged.counts[i])
+		}
+		staged.release()
+	}
+	t.flush()
+}
+
+// settled returns t if no compression is running and no samples are
+// buffered. Otherwise it returns a settled copy, leaving t untouched, for
+// the methods which can't modify t.
+func (t *TDigest) settled() *TDigest {
+	p := t.pending
+	if p == nil && !t.buffered() {
+		return t
+	}
+
+	c := *t
+	c.pending = nil
+	c.background = false
+	c.recent = nil
+	c.buffer = nil
+	c.cache = nil
+	if p == nil {
+		c.summary = &summary{keys: append([]float64{}, t.summary.keys...), counts: append([]uint64{}, t.summary.counts...)}
+	} else {
+		<-p.done
+		a := p.compressed.summary
+		c.summary = &summary{keys: append([]float64{}, a.keys...), counts: append([]uint64{}, a.counts...)}
+		c.count = p.compressed.count
+		s := p.staging.summary
+		for i := range s.keys {
+			c.add(s.keys[i], s.counts[i])
+		}
+	}
+
+	if t.buffered() {
+		b := &summary{keys: append([]float64{}, t.buffer.keys...), counts: append([]uint64{}, t.buffer.counts...)}
+		sort.Sort(b)
+		c.fold(b)
+	}
+	return &c
+}
@@ -0,0 +1,67 @@
+package tdigest
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestBackgroundCompression(t *testing.T) {
+	tdigest := New(10, WithBackgroundCompression())
+	for i := 0; i < 100000; i++ {
+		tdigest.Add(rand.Float64(), 1)
+	}
+
+	if tdigest.count != 100000 {
+		t.Errorf("Expected 100000 samples, got %d", tdigest.count)
+	}
+
+	var total uint64
+	tdigest.ForEachCentroid(func(mean float64, count uint64) bool {
+		total += count
+		return true
+	})
+	if total != 100000 {
+		t.Errorf("Expected the centroids to hold 100000 samples, got %d", total)
+	}
+	if tdigest.pending != nil {
+		t.Errorf("Reads should wait for the background compression")
+	}
+
+	assertDifferenceSmallerThan(tdigest, 0.5, 0.05, t)
+	assertDifferenceSmallerThan(tdigest, 0.1, 0.02, t)
+	assertDifferenceSmallerThan(tdigest, 0.9, 0.02, t)
+}
+
+func TestBackgroundCompressionSerialization(t *testing.T) {
+	tdigest := New(10, WithBackgroundCompression())
+	for tdigest.pending == nil {
+		tdigest.Add(rand.Float64(), 1)
+	}
+
+	// AsBytes can't settle its copy of the digest, so it must serialize a
+	// settled copy and leave the original alone.
+	buf, err := tdigest.AsBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tdigest.pending == nil {
+		t.Errorf("AsBytes should not modify the digest")
+	}
+
+	decoded, err := FromBytes(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.count != tdigest.count {
+		t.Errorf("Expected %d samples after decoding, got %d", tdigest.count, decoded.count)
+	}
+
+	other := &TDigest{}
+	if err := other.FromBytes(tdigest.ToBytes(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if other.count != decoded.count {
+		t.Errorf("Expected ToBytes and AsBytes to agree. Got %d and %d samples", other.count, decoded.count)
+	}
+}
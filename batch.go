@@ -0,0 +1,316 @@
+package tdigest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultCompression is the compression used by constructors that don't
+// take one explicitly, unless overridden with the Compression option.
+const DefaultCompression = 100
+
+// FromSamples builds a digest out of a complete, in-memory dataset. The
+// samples are sorted once and folded into centroids in a single pass,
+// which is both faster and more accurate than calling Add for each of
+// them. The input slice is not modified.
+func FromSamples(values []float64, options ...Option) (*TDigest, error) {
+	t, err := newWithOptions(DefaultCompression, options)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	for _, x := range sorted {
+		if math.IsNaN(x) {
+			return nil, errors.New("samples must not be NaN")
+		}
+	}
+
+	t.compactSorted(sorted, nil)
+	for i, x := range sorted {
+		t.moments.add(x, 1, uint64(i+1))
+		if t.distinct != nil {
+			t.distinct.Insert(x)
+		}
+	}
+
+	return t, nil
+}
+
+// FromCentroids rebuilds a digest from centroid means and counts stored
+// elsewhere (a database column, a protobuf message...). Both slices must
+// have the same length, means must not be NaN and counts must be positive.
+// Centroids don't need to be sorted; those sharing a mean are combined.
+func FromCentroids(means []float64, counts []uint64, options ...Option) (*TDigest, error) {
+	if len(means) != len(counts) {
+		return nil, fmt.Errorf("got %d means but %d counts", len(means), len(counts))
+	}
+
+	t, err := newWithOptions(DefaultCompression, options)
+	if err != nil {
+		return nil, err
+	}
+
+	s := t.summary
+	s.reserve(len(means))
+	for i, mean := range means {
+		if math.IsNaN(mean) {
+			return nil, fmt.Errorf("centroid %d has a NaN mean", i)
+		}
+		if counts[i] == 0 {
+			return nil, fmt.Errorf("centroid %d has a zero count", i)
+		}
+		s.keys = append(s.keys, mean)
+		s.counts = append(s.counts, counts[i])
+		t.count += counts[i]
+	}
+
+	if !sort.IsSorted(s) {
+		sort.Sort(s)
+	}
+	t.moments.inexact = true
+
+	// Combine centroids sharing a mean, keeping the keys unique.
+	last := 0
+	for i := 1; i < s.Len(); i++ {
+		if s.keys[i] == s.keys[last] {
+			s.counts[last] += s.counts[i]
+			continue
+		}
+		last++
+		s.keys[last] = s.keys[i]
+		s.counts[last] = s.counts[i]
+	}
+	if s.Len() > 0 {
+		s.keys = s.keys[:last+1]
+		s.counts = s.counts[:last+1]
+	}
+
+	return t, nil
+}
+
+// FromQuantiles builds a digest approximating a distribution that is only
+// known through a few of its quantiles (say p50, p90 and p99) and its total
+// count, so that summaries exported by legacy systems can still be merged
+// with proper digests. Values are assumed to be uniformly spread between
+// consecutive quantiles; the weight below the first quantile and above the
+// last one is placed on their respective values. Quantiles must be strictly
+// increasing within [0, 1] and values must be non-decreasing.
+func FromQuantiles(quantiles, values []float64, count uint64, options ...Option) (*TDigest, error) {
+	// Number of centroids each range between two quantiles is split into,
+	// so quantiles in between interpolate smoothly.
+	const piecesPerRange = 8
+
+	if len(quantiles) != len(values) {
+		return nil, fmt.Errorf("got %d quantiles but %d values", len(quantiles), len(values))
+	}
+	if len(quantiles) == 0 || count == 0 {
+		return nil, errors.New("at least one quantile and a positive count are required")
+	}
+	for i, q := range quantiles {
+		if math.IsNaN(values[i]) || !(q >= 0 && q <= 1) {
+			return nil, fmt.Errorf("invalid quantile %d: p(%v) = %v", i, q, values[i])
+		}
+		if i > 0 && (q <= quantiles[i-1] || values[i] < values[i-1]) {
+			return nil, fmt.Errorf("quantile %d (p(%v) = %v) is out of order", i, q, values[i])
+		}
+	}
+
+	var means []float64
+	var counts []uint64
+	rank := func(q float64) uint64 { return uint64(math.Floor(q*float64(count) + 0.5)) }
+	add := func(mean float64, from, to float64) {
+		if w := rank(to) - rank(from); w > 0 {
+			means = append(means, mean)
+			counts = append(counts, w)
+		}
+	}
+
+	last := len(quantiles) - 1
+	add(values[0], 0, quantiles[0])
+	for i := 0; i < last; i++ {
+		qLo, qHi := quantiles[i], quantiles[i+1]
+		vLo, vHi := values[i], values[i+1]
+		for j := 0; j < piecesPerRange; j++ {
+			from := qLo + (qHi-qLo)*float64(j)/piecesPerRange
+			to := qLo + (qHi-qLo)*float64(j+1)/piecesPerRange
+			add(vLo+(vHi-vLo)*(float64(j)+0.5)/piecesPerRange, from, to)
+		}
+	}
+	add(values[last], quantiles[last], 1)
+
+	return FromCentroids(means, counts, options...)
+}
+
+// QuantileSummary describes a distribution through a few of its quantiles
+// and its total count, as exported by systems that don't produce digests.
+type QuantileSummary struct {
+	Quantiles []float64
+	Values    []float64
+	Count     uint64
+}
+
+// MergeQuantileSummaries combines summaries from several sources (say, the
+// p50/p90/p99 reported by each host of a fleet) into a single digest.
+// Averaging per-host percentiles is wrong whenever hosts see different
+// traffic or distributions. Instead, every summary is turned into an
+// approximating digest with FromQuantiles, and all of them are merged, so
+// each source weighs in proportion to its count.
+func MergeQuantileSummaries(summaries []QuantileSummary, options ...Option) (*TDigest, error) {
+	var means []float64
+	var counts []uint64
+
+	for i, summary := range summaries {
+		d, err := FromQuantiles(summary.Quantiles, summary.Values, summary.Count)
+		if err != nil {
+			return nil, fmt.Errorf("summary %d: %v", i, err)
+		}
+		means = append(means, d.summary.keys...)
+		counts = append(counts, d.summary.counts...)
+	}
+
+	t, err := FromCentroids(means, counts, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// FromCentroids sorted and deduplicated the centroids, fold them into
+	// as few as the compression allows.
+	means = append(means[:0], t.summary.keys...)
+	counts = append(counts[:0], t.summary.counts...)
+	t.compactSorted(means, counts)
+
+	return t, nil
+}
+
+// AddBatch adds every given value to the digest with a count of 1. The
+// values are sorted and merged with the centroids in a single pass, like
+// FromSamples does, which is much faster than calling Add for each of them
+// and compresses the digest as a side effect. The input slice is not
+// modified. If any value is NaN, it returns an error without adding
+// anything.
+func (t *TDigest) AddBatch(values []float64) error {
+	return t.AddBatchContext(context.Background(), values)
+}
+
+// AddBatchWeighted is like AddBatch, adding every value with the count at
+// the same index. Both slices must have the same length, and counts must
+// be positive and not overflow the total of the digest.
+func (t *TDigest) AddBatchWeighted(values []float64, counts []uint64) error {
+	if len(values) != len(counts) {
+		return fmt.Errorf("got %d values but %d counts", len(values), len(counts))
+	}
+	return t.addBatch(context.Background(), values, counts)
+}
+
+// AddBatchContext is like AddBatch, but stops early with the context error
+// if ctx is done before all values are added. The values added until then
+// remain part of t.
+func (t *TDigest) AddBatchContext(ctx context.Context, values []float64) error {
+	return t.addBatch(ctx, values, nil)
+}
+
+// addBatch adds values with the given counts, or a count of 1 if counts is
+// nil, a chunk at a time.
+func (t *TDigest) addBatch(ctx context.Context, values []float64, counts []uint64) error {
+	// Chunks bound the memory used for sorting, and how long cancellations
+	// take to be noticed.
+	const chunkSize = 4096
+
+	total := t.count
+	for i, x := range values {
+		w := uint64(1)
+		if counts != nil {
+			w = counts[i]
+		}
+		if w == 0 || math.IsNaN(x) {
+			return fmt.Errorf("Illegal datapoint <value: %.4f, count: %d>", x, w)
+		}
+		if total+w < total {
+			return fmt.Errorf("count %d overflows the %d samples of the digest", w, total)
+		}
+		total += w
+	}
+
+	t.settle()
+	n := t.count
+	chunk := newSummary(uint(min(len(values), chunkSize)))
+	for start := 0; start < len(values); start += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		end := min(start+chunkSize, len(values))
+		chunk.keys = append(chunk.keys[:0], values[start:end]...)
+		chunk.counts = chunk.counts[:0]
+		for i := start; i < end; i++ {
+			w := uint64(1)
+			if counts != nil {
+				w = counts[i]
+			}
+			chunk.counts = append(chunk.counts, w)
+			n += w
+			t.moments.add(values[i], w, n)
+			if t.distinct != nil {
+				t.distinct.Insert(values[i])
+			}
+		}
+		sort.Sort(chunk)
+		t.fold(chunk)
+	}
+	return nil
+}
+
+// compactSorted replaces the digest contents with the result of greedily
+// folding the given stream of points, sorted by mean, into centroids as
+// large as the compaction policy permits. A nil counts slice means every
+// point has a weight of 1.
+func (t *TDigest) compactSorted(means []float64, counts []uint64) {
+	weight := func(i int) uint64 {
+		if counts == nil {
+			return 1
+		}
+		return counts[i]
+	}
+
+	t.modified()
+	t.count = 0
+	for i := range means {
+		t.count += weight(i)
+	}
+
+	s := t.summary
+	s.keys = s.keys[:0]
+	s.counts = s.counts[:0]
+
+	var total uint64
+	for i, x := range means {
+		w := weight(i)
+		last := s.Len() - 1
+
+		if last >= 0 {
+			c := s.counts[last]
+			q := (float64(c)/2.0 + float64(total-c)) / float64(t.count)
+
+			// Identical means are always folded together, just like Add does.
+			if s.keys[last] == x || t.allowWeight(q, float64(c+w)) {
+				c += w
+				s.keys[last] = shiftMean(s.keys[last], x, w, c)
+				s.counts[last] = c
+				total += w
+				continue
+			}
+		}
+
+		s.reserve(1)
+		s.keys = append(s.keys, x)
+		s.counts = append(s.counts, w)
+		total += w
+	}
+}
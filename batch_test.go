@@ -0,0 +1,290 @@
+package tdigest
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFromSamples(t *testing.T) {
+	data := make([]float64, 100000)
+	for i := range data {
+		data[i] = rand.Float64()
+	}
+	first := data[0]
+
+	tdigest, err := FromSamples(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data[0] != first {
+		t.Errorf("FromSamples should not modify its input")
+	}
+	if tdigest.count != uint64(len(data)) {
+		t.Errorf("Expected count %d, got %d", len(data), tdigest.count)
+	}
+	if tdigest.compression != DefaultCompression {
+		t.Errorf("Expected the default compression, got %.1f", tdigest.compression)
+	}
+	checkSorted(tdigest.summary, t)
+
+	sort.Float64s(data)
+	assertDifferenceFromQuantile(data, tdigest, 0.001, 0.0005, t)
+	assertDifferenceFromQuantile(data, tdigest, 0.01, 0.001, t)
+	assertDifferenceFromQuantile(data, tdigest, 0.1, 0.005, t)
+	assertDifferenceFromQuantile(data, tdigest, 0.5, 0.01, t)
+	assertDifferenceFromQuantile(data, tdigest, 0.9, 0.005, t)
+	assertDifferenceFromQuantile(data, tdigest, 0.99, 0.001, t)
+	assertDifferenceFromQuantile(data, tdigest, 0.999, 0.0005, t)
+}
+
+func TestFromSamplesOptions(t *testing.T) {
+	tdigest, err := FromSamples([]float64{3, 1, 2, 2, 2}, Compression(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tdigest.compression != 10 {
+		t.Errorf("Expected compression 10, got %.1f", tdigest.compression)
+	}
+	if c := tdigest.summary.Find(2); c.count != 3 {
+		t.Errorf("Identical samples should share a centroid. Got %v", c)
+	}
+
+	tdigest, err = FromSamples(nil)
+	if err != nil || tdigest.Len() != 0 || !math.IsNaN(tdigest.Quantile(0.5)) {
+		t.Errorf("Expected an empty digest from no samples")
+	}
+
+	if _, err := FromSamples([]float64{1, math.NaN()}); err == nil {
+		t.Errorf("Expected an error for NaN samples")
+	}
+	if _, err := FromSamples([]float64{1}, Compression(0.5)); err == nil {
+		t.Errorf("Expected an error for an invalid compression")
+	}
+}
+
+func BenchmarkFromSamples(b *testing.B) {
+	data := make([]float64, 10000)
+	for i := range data {
+		data[i] = rand.Float64()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		FromSamples(data)
+	}
+}
+
+func TestFromCentroids(t *testing.T) {
+	original := New(100)
+	for i := 0; i < 1000; i++ {
+		original.Add(rand.Float64(), uint64(rand.Intn(10)+1))
+	}
+
+	var means []float64
+	var counts []uint64
+	original.IterateDescending(func(mean float64, count uint64) bool {
+		means = append(means, mean)
+		counts = append(counts, count)
+		return true
+	})
+
+	tdigest, err := FromCentroids(means, counts, Compression(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tdigest.summary, original.summary) || tdigest.count != original.count {
+		t.Errorf("FromCentroids should rebuild the exact same centroids")
+	}
+
+	tdigest, err = FromCentroids([]float64{2, 1, 2}, []uint64{1, 1, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tdigest.Len() != 2 || tdigest.summary.Find(2).count != 4 || tdigest.count != 5 {
+		t.Errorf("Expected centroids sharing a mean to be combined. Got %v", tdigest.summary)
+	}
+
+	for _, tc := range []struct {
+		means  []float64
+		counts []uint64
+	}{
+		{[]float64{1, 2}, []uint64{1}},
+		{[]float64{1, math.NaN()}, []uint64{1, 1}},
+		{[]float64{1, 2}, []uint64{1, 0}},
+	} {
+		if _, err := FromCentroids(tc.means, tc.counts); err == nil {
+			t.Errorf("Expected FromCentroids(%v, %v) to fail", tc.means, tc.counts)
+		}
+	}
+}
+
+func TestFromQuantiles(t *testing.T) {
+	data := make([]float64, 10000)
+	for i := range data {
+		data[i] = rand.ExpFloat64()
+	}
+	sort.Float64s(data)
+
+	qs := []float64{0.5, 0.9, 0.99}
+	values := []float64{quantile(0.5, data), quantile(0.9, data), quantile(0.99, data)}
+
+	tdigest, err := FromQuantiles(qs, values, uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tdigest.count != uint64(len(data)) {
+		t.Errorf("Expected count %d, got %d", len(data), tdigest.count)
+	}
+
+	for i, q := range qs {
+		if got := tdigest.Quantile(q); math.Abs(got-values[i])/values[i] > 0.05 {
+			t.Errorf("Quantile(%.2f) = %.4f, wanted about %.4f", q, got, values[i])
+		}
+	}
+	// Between known quantiles values are interpolated linearly.
+	if got, want := tdigest.Quantile(0.7), (values[0]+values[1])/2; math.Abs(got-want)/want > 0.02 {
+		t.Errorf("Expected interpolated Quantile(0.7) to be close to %.4f. Got %.4f", want, got)
+	}
+
+	for _, tc := range []struct {
+		qs, values []float64
+		count      uint64
+	}{
+		{[]float64{0.5}, []float64{1, 2}, 10},
+		{[]float64{}, []float64{}, 10},
+		{[]float64{0.5}, []float64{1}, 0},
+		{[]float64{0.9, 0.5}, []float64{1, 2}, 10},
+		{[]float64{0.5, 0.9}, []float64{2, 1}, 10},
+		{[]float64{0.5, 1.5}, []float64{1, 2}, 10},
+		{[]float64{0.5}, []float64{math.NaN()}, 10},
+	} {
+		if _, err := FromQuantiles(tc.qs, tc.values, tc.count); err == nil {
+			t.Errorf("Expected FromQuantiles(%v, %v, %d) to fail", tc.qs, tc.values, tc.count)
+		}
+	}
+}
+
+func TestMergeQuantileSummaries(t *testing.T) {
+	var data []float64
+	var summaries []QuantileSummary
+
+	// A busy host with fast responses and a quiet, slow one.
+	for _, host := range []struct {
+		offset float64
+		count  int
+	}{{0, 9000}, {10, 1000}} {
+		samples := make([]float64, host.count)
+		for i := range samples {
+			samples[i] = host.offset + rand.Float64()
+		}
+		sort.Float64s(samples)
+		data = append(data, samples...)
+
+		summary := QuantileSummary{Count: uint64(host.count)}
+		for _, q := range []float64{0, 0.5, 0.9, 0.99, 1} {
+			summary.Quantiles = append(summary.Quantiles, q)
+			summary.Values = append(summary.Values, quantile(q, samples))
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Float64s(data)
+
+	tdigest, err := MergeQuantileSummaries(summaries, Compression(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tdigest.count != uint64(len(data)) || tdigest.compression != 50 {
+		t.Errorf("Unexpected count (%d) or compression (%.1f)", tdigest.count, tdigest.compression)
+	}
+
+	assertDifferenceFromQuantile(data, tdigest, 0.5, 0.05, t)
+	assertDifferenceFromQuantile(data, tdigest, 0.85, 0.05, t)
+	assertDifferenceFromQuantile(data, tdigest, 0.95, 0.1, t)
+	assertDifferenceFromQuantile(data, tdigest, 0.99, 0.1, t)
+
+	summaries[1].Count = 0
+	if _, err := MergeQuantileSummaries(summaries); err == nil {
+		t.Errorf("Expected an invalid summary to fail the merge")
+	}
+}
+
+func TestAddBatch(t *testing.T) {
+	data := make([]float64, 10000)
+	for i := range data {
+		data[i] = rand.Float64()
+	}
+
+	tdigest := New(100)
+	if err := tdigest.AddBatch(data); err != nil {
+		t.Fatal(err)
+	}
+	if tdigest.count != uint64(len(data)) {
+		t.Errorf("Expected count %d, got %d", len(data), tdigest.count)
+	}
+	assertDifferenceSmallerThan(tdigest, 0.5, 0.02, t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tdigest = New(100)
+	if err := tdigest.AddBatchContext(ctx, data); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if tdigest.count != 0 {
+		t.Errorf("Nothing should be added with a cancelled context")
+	}
+}
+
+func TestAddBatchWeighted(t *testing.T) {
+	tdigest := New(100)
+	tdigest.Add(5, 1)
+	if err := tdigest.AddBatchWeighted([]float64{3, 1, 2, 1}, []uint64{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	if tdigest.count != 11 {
+		t.Errorf("Expected count 11, got %d", tdigest.count)
+	}
+
+	var means []float64
+	var counts []uint64
+	tdigest.ForEachCentroid(func(mean float64, count uint64) bool {
+		means = append(means, mean)
+		counts = append(counts, count)
+		return true
+	})
+	if !reflect.DeepEqual(means, []float64{1, 2, 3, 5}) || !reflect.DeepEqual(counts, []uint64{6, 3, 1, 1}) {
+		t.Errorf("Unexpected centroids: means %v, counts %v", means, counts)
+	}
+
+	for _, tc := range []struct {
+		values []float64
+		counts []uint64
+	}{
+		{[]float64{1, 2}, []uint64{1}},
+		{[]float64{1, math.NaN()}, []uint64{1, 1}},
+		{[]float64{1, 2}, []uint64{1, 0}},
+		{[]float64{1, 2}, []uint64{1, math.MaxUint64}},
+	} {
+		if err := tdigest.AddBatchWeighted(tc.values, tc.counts); err == nil {
+			t.Errorf("Expected %v with counts %v to be rejected", tc.values, tc.counts)
+		}
+	}
+	if tdigest.count != 11 {
+		t.Errorf("Expected rejected batches not to add anything, got count %d", tdigest.count)
+	}
+}
+
+func BenchmarkAddBatch(b *testing.B) {
+	data := make([]float64, b.N)
+	for i := range data {
+		data[i] = rand.Float64()
+	}
+	b.ResetTimer()
+	New(100).AddBatch(data)
+}
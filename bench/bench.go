@@ -0,0 +1,223 @@
+//go:build !tdigest_lite
+
+// Package bench provides reusable benchmark drivers for tdigest, so that
+// users and CI pipelines can measure the configurations they actually run
+// (distribution × size × compression × operation) and catch performance
+// regressions, with results in a machine readable form.
+//
+// From a regular Go benchmark:
+//
+//	func BenchmarkDigest(b *testing.B) {
+//		bench.RunB(b, bench.DefaultConfig())
+//	}
+//
+// Or standalone, emitting one JSON result per line:
+//
+//	bench.WriteJSON(os.Stdout, bench.Run(bench.DefaultConfig()))
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/honeycombio/go-tdigest"
+)
+
+// Distribution generates the samples fed to the digests.
+type Distribution struct {
+	Name   string
+	Sample func(r *rand.Rand) float64
+}
+
+// Built-in distributions.
+var (
+	Uniform     = Distribution{"uniform", func(r *rand.Rand) float64 { return r.Float64() }}
+	Normal      = Distribution{"normal", func(r *rand.Rand) float64 { return r.NormFloat64() }}
+	Exponential = Distribution{"exponential", func(r *rand.Rand) float64 { return r.ExpFloat64() }}
+	LogNormal   = Distribution{"lognormal", func(r *rand.Rand) float64 { return math.Exp(r.NormFloat64()) }}
+)
+
+// Operation is a benchmarked digest operation. Bench must run the
+// operation b.N times against digests of the given compression, built
+// from (or fed with) data.
+type Operation struct {
+	Name  string
+	Bench func(b *testing.B, compression float64, data []float64)
+}
+
+// Built-in operations.
+var (
+	// Add measures adding every sample of the dataset to an empty digest.
+	Add = Operation{"add", benchAdd}
+
+	// Quantile measures a single quantile query.
+	Quantile = Operation{"quantile", benchQuantile}
+
+	// Merge measures merging a digest of the dataset into an empty one.
+	Merge = Operation{"merge", benchMerge}
+
+	// ToBytes measures serializing a digest of the dataset.
+	ToBytes = Operation{"tobytes", benchToBytes}
+
+	// FromBytes measures deserializing a digest of the dataset.
+	FromBytes = Operation{"frombytes", benchFromBytes}
+)
+
+// Config lists the combinations to benchmark: every operation is run for
+// every distribution, size and compression.
+type Config struct {
+	Distributions []Distribution
+	Sizes         []int
+	Compressions  []float64
+	Operations    []Operation
+
+	// Seed makes the generated datasets reproducible.
+	Seed int64
+}
+
+// DefaultConfig returns a configuration covering the built-in
+// distributions and operations over a few common sizes and compressions.
+func DefaultConfig() Config {
+	return Config{
+		Distributions: []Distribution{Uniform, Normal, Exponential, LogNormal},
+		Sizes:         []int{1000, 100000},
+		Compressions:  []float64{10, 100},
+		Operations:    []Operation{Add, Quantile, Merge, ToBytes, FromBytes},
+		Seed:          1,
+	}
+}
+
+// Result is the outcome of benchmarking one combination.
+type Result struct {
+	Distribution string  `json:"distribution"`
+	Size         int     `json:"size"`
+	Compression  float64 `json:"compression"`
+	Operation    string  `json:"operation"`
+	Iterations   int     `json:"iterations"`
+	NsPerOp      int64   `json:"ns_per_op"`
+	AllocsPerOp  int64   `json:"allocs_per_op"`
+	BytesPerOp   int64   `json:"bytes_per_op"`
+}
+
+// Name identifies the combination, as used for sub-benchmarks by RunB.
+func (r Result) Name() string {
+	return fmt.Sprintf("%s/%s/n=%d/c=%g", r.Operation, r.Distribution, r.Size, r.Compression)
+}
+
+// Run benchmarks every combination of c with testing.Benchmark.
+func Run(c Config) []Result {
+	var results []Result
+	c.each(func(r Result, f func(b *testing.B)) {
+		br := testing.Benchmark(f)
+		r.Iterations = br.N
+		r.NsPerOp = br.NsPerOp()
+		r.AllocsPerOp = br.AllocsPerOp()
+		r.BytesPerOp = br.AllocedBytesPerOp()
+		results = append(results, r)
+	})
+	return results
+}
+
+// RunB runs every combination of c as a sub-benchmark of b, so results
+// can be compared with the usual tooling (benchstat, etc).
+func RunB(b *testing.B, c Config) {
+	c.each(func(r Result, f func(b *testing.B)) {
+		b.Run(r.Name(), f)
+	})
+}
+
+// WriteJSON writes results to w, one JSON object per line.
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	for _, r := range results {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c Config) each(f func(r Result, bench func(b *testing.B))) {
+	for _, dist := range c.Distributions {
+		for _, size := range c.Sizes {
+			data := generate(dist, size, c.Seed)
+			for _, compression := range c.Compressions {
+				for _, op := range c.Operations {
+					op, compression := op, compression
+					r := Result{Distribution: dist.Name, Size: size, Compression: compression, Operation: op.Name}
+					f(r, func(b *testing.B) {
+						b.ReportAllocs()
+						op.Bench(b, compression, data)
+					})
+				}
+			}
+		}
+	}
+}
+
+func generate(dist Distribution, size int, seed int64) []float64 {
+	r := rand.New(rand.NewSource(seed))
+	data := make([]float64, size)
+	for i := range data {
+		data[i] = dist.Sample(r)
+	}
+	return data
+}
+
+func digestOf(compression float64, data []float64) *tdigest.TDigest {
+	t := tdigest.New(compression)
+	for _, x := range data {
+		t.Add(x, 1)
+	}
+	return t
+}
+
+func benchAdd(b *testing.B, compression float64, data []float64) {
+	for n := 0; n < b.N; n++ {
+		t := tdigest.New(compression)
+		for _, x := range data {
+			t.Add(x, 1)
+		}
+	}
+}
+
+func benchQuantile(b *testing.B, compression float64, data []float64) {
+	t := digestOf(compression, data)
+	qs := []float64{0.5, 0.9, 0.99, 0.999}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		t.Quantile(qs[n%len(qs)])
+	}
+}
+
+func benchMerge(b *testing.B, compression float64, data []float64) {
+	t := digestOf(compression, data)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		tdigest.New(compression).Merge(t)
+	}
+}
+
+func benchToBytes(b *testing.B, compression float64, data []float64) {
+	t := digestOf(compression, data)
+	var buf []byte
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		buf = t.ToBytes(buf)
+	}
+}
+
+func benchFromBytes(b *testing.B, compression float64, data []float64) {
+	buf := digestOf(compression, data).ToBytes(nil)
+	var t tdigest.TDigest
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := t.FromBytes(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+//go:build !tdigest_lite
+
+package bench
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skipf("Skipping benchmark driver test. Short flag is on")
+	}
+
+	c := Config{
+		Distributions: []Distribution{Exponential},
+		Sizes:         []int{100},
+		Compressions:  []float64{10},
+		Operations:    []Operation{Quantile},
+		Seed:          42,
+	}
+
+	results := Run(c)
+	if len(results) != 1 {
+		t.Fatalf("Expected a single result, got %d", len(results))
+	}
+
+	r := results[0]
+	if r.Name() != "quantile/exponential/n=100/c=10" || r.Iterations == 0 || r.NsPerOp <= 0 {
+		t.Errorf("Unexpected result %+v", r)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded != r {
+		t.Errorf("Expected results to round-trip through JSON. Got %+v, %v", decoded, err)
+	}
+}
+
+func TestGenerateIsReproducible(t *testing.T) {
+	a := generate(LogNormal, 10, 7)
+	b := generate(LogNormal, 10, 7)
+	for i := range a {
+		if a[i] != b[i] || a[i] <= 0 {
+			t.Fatalf("Expected identical positive datasets. Got %v and %v", a, b)
+		}
+	}
+}
+
+func BenchmarkDefault(b *testing.B) {
+	c := DefaultConfig()
+	c.Sizes = []int{1000}
+	RunB(b, c)
+}
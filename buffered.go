@@ -0,0 +1,80 @@
+package tdigest
+
+import (
+	"errors"
+	"sort"
+)
+
+// WithBufferedAdd makes Add stage samples in an unsorted buffer of the
+// given size rather than inserting them in the summary one by one. Once
+// the buffer is full, its samples are sorted and folded into the summary
+// in a single pass, along with the existing centroids, like FromSamples
+// does. This avoids the binary search and the shifting of the centroids
+// Add otherwise pays for every sample, and compresses the digest as a side
+// effect. Queries, iteration, serialization and merges fold the buffer in
+// first, so results don't depend on when it last filled up.
+//
+// A size of a few thousand amortizes the folding well; larger sizes only
+// hold more samples in memory.
+func WithBufferedAdd(size int) Option {
+	return func(t *TDigest) error {
+		if size < 1 {
+			return errors.New("buffer size must be at least 1")
+		}
+		t.buffer = newSummary(uint(size))
+		return nil
+	}
+}
+
+// addBuffered stages a sample, folding the buffer in once it is full.
+func (t *TDigest) addBuffered(value float64, count uint64) {
+	b := t.buffer
+	b.keys = append(b.keys, value)
+	b.counts = append(b.counts, count)
+	t.count += count
+	if len(b.keys) == cap(b.keys) {
+		t.flush()
+	}
+}
+
+// buffered reports whether samples are waiting to be folded in.
+func (t *TDigest) buffered() bool {
+	return t.buffer != nil && len(t.buffer.keys) > 0
+}
+
+// flush folds the buffered samples into the summary and empties the
+// buffer.
+func (t *TDigest) flush() {
+	if !t.buffered() {
+		return
+	}
+	sort.Sort(t.buffer)
+	t.fold(t.buffer)
+	t.buffer.keys = t.buffer.keys[:0]
+	t.buffer.counts = t.buffer.counts[:0]
+}
+
+// fold merges the points of b, sorted by mean, with the centroids of the
+// summary, then compacts the result.
+func (t *TDigest) fold(b *summary) {
+	s := t.summary
+	merged := newAllocatedSummary(uint(s.Len()+b.Len()), s.alloc)
+	i, j := 0, 0
+	for i < s.Len() || j < b.Len() {
+		if j == b.Len() || (i < s.Len() && s.keys[i] <= b.keys[j]) {
+			merged.keys = append(merged.keys, s.keys[i])
+			merged.counts = append(merged.counts, s.counts[i])
+			i++
+		} else {
+			merged.keys = append(merged.keys, b.keys[j])
+			merged.counts = append(merged.counts, b.counts[j])
+			j++
+		}
+	}
+
+	// compactSorted reads every point before writing where it was, so it
+	// can compact the merged points in place.
+	t.summary = merged
+	t.compactSorted(merged.keys, merged.counts)
+	s.release()
+}
@@ -0,0 +1,113 @@
+package tdigest
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestBufferedAdd(t *testing.T) {
+	tdigest := New(100, WithBufferedAdd(1000))
+	for i := 0; i < 100000; i++ {
+		tdigest.Add(rand.Float64(), 1)
+	}
+	tdigest.Add(0.5, 10)
+
+	if tdigest.count != 100010 {
+		t.Errorf("Expected 100010 samples, got %d", tdigest.count)
+	}
+	if !tdigest.buffered() {
+		t.Fatalf("Expected the last samples to still be buffered")
+	}
+
+	var total uint64
+	tdigest.ForEachCentroid(func(mean float64, count uint64) bool {
+		total += count
+		return true
+	})
+	if total != 100010 {
+		t.Errorf("Expected the centroids to hold 100010 samples, got %d", total)
+	}
+	if tdigest.buffered() {
+		t.Errorf("Reads should fold the buffer in")
+	}
+	if got := tdigest.Len(); got > 1000 {
+		t.Errorf("Expected folding to keep the digest compressed, got %d centroids", got)
+	}
+
+	assertDifferenceSmallerThan(tdigest, 0.5, 0.02, t)
+	assertDifferenceSmallerThan(tdigest, 0.1, 0.01, t)
+	assertDifferenceSmallerThan(tdigest, 0.9, 0.01, t)
+}
+
+func TestBufferedAddQueries(t *testing.T) {
+	tdigest := New(100, WithBufferedAdd(100))
+	for _, x := range []float64{3, 1, 2, 1} {
+		tdigest.Add(x, 1)
+	}
+
+	// AsBytes can't fold the buffer into the digest, so it must serialize a
+	// folded copy and leave the original alone.
+	buf, err := tdigest.AsBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tdigest.buffered() {
+		t.Errorf("AsBytes should not modify the digest")
+	}
+	decoded, err := FromBytes(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.count != 4 || decoded.Len() != 3 {
+		t.Errorf("Expected 4 samples in 3 centroids after decoding, got %d in %d", decoded.count, decoded.Len())
+	}
+
+	if q := tdigest.Quantile(0); q != 1 {
+		t.Errorf("Expected the smallest sample to be 1, got %v", q)
+	}
+	if tdigest.buffered() {
+		t.Errorf("Queries should fold the buffer in")
+	}
+
+	// Compressing must not send the centroids back to the buffer.
+	tdigest.Compress()
+	if tdigest.buffered() || tdigest.count != 4 {
+		t.Errorf("Expected Compress to keep the 4 samples in the summary")
+	}
+
+	// Neither must cloning share it.
+	tdigest.Add(4, 1)
+	c := tdigest.clone()
+	c.Add(5, 1)
+	if c.buffer == tdigest.buffer || tdigest.buffered() {
+		t.Errorf("Expected clones to have a buffer of their own")
+	}
+}
+
+func TestBufferedAddMerge(t *testing.T) {
+	a, b := New(100, WithBufferedAdd(50)), New(100, WithBufferedAdd(50))
+	for i := 0; i < 1010; i++ {
+		a.Add(float64(i), 1)
+		b.Add(float64(i+1010), 1)
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if a.count != 2020 {
+		t.Errorf("Expected 2020 samples after merging, got %d", a.count)
+	}
+	if q := a.Quantile(1); q != 2019 {
+		t.Errorf("Expected a maximum of 2019, got %v", q)
+	}
+}
+
+func TestWithBufferedAddRejectsBadSizes(t *testing.T) {
+	if _, err := newWithOptions(100, []Option{WithBufferedAdd(0)}); err == nil {
+		t.Errorf("Expected a buffer size of 0 to be rejected")
+	}
+}
+
+func BenchmarkAddBuffered(b *testing.B) {
+	benchmarkAdd(100, b, WithBufferedAdd(4096))
+}
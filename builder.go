@@ -0,0 +1,50 @@
+package tdigest
+
+// Builder accumulates samples into a digest that is only handed out as a
+// FrozenDigest, so that readers can never modify what they were given and
+// the builder can keep going while they read. Like TDigest, a Builder is
+// not safe for concurrent use, but the digests it builds are.
+type Builder struct {
+	t *TDigest
+}
+
+// NewBuilder creates a Builder. Arguments are those of New, which it
+// panics like.
+func NewBuilder(compression float64, options ...Option) *Builder {
+	return &Builder{t: New(compression, options...)}
+}
+
+// Add registers a new sample, see TDigest.Add.
+func (b *Builder) Add(value float64, count uint64) error {
+	return b.t.Add(value, count)
+}
+
+// AddWeighted registers a sample with a fractional weight, see
+// TDigest.AddWeighted.
+func (b *Builder) AddWeighted(value, weight float64) error {
+	return b.t.AddWeighted(value, weight)
+}
+
+// AddBatch adds every given value with a count of 1, see
+// TDigest.AddBatch.
+func (b *Builder) AddBatch(values []float64) error {
+	return b.t.AddBatch(values)
+}
+
+// Merge joins other into the digest being built, see TDigest.Merge.
+func (b *Builder) Merge(other *TDigest) error {
+	return b.t.Merge(other)
+}
+
+// MergeFrozen joins a built digest into the digest being built, leaving
+// it untouched for its other readers.
+func (b *Builder) MergeFrozen(other *FrozenDigest) error {
+	return b.t.MergeDestructive(other.d.clone())
+}
+
+// Build returns a FrozenDigest holding every sample added so far. The
+// builder remains usable, and later builds include the samples of earlier
+// ones.
+func (b *Builder) Build() *FrozenDigest {
+	return b.t.Freeze()
+}
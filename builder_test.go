@@ -0,0 +1,51 @@
+package tdigest
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder(100)
+	for i := 0; i < 1000; i++ {
+		b.Add(float64(i), 1)
+	}
+	first := b.Build()
+
+	// Readers of the first build are unaffected by the builder going on.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if first.Count() != 1000 {
+				t.Errorf("Expected the first build to keep 1000 samples, got %d", first.Count())
+				return
+			}
+			first.Quantile(0.5)
+		}
+	}()
+	b.AddBatch([]float64{1000, 1001})
+	b.AddWeighted(1002, 1)
+	wg.Wait()
+
+	other := New(100)
+	other.Add(-1, 1)
+	if err := b.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.MergeFrozen(first); err != nil {
+		t.Fatal(err)
+	}
+	if first.Count() != 1000 || first.Quantile(0) != 0 {
+		t.Errorf("Expected merging a build not to modify it")
+	}
+
+	second := b.Build()
+	if second.Count() != 2004 {
+		t.Errorf("Expected the second build to hold 2004 samples, got %d", second.Count())
+	}
+	if second.Quantile(0) != -1 || second.Quantile(1) != 1002 {
+		t.Errorf("Expected the second build to span -1 to 1002, got %v to %v", second.Quantile(0), second.Quantile(1))
+	}
+}
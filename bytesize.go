@@ -0,0 +1,93 @@
+package tdigest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ByteSizeUnit is the metadata unit of the digests behind ByteSizeDigest.
+const ByteSizeUnit = "B"
+
+// ByteSize is a number of bytes. It formats itself with IEC prefixes,
+// e.g. "1.4 MiB".
+type ByteSize uint64
+
+var byteSizePrefixes = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+func (b ByteSize) String() string {
+	if b < 1024 {
+		return fmt.Sprintf("%d B", uint64(b))
+	}
+
+	size := float64(b) / 1024
+	prefix := 0
+	for size >= 1024 && prefix < len(byteSizePrefixes)-1 {
+		size /= 1024
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %s", size, byteSizePrefixes[prefix])
+}
+
+// ByteSizeDigest is a digest of byte sizes, such as payload lengths. The
+// underlying digest is tagged with ByteSizeUnit so that merging it with a
+// digest of another unit fails.
+type ByteSizeDigest struct {
+	digest *TDigest
+}
+
+// NewByteSizeDigest creates an empty ByteSizeDigest. The compression and
+// options are the same as for New, which panics on invalid ones.
+func NewByteSizeDigest(compression float64, options ...Option) *ByteSizeDigest {
+	t := New(compression, options...)
+	if t.metadata == nil {
+		t.metadata = &Metadata{}
+	}
+	if t.metadata.Unit == "" {
+		t.metadata.Unit = ByteSizeUnit
+	}
+	return &ByteSizeDigest{digest: t}
+}
+
+// Observe adds a size to the digest.
+func (d *ByteSizeDigest) Observe(size ByteSize) {
+	d.digest.Add(float64(size), 1)
+}
+
+// QuantileSize returns the size at quantile q, rounded to the nearest
+// byte. See TDigest.Quantile.
+func (d *ByteSizeDigest) QuantileSize(q float64) ByteSize {
+	return ByteSize(math.Round(d.digest.Quantile(q)))
+}
+
+// FormatQuantiles describes the sizes at the given quantiles in a human
+// readable way, e.g. "p50 = 12.0 KiB, p99 = 1.4 MiB".
+func (d *ByteSizeDigest) FormatQuantiles(qs ...float64) string {
+	parts := make([]string, len(qs))
+	for i, q := range qs {
+		parts[i] = fmt.Sprintf("%s = %s", percentileLabel(q), d.QuantileSize(q))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// percentileLabel names quantile q the way percentiles usually are, e.g.
+// "p99.9" for 0.999.
+func percentileLabel(q float64) string {
+	return "p" + strconv.FormatFloat(math.Round(q*1e5)/1e3, 'f', -1, 64)
+}
+
+// Count returns the number of observed sizes.
+func (d *ByteSizeDigest) Count() uint64 {
+	return d.digest.count
+}
+
+// Merge merges other into d. See TDigest.Merge.
+func (d *ByteSizeDigest) Merge(other *ByteSizeDigest) error {
+	return d.digest.Merge(other.digest)
+}
+
+// Digest returns the underlying digest, whose values are bytes.
+func (d *ByteSizeDigest) Digest() *TDigest {
+	return d.digest
+}
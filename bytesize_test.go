@@ -0,0 +1,52 @@
+package tdigest
+
+import "testing"
+
+func TestByteSizeString(t *testing.T) {
+	for size, want := range map[ByteSize]string{
+		0:                   "0 B",
+		1023:                "1023 B",
+		1024:                "1.0 KiB",
+		1536:                "1.5 KiB",
+		1468006:             "1.4 MiB",
+		5 << 30:             "5.0 GiB",
+		1 << 63:             "8.0 EiB",
+		ByteSize(1<<64 - 1): "16.0 EiB",
+	} {
+		if got := size.String(); got != want {
+			t.Errorf("ByteSize(%d).String() = %q, wanted %q", uint64(size), got, want)
+		}
+	}
+}
+
+func TestByteSizeDigest(t *testing.T) {
+	d := NewByteSizeDigest(100)
+	for i := 1; i <= 1000; i++ {
+		d.Observe(ByteSize(i) << 10)
+	}
+
+	if d.Count() != 1000 {
+		t.Errorf("Expected 1000 sizes, got %d", d.Count())
+	}
+	if got := d.QuantileSize(1); got != 1000<<10 {
+		t.Errorf("QuantileSize(1) = %d, wanted %d", got, 1000<<10)
+	}
+	if got, want := d.FormatQuantiles(0, 1), "p0 = 1.0 KiB, p100 = 1000.0 KiB"; got != want {
+		t.Errorf("FormatQuantiles() = %q, wanted %q", got, want)
+	}
+	if unit := d.Digest().Metadata().Unit; unit != ByteSizeUnit {
+		t.Errorf("Expected the digest to be tagged with unit %q, got %q", ByteSizeUnit, unit)
+	}
+
+	if err := d.Digest().Merge(NewDurationDigest(100).Digest()); err == nil {
+		t.Errorf("Expected merging durations into a ByteSizeDigest to fail")
+	}
+}
+
+func TestPercentileLabel(t *testing.T) {
+	for q, want := range map[float64]string{0.5: "p50", 0.99: "p99", 0.999: "p99.9", 0.9999: "p99.99"} {
+		if got := percentileLabel(q); got != want {
+			t.Errorf("percentileLabel(%v) = %q, wanted %q", q, got, want)
+		}
+	}
+}
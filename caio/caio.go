@@ -0,0 +1,199 @@
+//go:build !tdigest_lite
+
+// Package tdigest mirrors the API of github.com/caio/go-tdigest on top of
+// github.com/honeycombio/go-tdigest, so that projects using the former can
+// switch with an import change:
+//
+//	import tdigest "github.com/honeycombio/go-tdigest/caio"
+//
+// Digests read and write the same serialization. Digest gives access to
+// the underlying digest and the rest of its features.
+package tdigest
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+
+	tdigest "github.com/honeycombio/go-tdigest"
+)
+
+// RNG is the source of randomness of the upstream package.
+type RNG interface {
+	Float32() float32
+	Intn(int) int
+}
+
+// TDigest is a quantile approximation data structure.
+type TDigest struct {
+	d *tdigest.TDigest
+}
+
+type config struct {
+	compression float64
+}
+
+type tdigestOption func(*config) error
+
+// Compression sets the compression of the digest, 100 by default.
+func Compression(compression float64) tdigestOption {
+	return func(c *config) error {
+		if compression < 1 {
+			return errors.New("Compression should be >= 1")
+		}
+		c.compression = compression
+		return nil
+	}
+}
+
+// RandomNumberGenerator is accepted for compatibility, but the digests
+// of this package always draw from math/rand.
+func RandomNumberGenerator(rng RNG) tdigestOption {
+	return func(*config) error { return nil }
+}
+
+// LocalRandomNumberGenerator is accepted for compatibility, but the
+// digests of this package always draw from math/rand.
+func LocalRandomNumberGenerator(seed int64) tdigestOption {
+	return RandomNumberGenerator(rand.New(rand.NewSource(seed)))
+}
+
+func newConfig(options []tdigestOption) (*config, error) {
+	c := &config{compression: tdigest.DefaultCompression}
+	for _, option := range options {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// New creates a new digest.
+func New(options ...tdigestOption) (*TDigest, error) {
+	c, err := newConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	d, err := tdigest.FromCentroids(nil, nil, tdigest.Compression(c.compression))
+	if err != nil {
+		return nil, err
+	}
+	return &TDigest{d: d}, nil
+}
+
+// Wrap returns a digest of this package backed by d.
+func Wrap(d *tdigest.TDigest) *TDigest {
+	return &TDigest{d: d}
+}
+
+// Digest returns the digest backing t, which t keeps using.
+func (t *TDigest) Digest() *tdigest.TDigest {
+	return t.d
+}
+
+// FromBytes reads a digest serialized by ToBytes or AsBytes. Options
+// given override those recorded in buf.
+func FromBytes(buf *bytes.Reader, options ...tdigestOption) (*TDigest, error) {
+	d, err := tdigest.FromBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+	if len(options) == 0 {
+		return &TDigest{d: d}, nil
+	}
+
+	c, err := newConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	o, err := New(Compression(c.compression))
+	if err != nil {
+		return nil, err
+	}
+	if err := o.d.Merge(d); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// FromBytes replaces the contents of t with those serialized in buf.
+func (t *TDigest) FromBytes(buf []byte) error {
+	return t.d.FromBytes(buf)
+}
+
+// Add registers a sample.
+func (t *TDigest) Add(value float64) error {
+	return t.d.Add(value, 1)
+}
+
+// AddWeighted registers a sample occurring count times.
+func (t *TDigest) AddWeighted(value float64, count uint64) error {
+	return t.d.Add(value, count)
+}
+
+// Quantile returns the estimated value at quantile q, which must be
+// between 0 and 1.
+func (t *TDigest) Quantile(q float64) float64 {
+	return t.d.Quantile(q)
+}
+
+// CDF returns the estimated fraction of the samples at or below value.
+func (t *TDigest) CDF(value float64) float64 {
+	return t.d.CDF(value)
+}
+
+// TrimmedMean returns the mean of the samples between quantiles lo and hi.
+func (t *TDigest) TrimmedMean(lo, hi float64) float64 {
+	return t.d.TrimmedMean(lo, hi)
+}
+
+// Merge joins other into t.
+func (t *TDigest) Merge(other *TDigest) error {
+	return t.d.Merge(other.d)
+}
+
+// MergeDestructive joins other into t, leaving other unusable.
+func (t *TDigest) MergeDestructive(other *TDigest) error {
+	return t.d.MergeDestructive(other.d)
+}
+
+// Compress reduces the number of centroids of the digest.
+func (t *TDigest) Compress() {
+	t.d.Compress()
+}
+
+// Count returns the number of samples of the digest.
+func (t *TDigest) Count() uint64 {
+	var n uint64
+	t.d.ForEachCentroid(func(_ float64, count uint64) bool {
+		n += count
+		return true
+	})
+	return n
+}
+
+// Compression returns the compression of the digest.
+func (t *TDigest) Compression() float64 {
+	return t.d.Compression()
+}
+
+// ForEachCentroid calls f for every centroid in ascending order of mean,
+// until it returns false.
+func (t *TDigest) ForEachCentroid(f func(mean float64, count uint64) bool) {
+	t.d.ForEachCentroid(f)
+}
+
+// Clone returns a deep copy of t.
+func (t *TDigest) Clone() *TDigest {
+	return &TDigest{d: t.d.Freeze().Digest()}
+}
+
+// ToBytes serializes t into b, reusing it if large enough.
+func (t *TDigest) ToBytes(b []byte) []byte {
+	return t.d.ToBytes(b)
+}
+
+// AsBytes serializes t.
+func (t *TDigest) AsBytes() ([]byte, error) {
+	return t.d.AsBytes()
+}
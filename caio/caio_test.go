@@ -0,0 +1,71 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestCompatibility(t *testing.T) {
+	d, err := New(Compression(50), LocalRandomNumberGenerator(0xbeef))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if err := d.Add(float64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.AddWeighted(1000, 10)
+
+	if d.Count() != 1010 || d.Compression() != 50 {
+		t.Errorf("Expected 1010 samples at compression 50, got %d at %v", d.Count(), d.Compression())
+	}
+	if q := d.Quantile(0.5); math.Abs(q-505) > 10 {
+		t.Errorf("Expected a median of about 505, got %v", q)
+	}
+	if q := d.Quantile(1); q != 1000 {
+		t.Errorf("Expected a maximum of 1000, got %v", q)
+	}
+
+	c := d.Clone()
+	c.Add(-1)
+	if d.Count() != 1010 || c.Count() != 1011 {
+		t.Errorf("Expected clones to be independent")
+	}
+	if err := d.Merge(c); err != nil || d.Count() != 2021 {
+		t.Errorf("Expected 2021 samples after merging, got %d (%v)", d.Count(), err)
+	}
+
+	decoded, err := FromBytes(bytes.NewReader(d.ToBytes(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Count() != d.Count() || math.Abs(decoded.Quantile(0.9)-d.Quantile(0.9)) > 0.01 {
+		t.Errorf("Expected the digest to survive serialization")
+	}
+	buf, _ := d.AsBytes()
+	recompressed, err := FromBytes(bytes.NewReader(buf), Compression(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recompressed.Compression() != 10 || recompressed.Count() != d.Count() {
+		t.Errorf("Expected options to override the serialized compression")
+	}
+	if Wrap(d.Digest()).Digest() != d.Digest() {
+		t.Errorf("Expected wrapped digests to be used as is")
+	}
+
+	other, _ := New()
+	if err := other.FromBytes(buf); err != nil || other.Count() != d.Count() {
+		t.Errorf("Expected the FromBytes method to decode the digest, got %v", err)
+	}
+}
+
+func TestNewRejectsBadCompression(t *testing.T) {
+	if _, err := New(Compression(0)); err == nil {
+		t.Errorf("Expected a compression of 0 to be rejected")
+	}
+}
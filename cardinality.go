@@ -0,0 +1,121 @@
+package tdigest
+
+import "errors"
+
+// CardinalityEstimator estimates the number of distinct values it was
+// given, such as a HyperLogLog sketch. Digests created
+// WithCardinalityEstimator insert the value of every sample added to them
+// into one, so that the distribution of the samples and their number of
+// distinct values are collected together. Estimate and Clone may be
+// called concurrently by the readers of a ConcurrentTDigest.
+type CardinalityEstimator interface {
+	Insert(value float64)
+	Estimate() uint64
+
+	// Clone returns an independent copy of the estimator, for copies of
+	// the digest such as snapshots.
+	Clone() CardinalityEstimator
+}
+
+// CardinalityMerger is implemented by estimators that can absorb the
+// values of another one. Merging digests merges their estimators when
+// both have one and the receiving one implements it.
+type CardinalityMerger interface {
+	Merge(other CardinalityEstimator) error
+}
+
+// WithCardinalityEstimator attaches an estimator, created by calling
+// newEstimator, to the digest, see CardinalityEstimator. The digest calls
+// newEstimator again for a fresh estimator whenever its samples are
+// replaced, when it is reset or read from bytes. Samples that came in as
+// centroids, deserialized or merged from a digest without a mergeable
+// estimator, are not counted. Copies of the digest, such as snapshots,
+// get a Clone of its estimator.
+func WithCardinalityEstimator(newEstimator func() CardinalityEstimator) Option {
+	return func(t *TDigest) error {
+		if newEstimator == nil {
+			return errors.New("cardinality estimator constructor must not be nil")
+		}
+		t.newDistinct = newEstimator
+		t.distinct = newEstimator()
+		return nil
+	}
+}
+
+// resetDistinct replaces the estimator of the digest, if any, with a
+// fresh one.
+func (t *TDigest) resetDistinct() {
+	if t.newDistinct != nil {
+		t.distinct = t.newDistinct()
+	}
+}
+
+// mergeDistinct merges the estimator of other into that of t, if they
+// both have one.
+func (t *TDigest) mergeDistinct(other *TDigest) error {
+	m, ok := t.distinct.(CardinalityMerger)
+	if !ok || other.distinct == nil {
+		return nil
+	}
+	return m.Merge(other.distinct)
+}
+
+// Cardinality returns the estimated number of distinct values among the
+// samples of the digest, and false if it has no CardinalityEstimator.
+func (t *TDigest) Cardinality() (uint64, bool) {
+	if t.distinct == nil {
+		return 0, false
+	}
+	return t.distinct.Estimate(), true
+}
+
+// CardinalitySummary describes both the distribution of the samples of a
+// digest and their number of distinct values.
+type CardinalitySummary struct {
+	Count    uint64  `json:"count"`
+	Distinct uint64  `json:"distinct"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Mean     float64 `json:"mean"`
+
+	// Values are the estimated values at Quantiles.
+	Quantiles []float64 `json:"quantiles"`
+	Values    []float64 `json:"values"`
+}
+
+// CardinalitySummary returns the count, distinct count, extremes, mean and
+// values at quantiles qs of the samples of the digest. It fails if the
+// digest has no CardinalityEstimator, or for quantiles Quantiles rejects.
+func (t *TDigest) CardinalitySummary(qs ...float64) (CardinalitySummary, error) {
+	distinct, ok := t.Cardinality()
+	if !ok {
+		return CardinalitySummary{}, errors.New("digest has no cardinality estimator")
+	}
+	values, err := t.Quantiles(qs)
+	if err != nil {
+		return CardinalitySummary{}, err
+	}
+	return CardinalitySummary{
+		Count:     t.count,
+		Distinct:  distinct,
+		Min:       t.Min(),
+		Max:       t.Max(),
+		Mean:      t.Mean(),
+		Quantiles: append([]float64(nil), qs...),
+		Values:    values,
+	}, nil
+}
+
+// Cardinality returns the estimated number of distinct values among the
+// samples of the digest, see TDigest.Cardinality.
+func (c *ConcurrentTDigest) Cardinality() (distinct uint64, ok bool) {
+	c.read(func(t *TDigest) { distinct, ok = t.Cardinality() })
+	return distinct, ok
+}
+
+// CardinalitySummary describes the samples of the digest, see
+// TDigest.CardinalitySummary.
+func (c *ConcurrentTDigest) CardinalitySummary(qs ...float64) (s CardinalitySummary, err error) {
+	c.read(func(t *TDigest) { s, err = t.CardinalitySummary(qs...) })
+	return s, err
+}
@@ -0,0 +1,158 @@
+package tdigest
+
+import (
+	"errors"
+	"testing"
+)
+
+// exactSet is a CardinalityEstimator counting distinct values exactly.
+type exactSet map[float64]bool
+
+func (s exactSet) Insert(value float64) { s[value] = true }
+func (s exactSet) Estimate() uint64     { return uint64(len(s)) }
+
+func (s exactSet) Merge(other CardinalityEstimator) error {
+	o, ok := other.(exactSet)
+	if !ok {
+		return errors.New("incompatible estimators")
+	}
+	for v := range o {
+		s[v] = true
+	}
+	return nil
+}
+
+func (s exactSet) Clone() CardinalityEstimator {
+	c := make(exactSet, len(s))
+	for v := range s {
+		c[v] = true
+	}
+	return c
+}
+
+func newExactSet() CardinalityEstimator { return exactSet{} }
+
+func TestCardinality(t *testing.T) {
+	d := New(100, WithCardinalityEstimator(newExactSet))
+	for i := 0; i < 1000; i++ {
+		d.Add(float64(i%250), 1)
+	}
+	d.AddBatch([]float64{1000, 1001, 5})
+	if n, ok := d.Cardinality(); !ok || n != 252 {
+		t.Errorf("Expected 252 distinct values, got %d, %v", n, ok)
+	}
+
+	other := New(100, WithCardinalityEstimator(newExactSet))
+	other.Add(-1, 3)
+	if err := d.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := d.Cardinality(); n != 253 {
+		t.Errorf("Expected 253 distinct values after merging, got %d", n)
+	}
+
+	s, err := d.CardinalitySummary(0.5, 0.99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Count != 1006 || s.Distinct != 253 || s.Min != -1 || s.Max != 1001 || len(s.Values) != 2 || s.Quantiles[1] != 0.99 {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+	if _, err := d.CardinalitySummary(2); err == nil {
+		t.Errorf("Expected invalid quantiles to be rejected")
+	}
+
+	d.Reset()
+	if n, ok := d.Cardinality(); !ok || n != 0 {
+		t.Errorf("Expected a fresh estimator after resetting, got %d, %v", n, ok)
+	}
+
+	f, err := FromSamples([]float64{1, 1, 2}, WithCardinalityEstimator(newExactSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := f.Cardinality(); n != 2 {
+		t.Errorf("Expected FromSamples to count 2 distinct values, got %d", n)
+	}
+}
+
+func TestNoCardinality(t *testing.T) {
+	d := New(100)
+	d.Add(1, 1)
+	if _, ok := d.Cardinality(); ok {
+		t.Errorf("Expected no cardinality without an estimator")
+	}
+	if _, err := d.CardinalitySummary(0.5); err == nil {
+		t.Errorf("Expected an error summarizing without an estimator")
+	}
+
+	// Merging digests without estimators leaves the estimate alone.
+	e := New(100, WithCardinalityEstimator(newExactSet))
+	e.Add(2, 1)
+	if err := e.Merge(d); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := e.Cardinality(); n != 1 {
+		t.Errorf("Expected 1 distinct value, got %d", n)
+	}
+
+	if _, err := newWithOptions(100, []Option{WithCardinalityEstimator(nil)}); err == nil {
+		t.Errorf("Expected a nil estimator constructor to be rejected")
+	}
+}
+
+func TestCardinalityCopies(t *testing.T) {
+	d := New(100, WithCardinalityEstimator(newExactSet))
+	d.Add(1, 1)
+	copies := []*TDigest{d.Freeze().Digest(), d.clone()}
+	for i, c := range copies {
+		c.Add(float64(i+2), 1)
+		if n, _ := c.Cardinality(); n != 2 {
+			t.Errorf("Copy %d: expected 2 distinct values, got %d", i, n)
+		}
+	}
+	if n, _ := d.Cardinality(); n != 1 {
+		t.Errorf("Expected adding to copies to leave the original alone, got %d distinct values", n)
+	}
+
+	// Run with -race: snapshots don't share the estimator of the live
+	// digest.
+	c := NewConcurrent(100, WithCardinalityEstimator(newExactSet))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			c.Add(float64(i), 1)
+		}
+	}()
+	snapshot := c.Snapshot()
+	before, _ := snapshot.Cardinality()
+	for i := 0; i < 1000; i++ {
+		snapshot.Add(float64(-i-1), 1)
+	}
+	<-done
+	if n, _ := c.Cardinality(); n != 1000 {
+		t.Errorf("Expected adding to a snapshot to leave the original alone, got %d distinct values", n)
+	}
+	if n, _ := snapshot.Cardinality(); n != before+1000 {
+		t.Errorf("Expected the snapshot to count its own values, got %d after %d", n, before)
+	}
+}
+
+func TestMergingDigestCardinality(t *testing.T) {
+	m := NewMergingDigest(100, WithCardinalityEstimator(newExactSet))
+	other := NewMergingDigest(100, WithCardinalityEstimator(newExactSet))
+	for i := 0; i < 1000; i++ {
+		m.Add(float64(i%10), 1)
+		other.Add(float64(i%20), 1)
+	}
+	if n, _ := m.Digest().Cardinality(); n != 10 {
+		t.Errorf("Expected 10 distinct values, got %d", n)
+	}
+	if err := m.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := m.Digest().Cardinality(); n != 20 {
+		t.Errorf("Expected 20 distinct values after merging, got %d", n)
+	}
+}
@@ -0,0 +1,68 @@
+//go:build !tdigest_lite
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/honeycombio/go-tdigest/bench"
+)
+
+var distributions = []bench.Distribution{bench.Uniform, bench.Normal, bench.Exponential, bench.LogNormal}
+
+// runGen writes n samples of a distribution to stdout, one per line. The
+// distributions and seeding are those of the bench package, so the streams
+// match the benchmark datasets.
+func runGen(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	dist := fs.String("dist", "uniform", "distribution to sample: "+distributionNames())
+	n := fs.Float64("n", 1e6, "number of samples, exponent notation is accepted")
+	seed := fs.Int64("seed", 1, "random seed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *n < 0 || *n != math.Trunc(*n) || *n > math.MaxInt64 {
+		return fmt.Errorf("invalid number of samples %v", *n)
+	}
+	d, ok := findDistribution(*dist)
+	if !ok {
+		return fmt.Errorf("unknown distribution %q, expected one of %s", *dist, distributionNames())
+	}
+
+	w := bufio.NewWriter(stdout)
+	r := rand.New(rand.NewSource(*seed))
+	var buf []byte
+	for i := int64(0); i < int64(*n); i++ {
+		buf = strconv.AppendFloat(buf[:0], d.Sample(r), 'g', -1, 64)
+		buf = append(buf, '\n')
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func findDistribution(name string) (bench.Distribution, bool) {
+	for _, d := range distributions {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return bench.Distribution{}, false
+}
+
+func distributionNames() string {
+	names := make([]string, len(distributions))
+	for i, d := range distributions {
+		names[i] = d.Name
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,43 @@
+//go:build !tdigest_lite
+
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGen(t *testing.T) {
+	var first, second bytes.Buffer
+	if err := runGen([]string{"-dist", "lognormal", "-n", "1e3", "-seed", "7"}, &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGen([]string{"-dist", "lognormal", "-n", "1e3", "-seed", "7"}, &second); err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("The same seed should generate the same stream")
+	}
+
+	lines := strings.Split(strings.TrimSpace(first.String()), "\n")
+	if len(lines) != 1000 {
+		t.Fatalf("Expected 1000 samples, got %d", len(lines))
+	}
+	for _, line := range lines {
+		x, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x <= 0 {
+			t.Errorf("Lognormal samples should be positive, got %v", x)
+		}
+	}
+
+	for _, args := range [][]string{{"-dist", "cauchy"}, {"-n", "-1"}, {"-n", "1.5"}} {
+		if err := runGen(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("Expected gen %v to fail", args)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+//go:build !tdigest_lite
+
+// Command tdigest works with serialized digests from the command line.
+//
+// Usage:
+//
+//	tdigest <command> [arguments]
+//
+// Run "tdigest <command> -h" for the arguments of a command.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"rollup", "merge time-bucketed digests into coarser buckets", runRollup},
+	{"gen", "generate samples of a distribution", runGen},
+	{"verify", "check the accuracy of a digest against raw data", runVerify},
+	{"export", "write stored digests as an NDJSON stream", runExport},
+	{"import", "store the digests of an NDJSON stream", runImport},
+	{"migrate", "rewrite stored digests in the current format", runMigrate},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		err := c.run(os.Args[2:], os.Stdout)
+		if err == flag.ErrHelp {
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tdigest %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "tdigest: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: tdigest <command> [arguments]\n\nThe commands are:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "\t%-10s %s\n", c.name, c.summary)
+	}
+}
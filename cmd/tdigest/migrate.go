@@ -0,0 +1,66 @@
+//go:build !tdigest_lite
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/honeycombio/go-tdigest"
+)
+
+var encodings = map[string]tdigest.Encoding{
+	"small": tdigest.SmallEncoding,
+	"rle":   tdigest.RunLengthEncoding,
+}
+
+// runMigrate rewrites the digests of a FileStore directory in the current
+// format, in place unless another directory is given.
+func runMigrate(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	from := fs.String("from", "", "directory of the digests to migrate")
+	out := fs.String("out", "", "directory to write the migrated digests to (default -from, in place)")
+	workers := fs.Int("workers", runtime.GOMAXPROCS(0), "number of digests migrated in parallel")
+	encoding := fs.String("encoding", "small", "encoding to write: small or rle")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == "" {
+		return errors.New("-from is required")
+	}
+	if *out == "" {
+		*out = *from
+	}
+	if *workers < 1 {
+		return errors.New("-workers must be >= 1")
+	}
+	e, ok := encodings[*encoding]
+	if !ok {
+		return fmt.Errorf("unknown -encoding %q", *encoding)
+	}
+	if _, err := os.Stat(*from); err != nil {
+		return err
+	}
+
+	src, err := tdigest.NewFileStore(*from)
+	if err != nil {
+		return err
+	}
+	dst, err := tdigest.NewFileStore(*out)
+	if err != nil {
+		return err
+	}
+
+	n, err := tdigest.Migrate(context.Background(), src, dst, *workers, tdigest.WithEncoding(e))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "migrated %d digests\n", n)
+	return nil
+}
@@ -0,0 +1,67 @@
+//go:build !tdigest_lite
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/go-tdigest"
+)
+
+func TestMigrate(t *testing.T) {
+	from := t.TempDir()
+	src, err := tdigest.NewFileStore(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := tdigest.New(100)
+	for i := 0; i < 100; i++ {
+		d.Add(float64(i), 1)
+	}
+	if err := src.Put("a", ts, d); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if err := runMigrate([]string{"-from", from, "-encoding", "rle", "-workers", "2"}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "migrated 1 digests") {
+		t.Errorf("Unexpected output %q", stdout.String())
+	}
+
+	files, _ := filepath.Glob(filepath.Join(from, "a", "*.tdigest"))
+	if len(files) != 1 {
+		t.Fatalf("Expected the digest to be rewritten in place, found %v", files)
+	}
+	buf, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version := binary.BigEndian.Uint32(buf); version != uint32(tdigest.RunLengthEncoding) {
+		t.Errorf("Expected the run-length encoding, got version %d", version)
+	}
+
+	migrated, err := src.Get("a", ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated.Quantile(0.5) != d.Quantile(0.5) {
+		t.Errorf("Expected migration to preserve the digest")
+	}
+
+	if err := runMigrate([]string{"-from", from, "-encoding", "zstd"}, &stdout); err == nil {
+		t.Errorf("Expected an unknown encoding to be rejected")
+	}
+	if err := runMigrate(nil, &stdout); err == nil {
+		t.Errorf("Expected -from to be required")
+	}
+}
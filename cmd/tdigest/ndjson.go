@@ -0,0 +1,109 @@
+//go:build !tdigest_lite
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/honeycombio/go-tdigest"
+)
+
+// runExport writes every digest of a FileStore directory to stdout as an
+// NDJSON stream.
+func runExport(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	from := fs.String("from", "", "directory of the digests to export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" {
+		return errors.New("-from is required")
+	}
+	if _, err := os.Stat(*from); err != nil {
+		return err
+	}
+
+	src, err := tdigest.NewFileStore(*from)
+	if err != nil {
+		return err
+	}
+	keys, err := src.Keys()
+	if err != nil {
+		return err
+	}
+
+	w := tdigest.NewNDJSONWriter(stdout)
+	for _, key := range keys {
+		stored, err := src.List(key, time.Unix(0, math.MinInt64), time.Unix(0, math.MaxInt64))
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		for _, s := range stored {
+			if err := w.Write(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runImport stores the digests of an NDJSON stream, read from the given
+// file or stdin, into a FileStore directory.
+func runImport(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	out := fs.String("out", "", "directory to store the digests in")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tdigest import -out dir [stream.ndjson]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	in := io.Reader(os.Stdin)
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	dst, err := tdigest.NewFileStore(*out)
+	if err != nil {
+		return err
+	}
+
+	r := tdigest.NewNDJSONReader(in)
+	n := 0
+	for {
+		s, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := dst.Put(s.Key, s.Time, s.Digest); err != nil {
+			return err
+		}
+		n++
+	}
+
+	fmt.Fprintf(stdout, "imported %d digests\n", n)
+	return nil
+}
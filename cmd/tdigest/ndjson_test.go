@@ -0,0 +1,65 @@
+//go:build !tdigest_lite
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/go-tdigest"
+)
+
+func TestExportImport(t *testing.T) {
+	from := t.TempDir()
+	src, err := tdigest.NewFileStore(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, key := range []string{"a", "b", "b"} {
+		d := tdigest.New(100)
+		d.Add(float64(i), 1)
+		if err := src.Put(key, base.Add(time.Duration(i)*time.Minute), d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stream bytes.Buffer
+	if err := runExport([]string{"-from", from}, &stream); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(stream.String(), "\n"); lines != 3 {
+		t.Errorf("Expected 3 exported digests, got %d", lines)
+	}
+
+	path := filepath.Join(t.TempDir(), "stream.ndjson")
+	if err := os.WriteFile(path, stream.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	var stdout bytes.Buffer
+	if err := runImport([]string{"-out", out, path}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "imported 3 digests") {
+		t.Errorf("Unexpected output %q", stdout.String())
+	}
+
+	dst, err := tdigest.NewFileStore(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := dst.Get("b", base.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Quantile(0.5) != 2 {
+		t.Errorf("Expected the imported digest to match, got median %v", d.Quantile(0.5))
+	}
+}
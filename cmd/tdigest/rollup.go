@@ -0,0 +1,92 @@
+//go:build !tdigest_lite
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/honeycombio/go-tdigest"
+)
+
+// runRollup merges the digests of a FileStore directory into coarser time
+// buckets, writing them to another FileStore directory. Every digest is
+// merged into the bucket its timestamp falls in, once truncated to the
+// bucket size.
+func runRollup(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("rollup", flag.ContinueOnError)
+	from := fs.String("from", "", "directory of the digests to roll up")
+	out := fs.String("out", "", "directory to write the rolled up digests to")
+	bucket := fs.Duration("bucket", time.Hour, "size of the time buckets")
+	compression := fs.Float64("compression", tdigest.DefaultCompression, "compression of the rolled up digests")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == "" || *out == "" {
+		return errors.New("both -from and -out are required")
+	}
+	if *bucket <= 0 {
+		return errors.New("-bucket must be positive")
+	}
+	if *compression < 1 {
+		return errors.New("-compression must be >= 1")
+	}
+	if _, err := os.Stat(*from); err != nil {
+		return err
+	}
+
+	src, err := tdigest.NewFileStore(*from)
+	if err != nil {
+		return err
+	}
+	dst, err := tdigest.NewFileStore(*out)
+	if err != nil {
+		return err
+	}
+
+	keys, err := src.Keys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		stored, err := src.List(key, time.Unix(0, math.MinInt64), time.Unix(0, math.MaxInt64))
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+
+		buckets := make(map[int64][]*tdigest.TDigest)
+		for _, s := range stored {
+			start := s.Time.Truncate(*bucket).UnixNano()
+			buckets[start] = append(buckets[start], s.Digest)
+		}
+
+		starts := make([]int64, 0, len(buckets))
+		for start := range buckets {
+			starts = append(starts, start)
+		}
+		sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+		for _, start := range starts {
+			digests := buckets[start]
+			merged := tdigest.New(*compression)
+			if err := merged.MergeMany(digests...); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+			if err := dst.Put(key, time.Unix(0, start), merged); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(stdout, "%s: %d digests into %d buckets\n", key, len(stored), len(starts))
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+//go:build !tdigest_lite
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/go-tdigest"
+)
+
+func TestRollup(t *testing.T) {
+	from := t.TempDir()
+	out := filepath.Join(t.TempDir(), "out")
+
+	src, err := tdigest.NewFileStore(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		d := tdigest.New(100)
+		d.Add(float64(i), 1)
+		if err := src.Put("latency", base.Add(time.Duration(i)*20*time.Minute), d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.Put("size", base.Add(time.Minute), tdigest.New(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if err := runRollup([]string{"-from", from, "-out", out, "-bucket", "1h"}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "latency: 6 digests into 2 buckets") {
+		t.Errorf("Unexpected output %q", stdout.String())
+	}
+
+	dst, err := tdigest.NewFileStore(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rolled, err := dst.List("latency", base, base.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rolled) != 2 || !rolled[0].Time.Equal(base) || !rolled[1].Time.Equal(base.Add(time.Hour)) {
+		t.Fatalf("Expected hourly buckets, got %v", rolled)
+	}
+	if got := rolled[0].Digest.Quantile(1); got != 2 {
+		t.Errorf("Expected the first bucket to hold the first 3 digests, got max %v", got)
+	}
+	if got := rolled[1].Digest.Quantile(0); got != 3 {
+		t.Errorf("Expected the second bucket to hold the last 3 digests, got min %v", got)
+	}
+
+	if _, err := dst.Get("size", base); err != nil {
+		t.Errorf("Expected every key to be rolled up. Got %v", err)
+	}
+}
+
+func TestRollupArguments(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"-from", t.TempDir()},
+		{"-from", t.TempDir(), "-out", t.TempDir(), "-bucket", "0s"},
+		{"-from", filepath.Join(t.TempDir(), "missing"), "-out", t.TempDir()},
+	} {
+		if err := runRollup(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("Expected rollup %v to fail", args)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+//go:build !tdigest_lite
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/honeycombio/go-tdigest"
+)
+
+var verifyQuantiles = []float64{0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.95, 0.99, 0.999}
+
+// runVerify compares a serialized digest to the raw data it was built
+// from. Errors are measured in rank, as the difference between the
+// quantile asked for and the fraction of the raw data below the digest
+// estimate, which doesn't depend on the scale of the data.
+func runVerify(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	maxError := fs.Float64("max-rank-error", 0.01, "largest rank error tolerated at any quantile")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tdigest verify [flags] raw.txt digest.td")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	data, err := readSamples(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("no samples in " + fs.Arg(0))
+	}
+	sort.Float64s(data)
+
+	buf, err := os.ReadFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	d := &tdigest.TDigest{}
+	if err := d.FromBytes(buf); err != nil {
+		return fmt.Errorf("%s: %v", fs.Arg(1), err)
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "quantile\texact\tdigest\trank error\t")
+	failed := 0
+	for _, q := range verifyQuantiles {
+		estimate := d.Quantile(q)
+		rankError := math.Abs(rank(data, estimate) - q)
+		status := ""
+		if !(rankError <= *maxError) {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "%g\t%g\t%g\t%.6f\t%s\n", q, exactQuantile(data, q), estimate, rankError, status)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d quantiles exceed the rank error bound of %g", failed, *maxError)
+	}
+	return nil
+}
+
+// readSamples reads one number per line, skipping blank lines.
+func readSamples(path string) ([]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var data []float64
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		x, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		data = append(data, x)
+	}
+	return data, scanner.Err()
+}
+
+// exactQuantile interpolates linearly between the closest ranks of the
+// sorted data.
+func exactQuantile(sorted []float64, q float64) float64 {
+	index := q * float64(len(sorted)-1)
+	lo := int(index)
+	if lo+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (sorted[lo+1]-sorted[lo])*(index-float64(lo))
+}
+
+// rank returns the fraction of the sorted data below x, counting values
+// equal to x as half below.
+func rank(sorted []float64, x float64) float64 {
+	below := sort.SearchFloat64s(sorted, x)
+	equal := sort.Search(len(sorted), func(i int) bool { return sorted[i] > x }) - below
+	return (float64(below) + float64(equal)/2) / float64(len(sorted))
+}
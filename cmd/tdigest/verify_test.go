@@ -0,0 +1,87 @@
+//go:build !tdigest_lite
+
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/honeycombio/go-tdigest"
+)
+
+func writeVerifyFiles(t *testing.T, data []float64, d *tdigest.TDigest) (string, string) {
+	dir := t.TempDir()
+	var raw strings.Builder
+	for _, x := range data {
+		raw.WriteString(strconv.FormatFloat(x, 'g', -1, 64) + "\n")
+	}
+	rawPath := filepath.Join(dir, "raw.txt")
+	digestPath := filepath.Join(dir, "digest.td")
+	if err := os.WriteFile(rawPath, []byte(raw.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(digestPath, d.ToBytes(nil), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return rawPath, digestPath
+}
+
+func TestVerify(t *testing.T) {
+	data := make([]float64, 10000)
+	d := tdigest.New(100)
+	for i := range data {
+		data[i] = rand.ExpFloat64()
+		d.Add(data[i], 1)
+	}
+	rawPath, digestPath := writeVerifyFiles(t, data, d)
+
+	var stdout bytes.Buffer
+	if err := runVerify([]string{rawPath, digestPath}, &stdout); err != nil {
+		t.Fatalf("Expected an accurate digest to verify. Got %v\n%s", err, stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "0.99") {
+		t.Errorf("Expected a report by quantile, got %q", stdout.String())
+	}
+
+	// A digest of other data is way off.
+	other := tdigest.New(100)
+	for i := 0; i < 1000; i++ {
+		other.Add(rand.Float64(), 1)
+	}
+	_, otherPath := writeVerifyFiles(t, nil, other)
+	stdout.Reset()
+	if err := runVerify([]string{rawPath, otherPath}, &stdout); err == nil {
+		t.Errorf("Expected the wrong digest to fail verification")
+	}
+	if !strings.Contains(stdout.String(), "FAIL") {
+		t.Errorf("Expected failing quantiles to be flagged, got %q", stdout.String())
+	}
+
+	if err := runVerify([]string{rawPath}, &bytes.Buffer{}); err == nil {
+		t.Errorf("Expected verify to require two files")
+	}
+}
+
+func TestExactQuantileAndRank(t *testing.T) {
+	data := []float64{1, 2, 3, 4, 5}
+	if got := exactQuantile(data, 0.5); got != 3 {
+		t.Errorf("exactQuantile(0.5) = %v, wanted 3", got)
+	}
+	if got := exactQuantile(data, 0.125); got != 1.5 {
+		t.Errorf("exactQuantile(0.125) = %v, wanted 1.5", got)
+	}
+	if got := exactQuantile(data, 1); got != 5 {
+		t.Errorf("exactQuantile(1) = %v, wanted 5", got)
+	}
+	if got := rank(data, 3); got != 0.5 {
+		t.Errorf("rank(3) = %v, wanted 0.5", got)
+	}
+	if got := rank(data, 0); got != 0 {
+		t.Errorf("rank(0) = %v, wanted 0", got)
+	}
+}
@@ -0,0 +1,36 @@
+package tdigest
+
+import "errors"
+
+// CompactionPolicy decides whether a centroid may absorb more samples.
+// Every time a sample is added (including when Compress re-adds the
+// existing centroids) the digest asks its policy whether the nearest
+// centroid can take it, so the policy ultimately rules which neighbouring
+// samples end up merged together.
+type CompactionPolicy interface {
+	// Allow reports whether a centroid located at quantile q may grow to
+	// the given weight. limit is the size bound derived from the digest
+	// compression; the default policy allows any weight up to it.
+	Allow(q, weight, limit float64) bool
+}
+
+// CompactionPolicyFunc adapts an ordinary function to a CompactionPolicy.
+type CompactionPolicyFunc func(q, weight, limit float64) bool
+
+// Allow calls f(q, weight, limit).
+func (f CompactionPolicyFunc) Allow(q, weight, limit float64) bool {
+	return f(q, weight, limit)
+}
+
+// WithCompactionPolicy replaces the default size bound with the supplied
+// policy. Policies that refuse merges too eagerly keep more centroids
+// around, which means more frequent compressions and a bigger footprint.
+func WithCompactionPolicy(policy CompactionPolicy) Option {
+	return func(t *TDigest) error {
+		if policy == nil {
+			return errors.New("CompactionPolicy must not be nil")
+		}
+		t.compaction = policy
+		return nil
+	}
+}
@@ -0,0 +1,67 @@
+package tdigest
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestCompactionPolicy(t *testing.T) {
+	calls := 0
+	always := CompactionPolicyFunc(func(q, weight, limit float64) bool {
+		calls++
+		return weight <= limit
+	})
+
+	withDefault := New(100)
+	withPolicy := New(100, WithCompactionPolicy(always))
+
+	for i := 0; i < 10000; i++ {
+		x := rand.Float64()
+		withDefault.Add(x, 1)
+		withPolicy.Add(x, 1)
+	}
+
+	if calls == 0 {
+		t.Errorf("Expected the compaction policy to be consulted")
+	}
+
+	// Compressions shuffle the centroids, so the digests aren't identical,
+	// but they must be just as accurate.
+	assertDifferenceSmallerThan(withPolicy, 0.5, 0.02, t)
+	assertDifferenceSmallerThan(withPolicy, 0.01, 0.005, t)
+	assertDifferenceSmallerThan(withPolicy, 0.99, 0.005, t)
+}
+
+func TestCompactionPolicyPreservesTails(t *testing.T) {
+	preserveTails := CompactionPolicyFunc(func(q, weight, limit float64) bool {
+		return q > 0.05 && q < 0.95 && weight <= limit
+	})
+
+	tdigest := New(100, WithCompactionPolicy(preserveTails))
+	for i := 0; i < 1000; i++ {
+		tdigest.Add(rand.Float64(), 1)
+	}
+
+	if tdigest.summary.Min().count != 1 || tdigest.summary.Max().count != 1 {
+		t.Errorf("Expected tail centroids to hold a single sample. Got min=%v max=%v",
+			tdigest.summary.Min(), tdigest.summary.Max())
+	}
+
+	var tail uint64
+	tdigest.ForEachCentroid(func(mean float64, count uint64) bool {
+		if count != 1 {
+			return false
+		}
+		tail++
+		return true
+	})
+	if tail < 40 {
+		t.Errorf("Expected at least 40 singleton centroids at the lower tail, got %d", tail)
+	}
+}
+
+func TestCompactionPolicyPanic(t *testing.T) {
+	shouldPanic(func() {
+		New(100, WithCompactionPolicy(nil))
+	}, t, "A nil compaction policy should panic!")
+}
@@ -0,0 +1,186 @@
+package tdigest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultQuantileGrid lists the quantiles Compare reports on when it isn't
+// given a grid of its own.
+var DefaultQuantileGrid = []float64{0.5, 0.75, 0.9, 0.95, 0.99, 0.999}
+
+// QuantileReport describes how the quantiles of a candidate digest differ
+// from those of a baseline, in a form ready to be serialized as part of a
+// canary analysis result.
+type QuantileReport struct {
+	BaselineCount  uint64          `json:"baseline_count"`
+	CandidateCount uint64          `json:"candidate_count"`
+	Deltas         []QuantileDelta `json:"deltas"`
+}
+
+// QuantileDelta is the difference between two digests at one quantile.
+type QuantileDelta struct {
+	Quantile  float64 `json:"quantile"`
+	Baseline  float64 `json:"baseline"`
+	Candidate float64 `json:"candidate"`
+
+	// Absolute is Candidate - Baseline.
+	Absolute float64 `json:"absolute"`
+
+	// Relative is Absolute / |Baseline|. It is nil when Baseline is zero,
+	// since the relative change is undefined then.
+	Relative *float64 `json:"relative,omitempty"`
+}
+
+// Compare reports the quantile differences between candidate and baseline
+// at every quantile of grid, or of DefaultQuantileGrid if grid is empty.
+// Both digests must hold samples.
+func Compare(baseline, candidate *TDigest, grid []float64) (QuantileReport, error) {
+	if baseline.count == 0 || candidate.count == 0 {
+		return QuantileReport{}, errors.New("cannot compare empty digests")
+	}
+	if len(grid) == 0 {
+		grid = DefaultQuantileGrid
+	}
+
+	report := QuantileReport{
+		BaselineCount:  baseline.count,
+		CandidateCount: candidate.count,
+		Deltas:         make([]QuantileDelta, 0, len(grid)),
+	}
+
+	for _, q := range grid {
+		if !(q >= 0 && q <= 1) {
+			return QuantileReport{}, fmt.Errorf("quantile %v is not between 0 and 1", q)
+		}
+
+		delta := QuantileDelta{
+			Quantile:  q,
+			Baseline:  baseline.Quantile(q),
+			Candidate: candidate.Quantile(q),
+		}
+		delta.Absolute = delta.Candidate - delta.Baseline
+		if delta.Baseline != 0 {
+			relative := delta.Absolute / math.Abs(delta.Baseline)
+			delta.Relative = &relative
+		}
+
+		report.Deltas = append(report.Deltas, delta)
+	}
+
+	return report, nil
+}
+
+// CoQuantile holds the values of two digests at the same quantile.
+type CoQuantile struct {
+	Quantile float64 `json:"quantile"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+}
+
+// AlignQuantiles returns the values of x and y at every quantile of grid,
+// or of DefaultQuantileGrid if grid is empty, for plotting one quantity
+// against the other, say latency against payload size. Both digests must
+// hold samples.
+//
+// The digests are summarized independently: they don't record which
+// samples were observed together, so nothing is known of how the two
+// quantities relate. The table pairs them as if they ranked the same way
+// (the slowest requests being the largest ones), which is only an
+// assumption. It shows how the two distributions line up, and must not be
+// read as evidence of a correlation.
+func AlignQuantiles(x, y *TDigest, grid []float64) ([]CoQuantile, error) {
+	if x.count == 0 || y.count == 0 {
+		return nil, errors.New("cannot align empty digests")
+	}
+	if len(grid) == 0 {
+		grid = DefaultQuantileGrid
+	}
+
+	xs, err := x.Quantiles(grid)
+	if err != nil {
+		return nil, err
+	}
+	ys, err := y.Quantiles(grid)
+	if err != nil {
+		return nil, err
+	}
+
+	table := make([]CoQuantile, len(grid))
+	for i, q := range grid {
+		table[i] = CoQuantile{Quantile: q, X: xs[i], Y: ys[i]}
+	}
+	return table, nil
+}
+
+// BudgetBreakdown splits the value of a parent digest at some quantile,
+// typically a request latency, among the components it's made of.
+type BudgetBreakdown struct {
+	Quantile float64 `json:"quantile"`
+	Parent   float64 `json:"parent"`
+
+	// Components are sorted by decreasing value.
+	Components []Contribution `json:"components"`
+
+	// Unattributed is what's left of Parent once the values of all the
+	// components are taken out, e.g. time spent in the service itself. It
+	// is negative when the components don't all peak together.
+	Unattributed float64 `json:"unattributed"`
+}
+
+// Contribution is the share of one component in a BudgetBreakdown.
+type Contribution struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+
+	// Share is Value / Parent. It is nil when Parent is zero.
+	Share *float64 `json:"share,omitempty"`
+}
+
+// DecomposeQuantile reports how much each of components contributes to
+// the value of parent at quantile q, for a quick look at where, say, the
+// p99 latency goes. All digests must hold samples.
+//
+// Like AlignQuantiles, it assumes the parent and the components rank the
+// same way: the slowest requests are taken to be slow in every component,
+// so each component contributes its own value at q. That's a heuristic,
+// the digests don't record which samples were observed together.
+func DecomposeQuantile(parent *TDigest, components map[string]*TDigest, q float64) (BudgetBreakdown, error) {
+	if !(q >= 0 && q <= 1) {
+		return BudgetBreakdown{}, fmt.Errorf("quantile %v is not between 0 and 1", q)
+	}
+	if parent.count == 0 {
+		return BudgetBreakdown{}, errors.New("cannot decompose an empty digest")
+	}
+
+	b := BudgetBreakdown{
+		Quantile:   q,
+		Parent:     parent.Quantile(q),
+		Components: make([]Contribution, 0, len(components)),
+	}
+	b.Unattributed = b.Parent
+	for name, d := range components {
+		if d == nil || d.count == 0 {
+			return BudgetBreakdown{}, fmt.Errorf("component %q is empty", name)
+		}
+
+		c := Contribution{Name: name, Value: d.Quantile(q)}
+		if b.Parent != 0 {
+			share := c.Value / b.Parent
+			c.Share = &share
+		}
+		b.Components = append(b.Components, c)
+		b.Unattributed -= c.Value
+	}
+
+	sort.Slice(b.Components, func(i, j int) bool {
+		ci, cj := b.Components[i], b.Components[j]
+		if ci.Value != cj.Value {
+			return ci.Value > cj.Value
+		}
+		return ci.Name < cj.Name
+	})
+	return b, nil
+}
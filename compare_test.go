@@ -0,0 +1,129 @@
+package tdigest
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	baseline := New(100)
+	candidate := New(100)
+	for i := 0; i < 1000; i++ {
+		baseline.Add(float64(i), 1)
+		candidate.Add(float64(i)*1.1, 1)
+	}
+
+	report, err := Compare(baseline, candidate, []float64{0, 0.5, 0.99})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.BaselineCount != 1000 || report.CandidateCount != 1000 || len(report.Deltas) != 3 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+
+	if d := report.Deltas[0]; d.Baseline != 0 || d.Relative != nil {
+		t.Errorf("Relative change from a zero baseline should be undefined. Got %+v", d)
+	}
+
+	for _, d := range report.Deltas[1:] {
+		if d.Absolute != d.Candidate-d.Baseline {
+			t.Errorf("Absolute delta at %.2f is %.4f, wanted %.4f", d.Quantile, d.Absolute, d.Candidate-d.Baseline)
+		}
+		if d.Relative == nil || math.Abs(*d.Relative-0.1) > 0.01 {
+			t.Errorf("Expected a relative change of about 10%% at %.2f. Got %+v", d.Quantile, d)
+		}
+	}
+
+	if _, err := json.Marshal(report); err != nil {
+		t.Errorf("Report should be serializable. Got %v", err)
+	}
+
+	report, err = Compare(baseline, candidate, nil)
+	if err != nil || len(report.Deltas) != len(DefaultQuantileGrid) {
+		t.Errorf("Expected the default grid to be used. Got %v, %v", report, err)
+	}
+
+	if _, err := Compare(baseline, New(100), nil); err == nil {
+		t.Errorf("Expected an error comparing against an empty digest")
+	}
+	if _, err := Compare(baseline, candidate, []float64{1.5}); err == nil {
+		t.Errorf("Expected an error for an invalid quantile")
+	}
+}
+
+func TestAlignQuantiles(t *testing.T) {
+	latency := New(100)
+	size := New(100)
+	for i := 0; i < 1000; i++ {
+		latency.Add(float64(i), 1)
+		size.Add(float64(1000-i)*10, 1)
+	}
+
+	grid := []float64{0.9, 0.1, 0.5}
+	table, err := AlignQuantiles(latency, size, grid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range table {
+		if row.Quantile != grid[i] || row.X != latency.Quantile(grid[i]) || row.Y != size.Quantile(grid[i]) {
+			t.Errorf("Unexpected row %d: %+v", i, row)
+		}
+	}
+
+	table, err = AlignQuantiles(latency, size, nil)
+	if err != nil || len(table) != len(DefaultQuantileGrid) {
+		t.Errorf("Expected the default grid to be used. Got %v, %v", table, err)
+	}
+
+	if _, err := AlignQuantiles(latency, New(100), nil); err == nil {
+		t.Errorf("Expected an error aligning with an empty digest")
+	}
+	if _, err := AlignQuantiles(latency, size, []float64{-1}); err == nil {
+		t.Errorf("Expected an error for an invalid quantile")
+	}
+}
+
+func TestDecomposeQuantile(t *testing.T) {
+	parent, db, cache := New(100), New(100), New(100)
+	for i := 0; i < 1000; i++ {
+		x := float64(i)
+		db.Add(0.6*x, 1)
+		cache.Add(0.1*x, 1)
+		parent.Add(x, 1)
+	}
+
+	b, err := DecomposeQuantile(parent, map[string]*TDigest{"cache": cache, "db": db}, 0.99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Components) != 2 || b.Components[0].Name != "db" || b.Components[1].Name != "cache" {
+		t.Fatalf("Expected components by decreasing value. Got %+v", b.Components)
+	}
+	for _, c := range b.Components {
+		if c.Share == nil || math.Abs(*c.Share-c.Value/b.Parent) > 1e-9 {
+			t.Errorf("Unexpected share for %+v", c)
+		}
+	}
+	if want := b.Parent - b.Components[0].Value - b.Components[1].Value; math.Abs(b.Unattributed-want) > 1e-9 {
+		t.Errorf("Unattributed = %v, wanted %v", b.Unattributed, want)
+	}
+	if math.Abs(*b.Components[0].Share-0.6) > 0.01 || math.Abs(b.Unattributed/b.Parent-0.3) > 0.01 {
+		t.Errorf("Expected the db to take about 60%% and 30%% to be unattributed. Got %+v", b)
+	}
+
+	if _, err := json.Marshal(b); err != nil {
+		t.Errorf("Breakdown should be serializable. Got %v", err)
+	}
+
+	if _, err := DecomposeQuantile(parent, map[string]*TDigest{"db": New(100)}, 0.99); err == nil {
+		t.Errorf("Expected an error for an empty component")
+	}
+	if _, err := DecomposeQuantile(New(100), nil, 0.99); err == nil {
+		t.Errorf("Expected an error for an empty parent")
+	}
+	if _, err := DecomposeQuantile(parent, nil, 2); err == nil {
+		t.Errorf("Expected an error for an invalid quantile")
+	}
+}
@@ -0,0 +1,113 @@
+package tdigest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Transform derives the value a CompositeDigest feeds to one of its
+// digests from an observed value. Transformed values that are NaN are
+// not added, e.g. the logarithm of a negative number.
+type Transform struct {
+	Name string
+	Func func(float64) float64
+
+	// builtin transforms are rebuilt from their name and params when
+	// deserializing a digest.
+	builtin bool
+	params  []float64
+}
+
+// Built-in transforms.
+var (
+	// RawTransform keeps observed values as they are.
+	RawTransform = Transform{Name: "raw", Func: func(x float64) float64 { return x }, builtin: true}
+
+	// LogTransform takes the natural logarithm of observed values.
+	LogTransform = Transform{Name: "log", Func: math.Log, builtin: true}
+)
+
+// ClampTransform limits observed values to [lo, hi].
+func ClampTransform(lo, hi float64) Transform {
+	return Transform{
+		Name:    "clamp",
+		Func:    func(x float64) float64 { return math.Max(lo, math.Min(hi, x)) },
+		builtin: true,
+		params:  []float64{lo, hi},
+	}
+}
+
+// builtinTransform rebuilds the built-in transform with the given name and
+// params, or returns one without a Func if there is none.
+func builtinTransform(name string, params []float64) Transform {
+	switch {
+	case name == RawTransform.Name && len(params) == 0:
+		return RawTransform
+	case name == LogTransform.Name && len(params) == 0:
+		return LogTransform
+	case name == "clamp" && len(params) == 2:
+		return ClampTransform(params[0], params[1])
+	}
+	return Transform{Name: name, params: params}
+}
+
+// CompositeDigest feeds every observed value to several digests, each
+// under its own transform, so a measurement tracked in several ways is
+// only instrumented once.
+type CompositeDigest struct {
+	transforms []Transform
+	digests    []*TDigest
+}
+
+// NewComposite creates a CompositeDigest with one digest per transform,
+// all created with the given compression and options. Transforms must
+// have distinct names.
+func NewComposite(compression float64, transforms []Transform, options ...Option) (*CompositeDigest, error) {
+	if len(transforms) == 0 {
+		return nil, errors.New("at least one transform is required")
+	}
+
+	c := &CompositeDigest{
+		transforms: append([]Transform(nil), transforms...),
+		digests:    make([]*TDigest, len(transforms)),
+	}
+	seen := make(map[string]bool, len(transforms))
+	for i, tr := range transforms {
+		if tr.Func == nil {
+			return nil, fmt.Errorf("transform %q has no function", tr.Name)
+		}
+		if seen[tr.Name] {
+			return nil, fmt.Errorf("duplicate transform %q", tr.Name)
+		}
+		seen[tr.Name] = true
+
+		d, err := newWithOptions(compression, options)
+		if err != nil {
+			return nil, err
+		}
+		d.transform = &c.transforms[i]
+		c.digests[i] = d
+	}
+	return c, nil
+}
+
+// Observe adds value, transformed, to every digest.
+func (c *CompositeDigest) Observe(value float64) {
+	for i, tr := range c.transforms {
+		if x := tr.Func(value); !math.IsNaN(x) {
+			c.digests[i].Add(x, 1)
+		}
+	}
+}
+
+// Digest returns the digest of the transform with the given name, or nil
+// if there is none.
+func (c *CompositeDigest) Digest(name string) *TDigest {
+	for i, tr := range c.transforms {
+		if tr.Name == name {
+			return c.digests[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package tdigest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompositeDigest(t *testing.T) {
+	c, err := NewComposite(100, []Transform{RawTransform, LogTransform, ClampTransform(0, 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, x := range []float64{-1, 1, math.E, 100} {
+		c.Observe(x)
+	}
+
+	if got := c.Digest("raw").Quantile(1); got != 100 {
+		t.Errorf("Expected the raw digest to keep values as is. Got max %v", got)
+	}
+	if got := c.Digest("log").Quantile(1); got != math.Log(100) {
+		t.Errorf("Expected the log digest to hold logarithms. Got max %v", got)
+	}
+	if got := c.Digest("log").count; got != 3 {
+		t.Errorf("Expected the logarithm of -1 to be skipped. Got %d values", got)
+	}
+	if got := c.Digest("clamp").Quantile(0); got != 0 {
+		t.Errorf("Expected the clamp digest to hold clamped values. Got min %v", got)
+	}
+	if c.Digest("sqrt") != nil {
+		t.Errorf("Expected no digest for an unknown transform")
+	}
+
+	for _, transforms := range [][]Transform{nil, {RawTransform, RawTransform}, {{Name: "nil"}}} {
+		if _, err := NewComposite(100, transforms); err == nil {
+			t.Errorf("Expected NewComposite(%v) to fail", transforms)
+		}
+	}
+	if _, err := NewComposite(0, []Transform{RawTransform}); err == nil {
+		t.Errorf("Expected an invalid compression to fail")
+	}
+}
@@ -0,0 +1,188 @@
+package tdigest
+
+import "sync"
+
+// ConcurrentTDigest is a digest safe for concurrent use. Its methods mirror
+// those of TDigest, with writes holding an exclusive lock and queries a
+// shared one, so concurrent queries don't wait for each other. Queries
+// only take the exclusive lock when the digest must change before
+// answering, to settle a background compression, to fold in the samples
+// buffered by WithBufferedAdd or to compress as the QueryCompressionPolicy
+// asks, which must then be safe for concurrent use.
+type ConcurrentTDigest struct {
+	mu sync.RWMutex
+	t  *TDigest
+}
+
+// NewConcurrent creates a ConcurrentTDigest. Arguments are those of New,
+// which it panics like.
+func NewConcurrent(compression float64, options ...Option) *ConcurrentTDigest {
+	return &ConcurrentTDigest{t: New(compression, options...)}
+}
+
+// write runs f with exclusive access to the digest.
+func (c *ConcurrentTDigest) write(f func(t *TDigest)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f(c.t)
+}
+
+// read runs f, which must not modify the digest other than through the
+// query methods, under the shared lock if the digest is ready to be
+// queried, and the exclusive one otherwise.
+func (c *ConcurrentTDigest) read(f func(t *TDigest)) {
+	c.mu.RLock()
+	if c.t.queryReady() {
+		defer c.mu.RUnlock()
+		f(c.t)
+		return
+	}
+	c.mu.RUnlock()
+	c.write(f)
+}
+
+// Add registers a new sample in the digest, see TDigest.Add.
+func (c *ConcurrentTDigest) Add(value float64, count uint64) (err error) {
+	c.write(func(t *TDigest) { err = t.Add(value, count) })
+	return err
+}
+
+// AddWeighted registers a sample with a fractional weight, see
+// TDigest.AddWeighted.
+func (c *ConcurrentTDigest) AddWeighted(value, weight float64) (err error) {
+	c.write(func(t *TDigest) { err = t.AddWeighted(value, weight) })
+	return err
+}
+
+// AddBatch adds every given value with a count of 1 under a single lock,
+// see TDigest.AddBatch.
+func (c *ConcurrentTDigest) AddBatch(values []float64) (err error) {
+	c.write(func(t *TDigest) { err = t.AddBatch(values) })
+	return err
+}
+
+// AddBatchWeighted adds every given value with the count at the same index
+// under a single lock, see TDigest.AddBatchWeighted.
+func (c *ConcurrentTDigest) AddBatchWeighted(values []float64, counts []uint64) (err error) {
+	c.write(func(t *TDigest) { err = t.AddBatchWeighted(values, counts) })
+	return err
+}
+
+// Merge joins other into the digest, see TDigest.Merge. other must not be
+// used concurrently; to merge another ConcurrentTDigest, merge its
+// Snapshot.
+func (c *ConcurrentTDigest) Merge(other *TDigest) (err error) {
+	c.write(func(t *TDigest) { err = t.Merge(other) })
+	return err
+}
+
+// Reset empties the digest, see TDigest.Reset.
+func (c *ConcurrentTDigest) Reset() {
+	c.write(func(t *TDigest) { t.Reset() })
+}
+
+// Compress compresses the digest, see TDigest.Compress.
+func (c *ConcurrentTDigest) Compress() {
+	c.write(func(t *TDigest) { t.Compress() })
+}
+
+// Quantile returns the estimated value at quantile q, see
+// TDigest.Quantile.
+func (c *ConcurrentTDigest) Quantile(q float64) (value float64) {
+	c.read(func(t *TDigest) { value = t.Quantile(q) })
+	return value
+}
+
+// Quantiles returns the estimated values at each of qs, see
+// TDigest.Quantiles.
+func (c *ConcurrentTDigest) Quantiles(qs []float64) (values []float64, err error) {
+	c.read(func(t *TDigest) { values, err = t.Quantiles(qs) })
+	return values, err
+}
+
+// CDF returns the estimated fraction of the samples at or below x, see
+// TDigest.CDF.
+func (c *ConcurrentTDigest) CDF(x float64) (q float64) {
+	c.read(func(t *TDigest) { q = t.CDF(x) })
+	return q
+}
+
+// TrimmedMean returns the estimated mean of the samples between
+// quantiles q1 and q2, see TDigest.TrimmedMean.
+func (c *ConcurrentTDigest) TrimmedMean(q1, q2 float64) (mean float64) {
+	c.read(func(t *TDigest) { mean = t.TrimmedMean(q1, q2) })
+	return mean
+}
+
+// ValueAtRank returns the estimated value of the rank-th smallest sample,
+// see TDigest.ValueAtRank.
+func (c *ConcurrentTDigest) ValueAtRank(rank uint64) (value float64) {
+	c.read(func(t *TDigest) { value = t.ValueAtRank(rank) })
+	return value
+}
+
+// Len returns the number of centroids in the digest.
+func (c *ConcurrentTDigest) Len() (n int) {
+	c.read(func(t *TDigest) { n = t.Len() })
+	return n
+}
+
+// Centroids returns a copy of the centroids of the digest, see
+// TDigest.Centroids.
+func (c *ConcurrentTDigest) Centroids() (centroids []Centroid) {
+	c.read(func(t *TDigest) { centroids = t.Centroids() })
+	return centroids
+}
+
+// ToBytes serializes the digest into b, see TDigest.ToBytes.
+func (c *ConcurrentTDigest) ToBytes(b []byte) []byte {
+	c.read(func(t *TDigest) { b = t.ToBytes(b) })
+	return b
+}
+
+// Snapshot returns a copy of the digest, with the same options, which the
+// caller may then use freely.
+func (c *ConcurrentTDigest) Snapshot() (snapshot *TDigest) {
+	c.read(func(t *TDigest) { snapshot = t.clone() })
+	return snapshot
+}
+
+// Generation returns the generation of the digest, see
+// TDigest.Generation.
+func (c *ConcurrentTDigest) Generation() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.t.Generation()
+}
+
+// Do runs f with exclusive access to the digest, for operations this type
+// doesn't offer. f must not keep t nor call the methods of c.
+func (c *ConcurrentTDigest) Do(f func(t *TDigest)) {
+	c.write(f)
+}
+
+// clone returns a deep copy of t. It doesn't modify t if it is ready to be
+// queried.
+func (t *TDigest) clone() *TDigest {
+	t.settle()
+	c := *t
+	c.summary = &summary{
+		keys:   append([]float64(nil), t.summary.keys...),
+		counts: append([]uint64(nil), t.summary.counts...),
+	}
+	if t.recent != nil {
+		c.recent = make([]int, len(t.recent), cap(t.recent))
+		copy(c.recent, t.recent)
+	}
+	if t.cache != nil {
+		c.cache = &queryCache{ttl: t.cache.ttl}
+	}
+	if t.buffer != nil {
+		c.buffer = newSummary(uint(cap(t.buffer.keys)))
+	}
+	c.metadata = t.metadata.clone()
+	if t.distinct != nil {
+		c.distinct = t.distinct.Clone()
+	}
+	return &c
+}
@@ -0,0 +1,75 @@
+package tdigest
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentTDigest(t *testing.T) {
+	for name, options := range map[string][]Option{
+		"default":                {},
+		"background compression": {WithBackgroundCompression()},
+		"query compression":      {WithQueryCompression(CompressOnQueryAbove(500))},
+	} {
+		c := NewConcurrent(100, options...)
+
+		const writers, samples = 8, 5000
+		var wg sync.WaitGroup
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < samples; i++ {
+					c.Add(float64(i*writers+w), 1)
+				}
+			}(w)
+		}
+		for r := 0; r < 4; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					c.Quantile(0.5)
+					c.CDF(1000)
+					c.Quantiles([]float64{0.1, 0.9})
+					c.Snapshot()
+				}
+			}()
+		}
+		wg.Wait()
+
+		var count uint64
+		c.Do(func(d *TDigest) { count = d.count })
+		if count != writers*samples {
+			t.Errorf("%s: expected %d samples, got %d", name, writers*samples, count)
+		}
+		if got, want := c.Quantile(0.5), float64(writers*samples)/2; math.Abs(got-want) > want*0.01 {
+			t.Errorf("%s: expected a median of about %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestConcurrentSnapshot(t *testing.T) {
+	c := NewConcurrent(100, WithMetadata(Metadata{Unit: "ms"}))
+	c.AddBatch([]float64{1, 2, 3})
+
+	s := c.Snapshot()
+	s.Add(100, 1)
+	s.Metadata().Unit = "s"
+	if c.Len() != 3 || c.Quantile(1) != 3 {
+		t.Errorf("Expected changes to the snapshot not to affect the digest")
+	}
+	c.Do(func(d *TDigest) {
+		if d.Metadata().Unit != "ms" {
+			t.Errorf("Expected the metadata of the digest to be left alone")
+		}
+	})
+
+	if err := c.Merge(s); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 4 || c.Quantile(1) != 100 {
+		t.Errorf("Expected the snapshot to be merged back, got %d centroids", c.Len())
+	}
+}
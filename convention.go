@@ -0,0 +1,81 @@
+package tdigest
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// QuantileConvention selects how quantiles are mapped to ranks within the
+// digest samples when answering queries. Since it has no effect on how
+// samples are stored, digests using different conventions can be merged
+// freely.
+type QuantileConvention int
+
+const (
+	// Midpoint treats the samples as the whole population, with quantile q
+	// at rank q*n (counting each sample as covering half a rank on either
+	// side of it). This is the default.
+	Midpoint QuantileConvention = iota
+
+	// Sample follows the R-7 definition, with quantile q at rank q*(n-1)
+	// among the sorted samples, so the results match numpy's default,
+	// Excel's PERCENTILE.INC and SQL's PERCENTILE_CONT.
+	Sample
+)
+
+// WithQuantileConvention selects the convention used by quantile queries.
+func WithQuantileConvention(convention QuantileConvention) Option {
+	return func(t *TDigest) error {
+		if convention != Midpoint && convention != Sample {
+			return fmt.Errorf("unknown quantile convention: %d", convention)
+		}
+		t.convention = convention
+		return nil
+	}
+}
+
+// quantileRank returns the position, measured in samples from the start
+// of the digest, where quantile q lies, as its whole and fractional parts.
+// The rank is computed exactly rather than in float64, which can't count
+// every sample of digests holding more than 2^53, so that tail quantiles
+// of huge rollups land on the right centroid.
+func (t *TDigest) quantileRank(q float64) (whole uint64, frac float64) {
+	if t.convention == Sample {
+		whole, frac = exactProduct(q, t.count-1)
+		if frac += 0.5; frac >= 1 {
+			whole, frac = whole+1, frac-1
+		}
+		return whole, frac
+	}
+	return exactProduct(q, t.count)
+}
+
+// exactProduct returns q*n, for a q between 0 and 1, as its whole and
+// fractional parts.
+func exactProduct(q float64, n uint64) (uint64, float64) {
+	// q is mant * 2^-shift with a 53 bit mant, so the product takes at
+	// most 117 bits.
+	m, exp := math.Frexp(q)
+	mant := uint64(math.Ldexp(m, 53))
+	shift := uint(53 - exp)
+	if mant == 0 || shift >= 128 {
+		return 0, q * float64(n)
+	}
+
+	hi, lo := bits.Mul64(mant, n)
+	if shift >= 64 {
+		rest := hi & (1<<(shift-64) - 1)
+		return hi >> (shift - 64), math.Ldexp(float64(rest), 64-int(shift)) + math.Ldexp(float64(lo), -int(shift))
+	}
+	return hi<<(64-shift) | lo>>shift, math.Ldexp(float64(lo&(1<<shift-1)), -int(shift))
+}
+
+// rankQuantile is the inverse of quantileRank, clamped to [0, 1].
+func (t *TDigest) rankQuantile(rank float64) float64 {
+	q := rank / float64(t.count)
+	if t.convention == Sample {
+		q = (rank - 0.5) / float64(t.count-1)
+	}
+	return math.Max(0, math.Min(1, q))
+}
@@ -0,0 +1,92 @@
+package tdigest
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestQuantileConvention(t *testing.T) {
+	midpoint := New(100)
+	sample := New(100, WithQuantileConvention(Sample))
+	for _, x := range []float64{1, 2, 3, 4, 5} {
+		midpoint.Add(x, 1)
+		sample.Add(x, 1)
+	}
+
+	// Expected values from numpy.percentile(x, q*100).
+	for q, want := range map[float64]float64{0: 1, 0.25: 2, 0.5: 3, 0.6: 3.4, 0.75: 4, 1: 5} {
+		if got := sample.Quantile(q); got != want {
+			t.Errorf("Sample Quantile(%.2f) = %.4f, wanted %.4f", q, got, want)
+		}
+	}
+
+	for q, want := range map[float64]float64{0.25: 1.75, 0.5: 3, 0.75: 4.25} {
+		if got := midpoint.Quantile(q); got != want {
+			t.Errorf("Midpoint Quantile(%.2f) = %.4f, wanted %.4f", q, got, want)
+		}
+	}
+
+	for _, q := range []float64{0.25, 0.6, 0.75} {
+		if got := sample.CDF(sample.Quantile(q)); math.Abs(got-q) > 1e-9 {
+			t.Errorf("Sample CDF(Quantile(%.2f)) = %.4f, wanted %.4f", q, got, q)
+		}
+	}
+
+	shouldPanic(func() {
+		New(100, WithQuantileConvention(42))
+	}, t, "Unknown conventions should panic!")
+}
+
+func TestExactProduct(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	qs := []float64{0, 1, 0.5, math.SmallestNonzeroFloat64, 1e-300, 1 - 0x1p-53, math.Nextafter(0.999, 1)}
+	ns := []uint64{0, 1, 3, 1 << 53, 1<<53 + 1, 1<<63 + 12345, math.MaxUint64}
+	for i := 0; i < 1000; i++ {
+		qs = append(qs, r.Float64())
+		ns = append(ns, r.Uint64()>>r.Intn(64))
+	}
+
+	for i, q := range qs {
+		n := ns[i%len(ns)]
+		whole, frac := exactProduct(q, n)
+
+		exact := new(big.Float).SetPrec(256).SetFloat64(q)
+		exact.Mul(exact, new(big.Float).SetUint64(n))
+		wantWhole, _ := exact.Uint64()
+		exact.Sub(exact, new(big.Float).SetUint64(wantWhole))
+		wantFrac, _ := exact.Float64()
+
+		if whole != wantWhole || math.Abs(frac-wantFrac) > 1e-15 || frac < 0 || frac >= 1 {
+			t.Errorf("exactProduct(%v, %d) = %d + %v, wanted %d + %v", q, n, whole, frac, wantWhole, wantFrac)
+		}
+	}
+}
+
+func TestHugeRollupTail(t *testing.T) {
+	// A centroid of nearly 2^63 samples followed by 2048 single samples.
+	// A float64 total can't count them one by one, but rank arithmetic
+	// does, for both conventions.
+	means := []float64{0}
+	counts := []uint64{1<<63 - 2048}
+	for i := 1; i <= 2048; i++ {
+		means = append(means, float64(i))
+		counts = append(counts, 1)
+	}
+	for _, convention := range []QuantileConvention{Midpoint, Sample} {
+		d, err := FromCentroids(means, counts, WithQuantileConvention(convention))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The largest quantile below 1 lies 1024 samples before the end.
+		if got := d.Quantile(1 - 0x1p-53); math.Abs(got-1024.5) > 1 {
+			t.Errorf("%v: expected Quantile(1 - 2^-53) around 1024.5, got %v", convention, got)
+		}
+		got, _ := d.Quantiles([]float64{0.5, 1 - 0x1p-53})
+		if got[0] != 0 || math.Abs(got[1]-1024.5) > 1 {
+			t.Errorf("%v: unexpected Quantiles %v", convention, got)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package tdigest
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Samples added at the landmark of a DecayingTDigest weigh decayScale, so
+// that the counts of the digest keep enough precision as weights shrink.
+// The landmark moves forward once new samples weigh decayRenormalizeAt
+// times as much, taking the digest with them, or once the scaled count of
+// the digest would pass decayCountLimit, which leaves room below the
+// uint64 limit.
+const (
+	decayScale         = 1 << 10
+	decayRenormalizeAt = 1 << 20
+	decayCountLimit    = 1 << 62
+)
+
+// DecayingTDigest is a digest where samples lose weight exponentially as
+// they age, halving every half-life, so that a single long-lived digest
+// tracks recent percentiles without the buckets of a WindowedTDigest.
+//
+// It implements forward decay: rather than decaying the whole digest all
+// the time, every sample weighs more than the previous ones the later it
+// is added, which is equivalent since quantiles only depend on relative
+// weights. Weights are rounded stochastically, see AddWeighted. To keep
+// them from overflowing, the digest is periodically renormalized, scaling
+// all counts down; centroids too old to weigh anything anymore are dropped
+// then, and the digest compressed. Like TDigest, it is not safe for
+// concurrent use.
+type DecayingTDigest struct {
+	t        *TDigest
+	lambda   float64 // decay rate, per nanosecond
+	landmark int64   // in nanoseconds since the Unix epoch
+}
+
+// NewDecaying creates a DecayingTDigest whose samples lose half of their
+// weight every halfLife. The compression and options are those of New;
+// WithWeightScale makes rounding finer still, and leaves counts in samples.
+func NewDecaying(halfLife time.Duration, compression float64, options ...Option) (*DecayingTDigest, error) {
+	if halfLife <= 0 {
+		return nil, errors.New("half-life must be positive")
+	}
+	t, err := newWithOptions(compression, options)
+	if err != nil {
+		return nil, err
+	}
+	return &DecayingTDigest{t: t, lambda: math.Ln2 / float64(halfLife), landmark: time.Now().UnixNano()}, nil
+}
+
+// Add registers count samples of value at the current time.
+func (d *DecayingTDigest) Add(value float64, count uint64) error {
+	return d.addAt(time.Now(), value, count)
+}
+
+func (d *DecayingTDigest) addAt(ts time.Time, value float64, count uint64) error {
+	if count == 0 {
+		return d.t.Add(value, count)
+	}
+	now := ts.UnixNano()
+	if math.Exp(d.lambda*float64(now-d.landmark)) > decayRenormalizeAt {
+		d.renormalize(now)
+	}
+	weight := float64(count) * d.scale() * math.Exp(d.lambda*float64(now-d.landmark))
+	for float64(d.t.count)+weight > decayCountLimit {
+		// Many samples over a short time for the half-life weigh too much,
+		// even without growth. Moving the landmark past now scales both
+		// the digest and the new samples down, by decayRenormalizeAt
+		// unless the half-life is so long that it takes years.
+		if d.landmark > math.MaxInt64/2 {
+			return errors.New("decayed counts overflow")
+		}
+		shift := int64(math.Min(math.Log(decayRenormalizeAt)/d.lambda, math.MaxInt64/4))
+		d.renormalize(d.landmark + shift)
+		weight *= math.Exp(-d.lambda * float64(shift))
+	}
+	return d.t.addScaled(value, weight, weight/d.scale())
+}
+
+// scale returns the count of a sample added at the landmark, taking the
+// weight scale of the digest into account, if any.
+func (d *DecayingTDigest) scale() float64 {
+	if d.t.weightScale != 0 {
+		return decayScale * d.t.weightScale
+	}
+	return decayScale
+}
+
+// renormalize moves the landmark to the given time, scaling the counts
+// of the centroids down to match.
+func (d *DecayingTDigest) renormalize(landmark int64) {
+	t := d.t
+	t.settle()
+	t.modified()
+	t.moments.inexact = true
+	factor := math.Exp(-d.lambda * float64(landmark-d.landmark))
+	d.landmark = landmark
+
+	s := t.summary
+	n := 0
+	t.count = 0
+	for i := range s.keys {
+		c := roundStochastically(float64(s.counts[i]) * factor)
+		if c == 0 {
+			continue
+		}
+		s.keys[n] = s.keys[i]
+		s.counts[n] = c
+		t.count += c
+		n++
+	}
+	s.keys = s.keys[:n]
+	s.counts = s.counts[:n]
+
+	// Old centroids now weigh next to nothing, and can be merged further.
+	t.Compress()
+}
+
+// Count returns the decayed number of samples as of now: samples added one
+// half-life ago count for half a sample, and so on.
+func (d *DecayingTDigest) Count() float64 {
+	return d.countAt(time.Now())
+}
+
+func (d *DecayingTDigest) countAt(now time.Time) float64 {
+	return float64(d.t.count) / d.scale() / math.Exp(d.lambda*float64(now.UnixNano()-d.landmark))
+}
+
+// Quantile returns the estimated value at quantile q of the decayed
+// samples, see TDigest.Quantile. Since all samples decay at the same rate,
+// it doesn't depend on when it's asked, only on the samples added so far.
+func (d *DecayingTDigest) Quantile(q float64) float64 {
+	return d.t.Quantile(q)
+}
+
+// Quantiles returns the estimated values at each of qs of the decayed
+// samples, see TDigest.Quantiles.
+func (d *DecayingTDigest) Quantiles(qs []float64) ([]float64, error) {
+	return d.t.Quantiles(qs)
+}
+
+// CDF returns the estimated weighted fraction of the decayed samples at
+// or below x, see TDigest.CDF.
+func (d *DecayingTDigest) CDF(x float64) float64 {
+	return d.t.CDF(x)
+}
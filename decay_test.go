@@ -0,0 +1,130 @@
+package tdigest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDecayingTDigest(t *testing.T) {
+	d, err := NewDecaying(time.Minute, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(0, d.landmark)
+
+	// 1000 samples of 1, then 1000 samples of 2 a half-life later: the
+	// former weigh half as much as the latter.
+	for i := 0; i < 1000; i++ {
+		d.addAt(start, 1, 1)
+		d.addAt(start.Add(time.Minute), 2, 1)
+	}
+	now := start.Add(time.Minute)
+	if c := d.countAt(now); math.Abs(c-1500) > 1 {
+		t.Errorf("Expected a decayed count of 1500, got %v", c)
+	}
+	if cdf := d.CDF(1); math.Abs(cdf-1.0/3) > 0.01 {
+		t.Errorf("Expected a third of the weight at 1, got a CDF of %v", cdf)
+	}
+	if c := d.countAt(now.Add(time.Minute)); math.Abs(c-750) > 1 {
+		t.Errorf("Expected the count to halve after a half-life, got %v", c)
+	}
+}
+
+func TestDecayingTDigestRenormalization(t *testing.T) {
+	d, err := NewDecaying(time.Minute, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(0, d.landmark)
+
+	// A day of samples, a second apart, of values growing with time.
+	var ts time.Time
+	for s := 0; s < 86400; s++ {
+		ts = start.Add(time.Duration(s) * time.Second)
+		if err := d.addAt(ts, float64(s)+rand.Float64(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d.landmark == start.UnixNano() {
+		t.Fatalf("Expected the digest to be renormalized")
+	}
+
+	// Samples of the last minute weigh about 60/ln(2) samples in total.
+	if c, want := d.countAt(ts), 60/math.Ln2; math.Abs(c-want) > want*0.05 {
+		t.Errorf("Expected a decayed count of about %v, got %v", want, c)
+	}
+	// Half the weight is within the last half-life.
+	if q := d.Quantile(0.5); math.Abs(q-(86400-60)) > 10 {
+		t.Errorf("Expected a median about a minute old, got %v", q)
+	}
+	// Samples older than an hour weigh less than 2^-60 and must be gone.
+	if q := d.Quantile(0); q < 86400-3600 {
+		t.Errorf("Expected old centroids to be dropped, got a minimum of %v", q)
+	}
+}
+
+func TestDecayingTDigestLargeCounts(t *testing.T) {
+	d, err := NewDecaying(1000*time.Hour, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(0, d.landmark)
+
+	// Counts that overflow the scaled uint64 counts long before time makes
+	// samples weigh decayRenormalizeAt times as much.
+	const count = 1 << 40
+	var ts time.Time
+	want := 0.0
+	for s := 0; s < 100000; s++ {
+		ts = start.Add(time.Duration(s) * time.Second)
+		if err := d.addAt(ts, float64(s%2), count); err != nil {
+			t.Fatalf("Sample %d: %v", s, err)
+		}
+	}
+	for s := 0; s < 100000; s++ {
+		want += count * math.Pow(2, -float64(ts.Sub(start.Add(time.Duration(s)*time.Second)))/float64(1000*time.Hour))
+	}
+	if c := d.countAt(ts); math.Abs(c-want) > want*0.01 {
+		t.Errorf("Expected a decayed count of about %v, got %v", want, c)
+	}
+	if cdf := d.CDF(0); math.Abs(cdf-0.5) > 0.01 {
+		t.Errorf("Expected half of the weight at 0, got a CDF of %v", cdf)
+	}
+}
+
+func TestDecayingTDigestWeightScale(t *testing.T) {
+	d, err := NewDecaying(1000*time.Hour, 100, WithWeightScale(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(0, d.landmark)
+
+	if err := d.addAt(start, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if c := d.countAt(start); math.Abs(c-1) > 1e-3 {
+		t.Errorf("Expected a decayed count of 1, got %v", c)
+	}
+
+	// The scale must count towards the overflow limit too.
+	const count = 1 << 40
+	for s := 0; s < 10000; s++ {
+		if err := d.addAt(start.Add(time.Duration(s)*time.Second), float64(s%2), count); err != nil {
+			t.Fatalf("Sample %d: %v", s, err)
+		}
+	}
+	if c, want := d.countAt(start), 10000.0*count; math.Abs(c-want) > want*0.01 {
+		t.Errorf("Expected a decayed count of about %v, got %v", want, c)
+	}
+}
+
+func TestNewDecaying(t *testing.T) {
+	if _, err := NewDecaying(0, 100); err == nil {
+		t.Errorf("Expected a zero half-life to be rejected")
+	}
+	if _, err := NewDecaying(time.Minute, 0); err == nil {
+		t.Errorf("Expected a zero compression to be rejected")
+	}
+}
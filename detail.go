@@ -0,0 +1,81 @@
+package tdigest
+
+import "math"
+
+// Centroid is a group of samples summarized by their mean and count.
+type Centroid struct {
+	Mean  float64 `json:"mean"`
+	Count uint64  `json:"count"`
+}
+
+// QuantileDetail explains how a quantile estimate was computed, for when
+// a reported value looks wrong.
+type QuantileDetail struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+
+	// Count is the number of samples of the digest.
+	Count uint64 `json:"count"`
+
+	// Rank is the rank the quantile maps to, between 0 and Count, under
+	// the QuantileConvention of the digest.
+	Rank float64 `json:"rank"`
+
+	// Centroids are the centroid holding Rank, along with its neighbours,
+	// whose means the interpolation is scaled by. Index is the position of the
+	// first of them among all the centroids of the digest.
+	Centroids []Centroid `json:"centroids"`
+	Index     int        `json:"index"`
+
+	// ErrorBound estimates how far the actual sample at Rank may be from
+	// Value: samples of a centroid normally lie between the means of its
+	// neighbours, which the bound covers. It is 0 when Value is the single
+	// sample of its centroid, and +Inf when the centroid is at the edge of
+	// the digest and holds several samples, as nothing bounds them then.
+	ErrorBound float64 `json:"error_bound"`
+}
+
+// QuantileDetail returns the estimated value at quantile q like Quantile
+// does, along with the centroids it was interpolated from and an estimate
+// of its error. It never uses the cache of WithQueryCache. Values of q
+// must be between 0 and 1 (inclusive), will panic otherwise. For an empty
+// digest or a NaN q, Value and ErrorBound are NaN and there are no
+// centroids.
+func (t *TDigest) QuantileDetail(q float64) QuantileDetail {
+	if q < 0 || q > 1 {
+		panic("q must be between 0 and 1 (inclusive)")
+	}
+	t.prepareQuery()
+
+	d := QuantileDetail{Quantile: q, Count: t.count, Value: math.NaN(), Rank: math.NaN(), ErrorBound: math.NaN()}
+	s := t.summary
+	if s.Len() == 0 || math.IsNaN(q) {
+		return d
+	}
+
+	whole, frac := t.quantileRank(q)
+	d.Rank = float64(whole) + frac
+	i, total := s.locate(0, 0, whole)
+	if s.Len() == 1 {
+		d.Value = s.keys[0]
+	} else {
+		d.Value = s.valueAt(i, float64(whole-total)+frac)
+	}
+	i = min(i, s.Len()-1)
+
+	lo, hi := max(i-1, 0), min(i+1, s.Len()-1)
+	d.Index = lo
+	for j := lo; j <= hi; j++ {
+		d.Centroids = append(d.Centroids, Centroid{Mean: s.keys[j], Count: s.counts[j]})
+	}
+
+	switch {
+	case s.counts[i] == 1 && d.Value == s.keys[i]:
+		d.ErrorBound = 0
+	case (i == 0 || i == s.Len()-1) && s.counts[i] > 1:
+		d.ErrorBound = math.Inf(1)
+	default:
+		d.ErrorBound = math.Max(d.Value-s.keys[lo], s.keys[hi]-d.Value)
+	}
+	return d
+}
@@ -0,0 +1,63 @@
+package tdigest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuantileDetail(t *testing.T) {
+	tdigest := New(100)
+	for i := 0; i < 10000; i++ {
+		tdigest.Add(float64(i), 1)
+	}
+
+	for _, q := range []float64{0, 0.01, 0.5, 0.99, 1} {
+		d := tdigest.QuantileDetail(q)
+		if d.Value != tdigest.Quantile(q) || d.Quantile != q || d.Count != 10000 {
+			t.Errorf("q=%v: expected the detail to match Quantile, got %+v", q, d)
+		}
+		if math.Abs(d.Rank-q*10000) > 1e-9 {
+			t.Errorf("q=%v: expected a rank of %v, got %v", q, q*10000, d.Rank)
+		}
+		if len(d.Centroids) < 2 || len(d.Centroids) > 3 {
+			t.Errorf("q=%v: expected the centroid and its neighbours, got %+v", q, d.Centroids)
+		}
+		// Quantile interpolates within a quarter of the distance between the
+		// neighbours of the centroid holding the rank, which may reach past
+		// the mean of the closer one.
+		if lo, hi := d.Centroids[0].Mean, d.Centroids[len(d.Centroids)-1].Mean; len(d.Centroids) == 3 &&
+			math.Abs(d.Value-d.Centroids[1].Mean) > (hi-lo)/4+1e-9 {
+			t.Errorf("q=%v: expected %v to lie within %v of %v", q, d.Value, (hi-lo)/4, d.Centroids[1].Mean)
+		}
+		if mean, _ := tdigest.Summary().At(d.Index); mean != d.Centroids[0].Mean {
+			t.Errorf("q=%v: expected the centroids to start at index %d", q, d.Index)
+		}
+
+		// The bound covers the actual sample at the rank.
+		actual := math.Min(math.Floor(d.Rank), 9999)
+		if math.Abs(actual-d.Value) > d.ErrorBound {
+			t.Errorf("q=%v: expected %v to be within %v of %v", q, actual, d.ErrorBound, d.Value)
+		}
+	}
+
+	// Extreme samples sit in centroids of their own, and are exact.
+	if d := tdigest.QuantileDetail(0); d.ErrorBound != 0 || d.Value != 0 {
+		t.Errorf("Expected the minimum to be exact, got %+v", d)
+	}
+}
+
+func TestQuantileDetailEdgeCases(t *testing.T) {
+	if d := New(100).QuantileDetail(0.5); !math.IsNaN(d.Value) || d.Centroids != nil {
+		t.Errorf("Expected nothing for an empty digest, got %+v", d)
+	}
+
+	tdigest := New(100)
+	tdigest.Add(5, 3)
+	d := tdigest.QuantileDetail(0.5)
+	if d.Value != 5 || !math.IsInf(d.ErrorBound, 1) || len(d.Centroids) != 1 {
+		t.Errorf("Expected an unbounded error for a single centroid of several samples, got %+v", d)
+	}
+	if d := tdigest.QuantileDetail(math.NaN()); !math.IsNaN(d.Value) {
+		t.Errorf("Expected NaN for a NaN quantile, got %+v", d)
+	}
+}
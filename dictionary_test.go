@@ -0,0 +1,88 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// endpointDigest simulates the latency digest of one of many endpoints of
+// a service, in whole milliseconds.
+func endpointDigest(r *rand.Rand) *TDigest {
+	d := New(100)
+	scale := 20 + 10*r.Float64()
+	for i := 0; i < 500; i++ {
+		d.Add(float64(int(r.ExpFloat64()*scale)), 1)
+	}
+	return d
+}
+
+func TestDictionaryCodec(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	samples := make([]*TDigest, 200)
+	for i := range samples {
+		samples[i] = endpointDigest(r)
+	}
+	dict := TrainDictionary(samples, 4096)
+	if len(dict) == 0 || len(dict) > 4096 {
+		t.Fatalf("Expected a dictionary of at most 4096 bytes, got %d", len(dict))
+	}
+
+	c, err := NewDictionaryCodec(dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var withDict, plain int
+	for i := 0; i < 100; i++ {
+		d := endpointDigest(r)
+		buf, err := c.Encode(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Decode(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.ToBytes(nil), d.ToBytes(nil)) {
+			t.Fatalf("Expected digest %d to survive a round trip", i)
+		}
+
+		var compressed bytes.Buffer
+		w, _ := flate.NewWriter(&compressed, flate.BestCompression)
+		w.Write(d.ToBytes(nil))
+		w.Close()
+		withDict += len(buf)
+		plain += compressed.Len()
+	}
+	if withDict >= plain*9/10 {
+		t.Errorf("Expected the dictionary to save at least 10%% over plain compression: %d vs %d bytes", withDict, plain)
+	}
+
+	other, _ := NewDictionaryCodec([]byte("another dictionary"))
+	buf, _ := c.Encode(samples[0])
+	if d, err := other.Decode(buf); err == nil && bytes.Equal(d.ToBytes(nil), samples[0].ToBytes(nil)) {
+		t.Errorf("Expected decoding with another dictionary to fail")
+	}
+	if _, err := NewDictionaryCodec(nil); err == nil {
+		t.Errorf("Expected an empty dictionary to be rejected")
+	}
+}
+
+func TestDictionaryCodecBomb(t *testing.T) {
+	dict := []byte("a dictionary")
+	c, _ := NewDictionaryCodec(dict)
+	var bomb bytes.Buffer
+	w, _ := flate.NewWriterDict(&bomb, flate.BestCompression, dict)
+	w.Write(make([]byte, dictionaryMaxDecoded+1))
+	w.Close()
+	_, err := c.Decode(bomb.Bytes())
+	if !errors.Is(err, ErrCorrupt) || !strings.Contains(err.Error(), "more than") {
+		t.Errorf("Expected an input inflating past the limit to be cut short, got %v", err)
+	}
+}
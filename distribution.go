@@ -0,0 +1,72 @@
+package tdigest
+
+import "math/rand"
+
+// Distribution presents a FrozenDigest as a univariate distribution, with
+// the method set of the distributions of gonum.org/v1/gonum/stat/distuv,
+// so that code written against its Quantiler, CDF or Rander interfaces can
+// run on empirical data:
+//
+//	var q interface{ Quantile(p float64) float64 } = tdigest.Distribution{Digest: d.Freeze()}
+//
+// This package doesn't depend on gonum, but Go interfaces don't need it
+// to. Like the FrozenDigest, a Distribution is safe for concurrent use
+// when Src is nil. A *rand.Rand isn't safe for concurrent use, so a
+// Distribution with a Src must not be shared across goroutines unless the
+// caller synchronizes access to it.
+type Distribution struct {
+	Digest *FrozenDigest
+
+	// Src is the source of randomness of Rand, or nil for the global one
+	// of math/rand.
+	Src *rand.Rand
+}
+
+// Quantile returns the estimated value at quantile p, which must be
+// between 0 and 1 (inclusive).
+func (d Distribution) Quantile(p float64) float64 {
+	return d.Digest.Quantile(p)
+}
+
+// CDF returns the estimated probability of a sample at or below x.
+func (d Distribution) CDF(x float64) float64 {
+	return d.Digest.CDF(x)
+}
+
+// Survival returns the estimated probability of a sample above x.
+func (d Distribution) Survival(x float64) float64 {
+	return 1 - d.Digest.CDF(x)
+}
+
+// Mean returns the mean of the samples of the digest.
+func (d Distribution) Mean() float64 {
+	return d.Digest.Mean()
+}
+
+// Median returns the estimated median of the samples of the digest.
+func (d Distribution) Median() float64 {
+	return d.Digest.Quantile(0.5)
+}
+
+// Variance returns the population variance of the samples of the digest.
+func (d Distribution) Variance() float64 {
+	return d.Digest.Variance()
+}
+
+// StdDev returns the population standard deviation of the samples of the
+// digest.
+func (d Distribution) StdDev() float64 {
+	return d.Digest.StdDev()
+}
+
+// Rand returns a random sample drawn from the distribution, by inverse
+// transform sampling.
+func (d Distribution) Rand() float64 {
+	var p float64
+	if d.Src != nil {
+		p = d.Src.Float64()
+	} else {
+		p = rand.Float64()
+	}
+	return d.Digest.Quantile(p)
+}
@@ -0,0 +1,55 @@
+package tdigest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// The interfaces of gonum.org/v1/gonum/stat/distuv.
+type (
+	quantiler interface{ Quantile(p float64) float64 }
+	rander    interface{ Rand() float64 }
+	cdfer     interface {
+		CDF(x float64) float64
+		Survival(x float64) float64
+	}
+)
+
+var (
+	_ quantiler = Distribution{}
+	_ rander    = Distribution{}
+	_ cdfer     = Distribution{}
+)
+
+func TestDistribution(t *testing.T) {
+	tdigest := New(100)
+	for i := 0; i < 10000; i++ {
+		tdigest.Add(rand.NormFloat64()*2+10, 1)
+	}
+	d := Distribution{Digest: tdigest.Freeze(), Src: rand.New(rand.NewSource(1))}
+
+	if got := d.Median(); math.Abs(got-10) > 0.2 {
+		t.Errorf("Expected a median of about 10, got %v", got)
+	}
+	if got := d.StdDev(); math.Abs(got-2) > 0.1 {
+		t.Errorf("Expected a standard deviation of about 2, got %v", got)
+	}
+	if got := d.CDF(10) + d.Survival(10); got != 1 {
+		t.Errorf("Expected CDF and Survival to add up to 1, got %v", got)
+	}
+	if d.Quantile(0.5) != d.Median() || d.Mean() != tdigest.Mean() || d.Variance() != tdigest.Variance() {
+		t.Errorf("Expected the distribution to answer like the digest")
+	}
+
+	var sum float64
+	for i := 0; i < 10000; i++ {
+		sum += d.Rand()
+	}
+	if mean := sum / 10000; math.Abs(mean-10) > 0.2 {
+		t.Errorf("Expected random samples of mean about 10, got %v", mean)
+	}
+	if (Distribution{Digest: d.Digest}).Rand() == 0 {
+		t.Errorf("Expected the global source to be used without Src")
+	}
+}
@@ -0,0 +1,59 @@
+package tdigest
+
+import (
+	"math"
+	"time"
+)
+
+// DurationUnit is the metadata unit of the digests behind DurationDigest,
+// which hold nanoseconds.
+const DurationUnit = "ns"
+
+// DurationDigest is a digest of time.Duration values. It spares callers
+// the conversions to and from float64, and the unit mixups that come with
+// them: values are always kept in nanoseconds, and the underlying digest
+// is tagged with DurationUnit so that merging it with a digest of another
+// unit fails.
+type DurationDigest struct {
+	digest *TDigest
+}
+
+// NewDurationDigest creates an empty DurationDigest. The compression and
+// options are the same as for New, which panics on invalid ones.
+func NewDurationDigest(compression float64, options ...Option) *DurationDigest {
+	t := New(compression, options...)
+	if t.metadata == nil {
+		t.metadata = &Metadata{}
+	}
+	if t.metadata.Unit == "" {
+		t.metadata.Unit = DurationUnit
+	}
+	return &DurationDigest{digest: t}
+}
+
+// Observe adds a duration to the digest.
+func (d *DurationDigest) Observe(value time.Duration) {
+	d.digest.Add(float64(value), 1)
+}
+
+// QuantileDuration returns the duration at quantile q, rounded to the
+// nearest nanosecond. See TDigest.Quantile.
+func (d *DurationDigest) QuantileDuration(q float64) time.Duration {
+	return time.Duration(math.Round(d.digest.Quantile(q)))
+}
+
+// Count returns the number of observed durations.
+func (d *DurationDigest) Count() uint64 {
+	return d.digest.count
+}
+
+// Merge merges other into d. See TDigest.Merge.
+func (d *DurationDigest) Merge(other *DurationDigest) error {
+	return d.digest.Merge(other.digest)
+}
+
+// Digest returns the underlying digest, whose values are nanoseconds. It
+// can be used to serialize d, or to merge it with plain digests.
+func (d *DurationDigest) Digest() *TDigest {
+	return d.digest
+}
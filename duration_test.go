@@ -0,0 +1,41 @@
+package tdigest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationDigest(t *testing.T) {
+	d := NewDurationDigest(100)
+	for i := 1; i <= 1000; i++ {
+		d.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	if d.Count() != 1000 {
+		t.Errorf("Expected 1000 durations, got %d", d.Count())
+	}
+	if got := d.QuantileDuration(0.5); got < 490*time.Millisecond || got > 510*time.Millisecond {
+		t.Errorf("QuantileDuration(0.5) = %v, wanted about 500ms", got)
+	}
+	if got := d.QuantileDuration(1); got != time.Second {
+		t.Errorf("QuantileDuration(1) = %v, wanted 1s", got)
+	}
+	if unit := d.Digest().Metadata().Unit; unit != DurationUnit {
+		t.Errorf("Expected the digest to be tagged with unit %q, got %q", DurationUnit, unit)
+	}
+
+	other := NewDurationDigest(100)
+	other.Observe(2 * time.Second)
+	if err := d.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.QuantileDuration(1); got != 2*time.Second {
+		t.Errorf("QuantileDuration(1) = %v after merge, wanted 2s", got)
+	}
+
+	ms := New(100, WithMetadata(Metadata{Unit: "ms"}))
+	ms.Add(1, 1)
+	if err := d.Digest().Merge(ms); err == nil {
+		t.Errorf("Expected merging milliseconds into a DurationDigest to fail")
+	}
+}
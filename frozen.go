@@ -0,0 +1,197 @@
+package tdigest
+
+import (
+	"iter"
+	"math"
+	"sort"
+)
+
+// FrozenDigest is an immutable copy of a digest, made by Freeze. It holds
+// the centroids of the digest in slices of exactly their size, along with
+// their running totals so that quantiles take a binary search rather than
+// a walk over the centroids. Its methods never modify it, so it can be
+// shared by any number of goroutines without synchronization, which makes
+// it the type to hand over to exporters.
+type FrozenDigest struct {
+	// d is never modified, nor queried in ways which could modify it.
+	d *TDigest
+
+	// ends holds the total count of the centroids up to each of them,
+	// inclusive.
+	ends []uint64
+}
+
+// Freeze returns a FrozenDigest holding the current contents of t, which
+// remains usable. Answers are those t would give until it changes, except
+// that the frozen copy never compresses itself (see WithQueryCompression).
+func (t *TDigest) Freeze() *FrozenDigest {
+	d := t.clone()
+	d.summary = &summary{
+		keys:   append(make([]float64, 0, t.summary.Len()), t.summary.keys...),
+		counts: append(make([]uint64, 0, t.summary.Len()), t.summary.counts...),
+	}
+	d.recent = nil
+	d.buffer = nil
+	d.cache = nil
+	d.queryCompression = nil
+	d.background = false
+
+	f := &FrozenDigest{d: d, ends: make([]uint64, d.summary.Len())}
+	var total uint64
+	for i, c := range d.summary.counts {
+		total += c
+		f.ends[i] = total
+	}
+	return f
+}
+
+// Freeze returns a FrozenDigest holding the current contents of the
+// digest, see TDigest.Freeze.
+func (c *ConcurrentTDigest) Freeze() (frozen *FrozenDigest) {
+	c.read(func(t *TDigest) { frozen = t.Freeze() })
+	return frozen
+}
+
+// locate is summary.locate using the running totals.
+func (f *FrozenDigest) locate(whole uint64) (int, uint64) {
+	i := sort.Search(len(f.ends), func(i int) bool { return f.ends[i] > whole })
+	if i == 0 {
+		return 0, 0
+	}
+	return i, f.ends[i-1]
+}
+
+// Quantile returns the estimated value at quantile q, see
+// TDigest.Quantile.
+func (f *FrozenDigest) Quantile(q float64) float64 {
+	if q < 0 || q > 1 {
+		panic("q must be between 0 and 1 (inclusive)")
+	}
+	s := f.d.summary
+	switch {
+	case math.IsNaN(q) || s.Len() == 0:
+		return math.NaN()
+	case s.Len() == 1:
+		return s.keys[0]
+	}
+
+	whole, frac := f.d.quantileRank(q)
+	i, total := f.locate(whole)
+	return s.valueAt(i, float64(whole-total)+frac)
+}
+
+// Quantiles returns the estimated values at each of qs, see
+// TDigest.Quantiles.
+func (f *FrozenDigest) Quantiles(qs []float64) ([]float64, error) {
+	return f.d.Quantiles(qs)
+}
+
+// ValueAtRank returns the estimated value of the sample of the given
+// rank, see TDigest.ValueAtRank.
+func (f *FrozenDigest) ValueAtRank(rank uint64) float64 {
+	s := f.d.summary
+	switch {
+	case s.Len() == 0:
+		return math.NaN()
+	case s.Len() == 1:
+		return s.keys[0]
+	}
+	rank = max(1, min(rank, f.d.count))
+
+	i, total := f.locate(rank - 1)
+	return s.valueAt(i, float64(rank-1-total)+0.5)
+}
+
+// CDF returns the estimated fraction of the samples at or below x, see
+// TDigest.CDF.
+func (f *FrozenDigest) CDF(x float64) float64 {
+	return f.d.CDF(x)
+}
+
+// TrimmedMean returns the mean of the samples between quantiles q1 and
+// q2, see TDigest.TrimmedMean.
+func (f *FrozenDigest) TrimmedMean(q1, q2 float64) float64 {
+	return f.d.TrimmedMean(q1, q2)
+}
+
+// Sum returns the sum of the samples of the digest, see TDigest.Sum.
+func (f *FrozenDigest) Sum() float64 {
+	return f.d.Sum()
+}
+
+// Mean returns the mean of the samples of the digest, see TDigest.Mean.
+func (f *FrozenDigest) Mean() float64 {
+	return f.d.Mean()
+}
+
+// Variance returns the population variance of the samples of the digest,
+// see TDigest.Variance.
+func (f *FrozenDigest) Variance() float64 {
+	return f.d.Variance()
+}
+
+// StdDev returns the population standard deviation of the samples of the
+// digest, see TDigest.StdDev.
+func (f *FrozenDigest) StdDev() float64 {
+	return f.d.StdDev()
+}
+
+// Min returns the smallest sample of the digest, see TDigest.Min.
+func (f *FrozenDigest) Min() float64 {
+	return f.d.Min()
+}
+
+// Max returns the largest sample of the digest, see TDigest.Max.
+func (f *FrozenDigest) Max() float64 {
+	return f.d.Max()
+}
+
+// Count returns the number of samples of the digest.
+func (f *FrozenDigest) Count() uint64 {
+	return f.d.count
+}
+
+// Len returns the number of centroids of the digest.
+func (f *FrozenDigest) Len() int {
+	return f.d.summary.Len()
+}
+
+// Compression returns the compression of the digest.
+func (f *FrozenDigest) Compression() float64 {
+	return f.d.compression
+}
+
+// Metadata returns a copy of the metadata of the digest, or nil if it has
+// none.
+func (f *FrozenDigest) Metadata() *Metadata {
+	return f.d.Metadata()
+}
+
+// ForEachCentroid calls f for every centroid in ascending order of mean,
+// until it returns false, see TDigest.ForEachCentroid.
+func (f *FrozenDigest) ForEachCentroid(fn func(mean float64, count uint64) bool) {
+	f.d.ForEachCentroid(fn)
+}
+
+// Centroids returns a copy of the centroids of the digest, see
+// TDigest.Centroids.
+func (f *FrozenDigest) Centroids() []Centroid {
+	return f.d.Centroids()
+}
+
+// All returns an iterator over the centroids of the digest, see
+// TDigest.All.
+func (f *FrozenDigest) All() iter.Seq2[int, Centroid] {
+	return f.d.All()
+}
+
+// ToBytes serializes the digest into b, see TDigest.ToBytes.
+func (f *FrozenDigest) ToBytes(b []byte) []byte {
+	return f.d.ToBytes(b)
+}
+
+// Digest returns a new, mutable digest with the contents and options of
+// the frozen one.
+func (f *FrozenDigest) Digest() *TDigest {
+	return f.d.clone()
+}
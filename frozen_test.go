@@ -0,0 +1,94 @@
+package tdigest
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestFreeze(t *testing.T) {
+	tdigest := New(100, WithMetadata(Metadata{Unit: "ms"}))
+	for i := 0; i < 10000; i++ {
+		tdigest.Add(rand.ExpFloat64(), uint64(1+rand.Intn(3)))
+	}
+	f := tdigest.Freeze()
+
+	for i := 0; i <= 1000; i++ {
+		q := float64(i) / 1000
+		if got, want := f.Quantile(q), tdigest.Quantile(q); !sameFloat(got, want) {
+			t.Fatalf("Quantile(%v): expected %v, got %v", q, want, got)
+		}
+	}
+	for _, rank := range []uint64{0, 1, 2, 100, f.Count() / 2, f.Count() - 1, f.Count(), f.Count() + 1} {
+		if got, want := f.ValueAtRank(rank), tdigest.ValueAtRank(rank); !sameFloat(got, want) {
+			t.Errorf("ValueAtRank(%d): expected %v, got %v", rank, want, got)
+		}
+	}
+	if f.Count() != tdigest.count || f.Len() != tdigest.Len() || f.CDF(1) != tdigest.CDF(1) {
+		t.Errorf("Expected the frozen digest to match the original")
+	}
+	if cap(f.d.summary.keys) != f.Len() {
+		t.Errorf("Expected the centroids to be trimmed to %d, got a capacity of %d", f.Len(), cap(f.d.summary.keys))
+	}
+	if !bytes.Equal(f.ToBytes(nil), tdigest.ToBytes(nil)) {
+		t.Errorf("Expected the frozen digest to serialize like the original")
+	}
+
+	before := f.Quantile(0.99)
+	tdigest.Add(1e9, 100000)
+	if f.Quantile(0.99) != before || f.Metadata().Unit != "ms" {
+		t.Errorf("Expected the frozen digest not to change with the original")
+	}
+	d := f.Digest()
+	d.Add(-1, 1)
+	if f.Quantile(0) == -1 {
+		t.Errorf("Expected thawed digests not to share the centroids of the frozen one")
+	}
+}
+
+func TestFreezeEdgeCases(t *testing.T) {
+	f := New(100).Freeze()
+	if !sameFloat(f.Quantile(0.5), math.NaN()) || !sameFloat(f.ValueAtRank(1), math.NaN()) {
+		t.Errorf("Expected an empty frozen digest to answer NaN")
+	}
+
+	tdigest := New(100, WithQueryCompression(AlwaysCompressOnQuery), WithBufferedAdd(10))
+	tdigest.Add(1, 1)
+	f = tdigest.Freeze()
+	if f.Quantile(0.5) != 1 || f.ValueAtRank(1) != 1 || !sameFloat(f.Quantile(math.NaN()), math.NaN()) {
+		t.Errorf("Expected a single-centroid frozen digest to answer its mean")
+	}
+	if f.d.queryCompression != nil || f.d.buffer != nil {
+		t.Errorf("Expected the options modifying digests on queries to be dropped")
+	}
+}
+
+func TestFreezeConcurrent(t *testing.T) {
+	c := NewConcurrent(100)
+	for i := 0; i < 10000; i++ {
+		c.Add(rand.Float64(), 1)
+	}
+	f := c.Freeze()
+	want := f.Quantile(0.5)
+
+	var wg sync.WaitGroup
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if f.Quantile(0.5) != want {
+					t.Errorf("Expected concurrent queries to agree")
+					return
+				}
+				f.CDF(0.5)
+				f.Quantiles([]float64{0.1, 0.9})
+				f.TrimmedMean(0.1, 0.9)
+				f.ToBytes(nil)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,16 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+// GobEncode implements gob.GobEncoder, so that digests can be sent over
+// net/rpc or stored by gob based persistence despite having no exported
+// fields. The encoding is that of ToBytes.
+func (t *TDigest) GobEncode() ([]byte, error) {
+	return t.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder, deserializing data as the FromBytes
+// method does.
+func (t *TDigest) GobDecode(data []byte) error {
+	return t.UnmarshalBinary(data)
+}
@@ -0,0 +1,38 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+func TestGob(t *testing.T) {
+	d := New(100)
+	for i := 0; i < 1000; i++ {
+		d.Add(float64(i), 1)
+	}
+
+	// As net/rpc would send it, by value
+	type reply struct {
+		Digest TDigest
+		Others []*TDigest
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&reply{Digest: *d, Others: []*TDigest{d, New(10)}}); err != nil {
+		t.Fatal(err)
+	}
+	var got reply
+	if err := gob.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := d.ToBytes(nil)
+	if !bytes.Equal(got.Digest.ToBytes(nil), want) || !bytes.Equal(got.Others[0].ToBytes(nil), want) {
+		t.Errorf("Expected digests to survive a gob stream")
+	}
+	if got.Others[1].compression != 10 || got.Others[1].Len() != 0 {
+		t.Errorf("Expected an empty digest to survive a gob stream, got %+v", got.Others[1])
+	}
+}
@@ -0,0 +1,37 @@
+package tdigest
+
+import "math"
+
+// Histogram distributes the samples of the digest into the buckets
+// delimited by boundaries, for systems that only accept pre-bucketed
+// histograms. Bucket i counts the samples in (boundaries[i-1],
+// boundaries[i]], the first one those at or below boundaries[0] and the
+// last one, at index len(boundaries), those above every boundary, so that
+// there is one more bucket than boundaries. Centroids straddling a
+// boundary are split between buckets by interpolating the same way CDF
+// does, and counts are rounded so that they add up to the samples of the
+// digest. Boundaries must be increasing and not NaN, will panic otherwise.
+// The digest may be compressed first, see WithQueryCompression.
+func (t *TDigest) Histogram(boundaries []float64) []uint64 {
+	for i, b := range boundaries {
+		if math.IsNaN(b) || (i > 0 && b <= boundaries[i-1]) {
+			panic("boundaries must be increasing")
+		}
+	}
+	t.prepareQuery()
+
+	counts := make([]uint64, len(boundaries)+1)
+	if t.summary.Len() == 0 {
+		return counts
+	}
+	var below uint64
+	for i, b := range boundaries {
+		// Ranks, unlike fractions, don't depend on the QuantileConvention.
+		rank := uint64(math.Round(t.cdfRank(b)))
+		rank = max(below, min(rank, t.count))
+		counts[i] = rank - below
+		below = rank
+	}
+	counts[len(boundaries)] = t.count - below
+	return counts
+}
@@ -0,0 +1,54 @@
+package tdigest
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	tdigest := New(100)
+	for i := 0; i < 10000; i++ {
+		tdigest.Add(float64(i%100), 1)
+	}
+
+	boundaries := []float64{-1, 9.5, 49.5, 89.5, 200}
+	counts := tdigest.Histogram(boundaries)
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	if len(counts) != 6 || total != 10000 {
+		t.Fatalf("Expected 6 buckets of 10000 samples, got %v", counts)
+	}
+	for i, want := range []float64{0, 1000, 4000, 4000, 1000, 0} {
+		if math.Abs(float64(counts[i])-want) > 50 {
+			t.Errorf("Bucket %d: expected about %v samples, got %d", i, want, counts[i])
+		}
+	}
+
+	// Counts follow CDF, whatever the convention.
+	for _, convention := range []QuantileConvention{Midpoint, Sample} {
+		d := New(100, WithQuantileConvention(convention))
+		for i := 0; i < 1000; i++ {
+			d.Add(float64(i), 1)
+		}
+		if c := d.Histogram([]float64{499.5}); math.Abs(float64(c[0])-500) > 5 || c[0]+c[1] != 1000 {
+			t.Errorf("%v: expected about 500 samples on each side, got %v", convention, c)
+		}
+	}
+
+	if c := New(10).Histogram([]float64{1, 2}); !reflect.DeepEqual(c, []uint64{0, 0, 0}) {
+		t.Errorf("Expected empty buckets for an empty digest, got %v", c)
+	}
+	if c := tdigest.Histogram(nil); !reflect.DeepEqual(c, []uint64{10000}) {
+		t.Errorf("Expected a single bucket without boundaries, got %v", c)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic for decreasing boundaries")
+		}
+	}()
+	tdigest.Histogram([]float64{2, 1})
+}
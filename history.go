@@ -0,0 +1,96 @@
+package tdigest
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// QuantileHistory keeps the values of a few quantiles over the last
+// digests it was given, typically one per closed time window, so that
+// sparklines and alerts can read recent history without querying every
+// old digest again. Once full, every new record replaces the oldest one.
+type QuantileHistory struct {
+	quantiles []float64
+	times     []int64
+	values    []float64 // len(times) rows of len(quantiles) values
+	next      int
+	n         int
+}
+
+// NewQuantileHistory creates a QuantileHistory remembering size records
+// of the given quantiles.
+func NewQuantileHistory(size int, quantiles ...float64) (*QuantileHistory, error) {
+	if size < 1 {
+		return nil, errors.New("history size must be >= 1")
+	}
+	if len(quantiles) == 0 {
+		return nil, errors.New("at least one quantile is required")
+	}
+	for _, q := range quantiles {
+		if !(q >= 0 && q <= 1) {
+			return nil, fmt.Errorf("quantile %v is not between 0 and 1", q)
+		}
+	}
+
+	return &QuantileHistory{
+		quantiles: append([]float64(nil), quantiles...),
+		times:     make([]int64, size),
+		values:    make([]float64, size*len(quantiles)),
+	}, nil
+}
+
+// Record computes the tracked quantiles of d and remembers them as the
+// values at time ts.
+func (h *QuantileHistory) Record(ts time.Time, d *TDigest) {
+	row := h.values[h.next*len(h.quantiles):][:len(h.quantiles)]
+	for i, q := range h.quantiles {
+		row[i] = d.Quantile(q)
+	}
+	h.times[h.next] = ts.UnixNano()
+
+	h.next = (h.next + 1) % len(h.times)
+	if h.n < len(h.times) {
+		h.n++
+	}
+}
+
+// Len returns the number of records in the history.
+func (h *QuantileHistory) Len() int {
+	return h.n
+}
+
+// Times returns the times of the records, from the oldest to the newest.
+func (h *QuantileHistory) Times() []time.Time {
+	result := make([]time.Time, 0, h.n)
+	for i := 0; i < h.n; i++ {
+		result = append(result, time.Unix(0, h.times[h.index(i)]).UTC())
+	}
+	return result
+}
+
+// Values returns the recorded values of quantile q, from the oldest to
+// the newest, or nil if q isn't tracked.
+func (h *QuantileHistory) Values(q float64) []float64 {
+	col := -1
+	for i, tracked := range h.quantiles {
+		if tracked == q {
+			col = i
+			break
+		}
+	}
+	if col < 0 {
+		return nil
+	}
+
+	result := make([]float64, 0, h.n)
+	for i := 0; i < h.n; i++ {
+		result = append(result, h.values[h.index(i)*len(h.quantiles)+col])
+	}
+	return result
+}
+
+// index returns the position in the ring of the i-th oldest record.
+func (h *QuantileHistory) index(i int) int {
+	return (h.next - h.n + i + len(h.times)) % len(h.times)
+}
@@ -0,0 +1,54 @@
+package tdigest
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuantileHistory(t *testing.T) {
+	h, err := NewQuantileHistory(3, 0.5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Len() != 0 || len(h.Values(0.5)) != 0 {
+		t.Errorf("A new history should be empty")
+	}
+
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		d := New(100)
+		d.Add(float64(i), 1)
+		d.Add(float64(10*i), 1)
+		h.Record(base.Add(time.Duration(i)*time.Minute), d)
+	}
+
+	if h.Len() != 3 {
+		t.Errorf("Expected 3 records, got %d", h.Len())
+	}
+	if got := h.Values(1); !reflect.DeepEqual(got, []float64{20, 30, 40}) {
+		t.Errorf("Expected the last maximums, oldest first. Got %v", got)
+	}
+	wantTimes := []time.Time{base.Add(2 * time.Minute), base.Add(3 * time.Minute), base.Add(4 * time.Minute)}
+	if got := h.Times(); !reflect.DeepEqual(got, wantTimes) {
+		t.Errorf("Expected times %v, got %v", wantTimes, got)
+	}
+	if h.Values(0.99) != nil {
+		t.Errorf("Untracked quantiles should have no values")
+	}
+
+	h.Record(base, New(100))
+	if got := h.Values(0.5); !math.IsNaN(got[len(got)-1]) {
+		t.Errorf("Expected NaN for an empty digest, got %v", got)
+	}
+
+	for _, args := range []struct {
+		size      int
+		quantiles []float64
+	}{{0, []float64{0.5}}, {3, nil}, {3, []float64{1.5}}} {
+		if _, err := NewQuantileHistory(args.size, args.quantiles...); err == nil {
+			t.Errorf("Expected NewQuantileHistory(%d, %v) to fail", args.size, args.quantiles)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Encodings of the Java reference AVLTreeDigest (t-digest 3.1 onwards),
+// as written by its asBytes and asSmallBytes methods.
+const (
+	javaVerboseEncoding int32 = 1
+	javaSmallEncoding   int32 = 2
+)
+
+// javaHeaderSize covers the encoding, min, max, compression and number of
+// centroids.
+const javaHeaderSize = 4 + 8 + 8 + 8 + 4
+
+// javaMergingSmallHeaderSize covers the encoding, min, max, float32
+// compression, array sizes and number of centroids of the Java
+// MergingDigest small encoding.
+const javaMergingSmallHeaderSize = 4 + 8 + 8 + 4 + 2 + 2 + 2
+
+// FromJavaBytes deserializes a digest written by the asBytes or
+// asSmallBytes methods of the Java AVLTreeDigest. Both start with the same
+// version numbers as this package's own encodings but also carry the
+// minimum and maximum, so the format can't be told apart from the bytes
+// and needs its own function. The minimum and maximum are dropped. Errors
+// wrap ErrCorrupt.
+func FromJavaBytes(buf []byte) (_ *TDigest, err error) {
+	defer guardDecode(&err)
+
+	if len(buf) < javaHeaderSize {
+		return nil, errors.New("buffer too small for deserialization")
+	}
+
+	encoding := int32(endianess.Uint32(buf[0:]))
+	if encoding != javaVerboseEncoding && encoding != javaSmallEncoding {
+		return nil, fmt.Errorf("unsupported Java encoding version: %d", encoding)
+	}
+	compression := math.Float64frombits(endianess.Uint64(buf[20:]))
+	numCentroids := int32(endianess.Uint32(buf[28:]))
+	if numCentroids < 0 || numCentroids > 1<<22 {
+		return nil, errors.New("bad number of centroids in serialization")
+	}
+
+	idx := javaHeaderSize
+	means := make([]float64, numCentroids)
+	counts := make([]uint64, numCentroids)
+	if encoding == javaVerboseEncoding {
+		if len(buf) < idx+12*int(numCentroids) {
+			return nil, errors.New("buffer too small for deserialization")
+		}
+		for i := range means {
+			means[i] = math.Float64frombits(endianess.Uint64(buf[idx:]))
+			idx += 8
+		}
+		for i := range counts {
+			counts[i] = uint64(endianess.Uint32(buf[idx:]))
+			idx += 4
+		}
+	} else {
+		if len(buf) < idx+4*int(numCentroids) {
+			return nil, errors.New("buffer too small for deserialization")
+		}
+		var x float64
+		for i := range means {
+			x += float64(math.Float32frombits(endianess.Uint32(buf[idx:])))
+			means[i] = x
+			idx += 4
+		}
+		for i := range counts {
+			count, read := binary.Uvarint(buf[idx:])
+			if read < 1 {
+				return nil, errors.New("error decoding varint")
+			}
+			counts[i] = count
+			idx += read
+		}
+	}
+
+	return FromCentroids(means, counts, Compression(compression))
+}
+
+// AsJavaBytes serializes the digest the way the asBytes method of the Java
+// AVLTreeDigest does, with full precision means, so JVM services can read
+// it with AVLTreeDigest.fromBytes. The minimum and maximum are taken from
+// the extreme centroids. It fails if a centroid holds more samples than a
+// Java int can count.
+func (t *TDigest) AsJavaBytes() ([]byte, error) {
+	return t.javaBytes(javaVerboseEncoding)
+}
+
+// AsJavaSmallBytes is like AsJavaBytes, but writes the more compact
+// encoding of asSmallBytes, with float32 mean deltas and varint counts.
+func (t *TDigest) AsJavaSmallBytes() ([]byte, error) {
+	return t.javaBytes(javaSmallEncoding)
+}
+
+func (t *TDigest) javaBytes(encoding int32) ([]byte, error) {
+	t.settle()
+	s := t.summary
+	for _, count := range s.counts {
+		if count > math.MaxInt32 {
+			return nil, fmt.Errorf("centroid count %d overflows a Java int", count)
+		}
+	}
+
+	min, max := math.Inf(1), math.Inf(-1)
+	if s.Len() > 0 {
+		min, max = s.keys[0], s.keys[s.Len()-1]
+	}
+
+	b := make([]byte, 0, javaHeaderSize+12*s.Len())
+	b = endianess.AppendUint32(b, uint32(encoding))
+	b = endianess.AppendUint64(b, math.Float64bits(min))
+	b = endianess.AppendUint64(b, math.Float64bits(max))
+	b = endianess.AppendUint64(b, math.Float64bits(t.compression))
+	b = endianess.AppendUint32(b, uint32(s.Len()))
+
+	if encoding == javaVerboseEncoding {
+		for _, mean := range s.keys {
+			b = endianess.AppendUint64(b, math.Float64bits(mean))
+		}
+		for _, count := range s.counts {
+			b = endianess.AppendUint32(b, uint32(count))
+		}
+		return b, nil
+	}
+
+	var x float64
+	for _, mean := range s.keys {
+		b = endianess.AppendUint32(b, math.Float32bits(float32(mean-x)))
+		x = mean
+	}
+	for _, count := range s.counts {
+		b = binary.AppendUvarint(b, count)
+	}
+	return b, nil
+}
+
+// FromJavaMergingBytes deserializes a digest written by the asBytes or
+// asSmallBytes methods of the Java MergingDigest. Unlike those of the
+// AVLTreeDigest, both store every centroid as a weight and mean pair, in
+// doubles or floats respectively, but their version numbers are the same,
+// so this needs its own function too. Weights are rounded to whole counts;
+// the minimum and maximum are dropped. Errors wrap ErrCorrupt.
+func FromJavaMergingBytes(buf []byte) (_ *TDigest, err error) {
+	defer guardDecode(&err)
+
+	if len(buf) < 4 {
+		return nil, errors.New("buffer too small for deserialization")
+	}
+
+	var compression float64
+	var numCentroids, idx, pairSize int
+	switch encoding := int32(endianess.Uint32(buf[0:])); encoding {
+	case javaVerboseEncoding:
+		if len(buf) < javaHeaderSize {
+			return nil, errors.New("buffer too small for deserialization")
+		}
+		compression = math.Float64frombits(endianess.Uint64(buf[20:]))
+		numCentroids = int(int32(endianess.Uint32(buf[28:])))
+		idx, pairSize = javaHeaderSize, 16
+	case javaSmallEncoding:
+		if len(buf) < javaMergingSmallHeaderSize {
+			return nil, errors.New("buffer too small for deserialization")
+		}
+		compression = float64(math.Float32frombits(endianess.Uint32(buf[20:])))
+		numCentroids = int(int16(endianess.Uint16(buf[28:])))
+		idx, pairSize = javaMergingSmallHeaderSize, 8
+	default:
+		return nil, fmt.Errorf("unsupported Java encoding version: %d", encoding)
+	}
+	if numCentroids < 0 || numCentroids > 1<<22 {
+		return nil, errors.New("bad number of centroids in serialization")
+	}
+	if len(buf) < idx+pairSize*numCentroids {
+		return nil, errors.New("buffer too small for deserialization")
+	}
+
+	means := make([]float64, numCentroids)
+	counts := make([]uint64, numCentroids)
+	for i := range means {
+		var weight float64
+		if pairSize == 16 {
+			weight = math.Float64frombits(endianess.Uint64(buf[idx:]))
+			means[i] = math.Float64frombits(endianess.Uint64(buf[idx+8:]))
+		} else {
+			weight = float64(math.Float32frombits(endianess.Uint32(buf[idx:])))
+			means[i] = float64(math.Float32frombits(endianess.Uint32(buf[idx+4:])))
+		}
+		idx += pairSize
+
+		if !(weight >= 0.5) || weight > math.MaxUint64 {
+			return nil, fmt.Errorf("bad weight %v for centroid %d", weight, i)
+		}
+		counts[i] = uint64(math.Round(weight))
+	}
+
+	return FromCentroids(means, counts, Compression(compression))
+}
+
+// AsJavaMergingSmallBytes serializes the digest the way the asSmallBytes
+// method of the Java MergingDigest does, so JVM pipelines can read it with
+// MergingDigest.fromBytes. Means and weights are stored as float32, which
+// counts exactly up to 2^24 samples per centroid. The minimum and maximum
+// are taken from the extreme centroids. It fails if the digest holds more
+// centroids than the encoding can count.
+func (t *TDigest) AsJavaMergingSmallBytes() ([]byte, error) {
+	t.settle()
+	s := t.summary
+	if s.Len() > math.MaxInt16 {
+		return nil, fmt.Errorf("%d centroids overflow the Java MergingDigest small encoding", s.Len())
+	}
+
+	min, max := math.Inf(1), math.Inf(-1)
+	if s.Len() > 0 {
+		min, max = s.keys[0], s.keys[s.Len()-1]
+	}
+
+	// The Java reader sizes its centroid and buffer arrays from these.
+	size := int(math.Min(2*math.Ceil(t.compression)+10, math.MaxInt16))
+	if size < s.Len() {
+		size = s.Len()
+	}
+	bufferSize := int(math.Min(float64(5*size), math.MaxInt16))
+
+	b := make([]byte, 0, javaMergingSmallHeaderSize+8*s.Len())
+	b = endianess.AppendUint32(b, uint32(javaSmallEncoding))
+	b = endianess.AppendUint64(b, math.Float64bits(min))
+	b = endianess.AppendUint64(b, math.Float64bits(max))
+	b = endianess.AppendUint32(b, math.Float32bits(float32(t.compression)))
+	b = endianess.AppendUint16(b, uint16(size))
+	b = endianess.AppendUint16(b, uint16(bufferSize))
+	b = endianess.AppendUint16(b, uint16(s.Len()))
+	for i, mean := range s.keys {
+		b = endianess.AppendUint32(b, math.Float32bits(float32(s.counts[i])))
+		b = endianess.AppendUint32(b, math.Float32bits(float32(mean)))
+	}
+	return b, nil
+}
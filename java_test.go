@@ -0,0 +1,172 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// javaVerbose lays out centroids as the Java AVLTreeDigest.asBytes does.
+func javaVerbose(min, max, compression float64, means []float64, counts []int32) []byte {
+	b := binary.BigEndian.AppendUint32(nil, 1)
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(min))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(max))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(compression))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(means)))
+	for _, m := range means {
+		b = binary.BigEndian.AppendUint64(b, math.Float64bits(m))
+	}
+	for _, c := range counts {
+		b = binary.BigEndian.AppendUint32(b, uint32(c))
+	}
+	return b
+}
+
+func TestFromJavaBytes(t *testing.T) {
+	buf := javaVerbose(0.5, 9.5, 50, []float64{0.5, 3.25, 9.5}, []int32{1, 300, 1})
+	d, err := FromJavaBytes(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.compression != 50 || d.count != 302 {
+		t.Errorf("Expected compression 50 and 302 samples, got %v and %d", d.compression, d.count)
+	}
+	if !reflect.DeepEqual(d.summary.keys, []float64{0.5, 3.25, 9.5}) || !reflect.DeepEqual(d.summary.counts, []uint64{1, 300, 1}) {
+		t.Errorf("Unexpected centroids %v %v", d.summary.keys, d.summary.counts)
+	}
+
+	if _, err := FromJavaBytes(buf[:len(buf)-1]); err == nil {
+		t.Errorf("Expected a truncated buffer to fail decoding")
+	}
+	buf[3] = 7
+	if _, err := FromJavaBytes(buf); err == nil {
+		t.Errorf("Expected an unknown encoding to fail decoding")
+	}
+}
+
+func TestJavaRoundTrip(t *testing.T) {
+	d := New(100)
+	for i := 0; i < 10000; i++ {
+		d.Add(math.Sin(float64(i))*1000, 1)
+	}
+
+	verbose, err := d.AsJavaBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(verbose, javaVerbose(d.summary.keys[0], d.summary.keys[d.Len()-1], 100, d.summary.keys, toInt32s(d.summary.counts))) {
+		t.Errorf("AsJavaBytes doesn't follow the Java layout")
+	}
+	fromVerbose, err := FromJavaBytes(verbose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromVerbose.summary.keys, d.summary.keys) || !reflect.DeepEqual(fromVerbose.summary.counts, d.summary.counts) {
+		t.Errorf("Expected the verbose encoding to be lossless")
+	}
+
+	small, err := d.AsJavaSmallBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(small) >= len(verbose) {
+		t.Errorf("Expected the small encoding to be smaller")
+	}
+	fromSmall, err := FromJavaBytes(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromSmall.count != d.count || math.Abs(fromSmall.Quantile(0.5)-d.Quantile(0.5)) > 1e-3 {
+		t.Errorf("Expected the small encoding to round trip")
+	}
+
+	huge := New(100)
+	huge.Add(1, math.MaxInt32+1)
+	if _, err := huge.AsJavaBytes(); err == nil {
+		t.Errorf("Expected counts overflowing a Java int to fail")
+	}
+}
+
+func toInt32s(counts []uint64) []int32 {
+	r := make([]int32, len(counts))
+	for i, c := range counts {
+		r[i] = int32(c)
+	}
+	return r
+}
+
+func TestJavaMergingBytes(t *testing.T) {
+	// Laid out as the Java MergingDigest.asSmallBytes does
+	b := binary.BigEndian.AppendUint32(nil, 2)
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(1))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(8))
+	b = binary.BigEndian.AppendUint32(b, math.Float32bits(100))
+	b = binary.BigEndian.AppendUint16(b, 210)
+	b = binary.BigEndian.AppendUint16(b, 1050)
+	b = binary.BigEndian.AppendUint16(b, 3)
+	for _, c := range [][2]float32{{1, 1}, {40, 4.5}, {1, 8}} {
+		b = binary.BigEndian.AppendUint32(b, math.Float32bits(c[0]))
+		b = binary.BigEndian.AppendUint32(b, math.Float32bits(c[1]))
+	}
+
+	d, err := FromJavaMergingBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.compression != 100 || !reflect.DeepEqual(d.summary.keys, []float64{1, 4.5, 8}) || !reflect.DeepEqual(d.summary.counts, []uint64{1, 40, 1}) {
+		t.Errorf("Unexpected digest: compression %v, centroids %v %v", d.compression, d.summary.keys, d.summary.counts)
+	}
+
+	out, err := d.AsJavaMergingSmallBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, b) {
+		t.Errorf("Expected re-encoding to give the same bytes:\n%x\n%x", out, b)
+	}
+
+	// Verbose encoding, with doubles
+	v := binary.BigEndian.AppendUint32(nil, 1)
+	v = binary.BigEndian.AppendUint64(v, math.Float64bits(0.1))
+	v = binary.BigEndian.AppendUint64(v, math.Float64bits(0.1))
+	v = binary.BigEndian.AppendUint64(v, math.Float64bits(50))
+	v = binary.BigEndian.AppendUint32(v, 1)
+	v = binary.BigEndian.AppendUint64(v, math.Float64bits(3))
+	v = binary.BigEndian.AppendUint64(v, math.Float64bits(0.1))
+	d, err = FromJavaMergingBytes(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.compression != 50 || d.count != 3 || d.Quantile(0.5) != 0.1 {
+		t.Errorf("Unexpected digest from the verbose encoding: %v %d", d.compression, d.count)
+	}
+
+	if _, err := FromJavaMergingBytes(b[:len(b)-1]); err == nil {
+		t.Errorf("Expected a truncated buffer to fail decoding")
+	}
+	binary.BigEndian.PutUint32(b[javaMergingSmallHeaderSize:], math.Float32bits(-1))
+	if _, err := FromJavaMergingBytes(b); err == nil {
+		t.Errorf("Expected a negative weight to fail decoding")
+	}
+}
+
+func FuzzFromJavaBytes(f *testing.F) {
+	d := New(10)
+	for i := 0; i < 100; i++ {
+		d.Add(float64(i*i), uint64(i%3+1))
+	}
+	for _, encode := range []func() ([]byte, error){d.AsJavaBytes, d.AsJavaSmallBytes, d.AsJavaMergingSmallBytes} {
+		buf, _ := encode()
+		f.Add(buf)
+	}
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		d, err := FromJavaBytes(buf)
+		checkDecoded(t, d, err)
+		d, err = FromJavaMergingBytes(buf)
+		checkDecoded(t, d, err)
+	})
+}
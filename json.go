@@ -0,0 +1,134 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// exportedDigest is the structure of a digest in the JSON and MessagePack
+// encodings. In JSON, means are written with as many digits as needed to
+// be read back exactly.
+type exportedDigest struct {
+	Compression float64           `json:"compression"`
+	Count       uint64            `json:"count"`
+	Means       []float64         `json:"means"`
+	Counts      []uint64          `json:"counts"`
+	Convention  string            `json:"convention,omitempty"`
+	Scale       string            `json:"scale,omitempty"`
+	Metadata    *exportedMetadata `json:"metadata,omitempty"`
+}
+
+type exportedMetadata struct {
+	Unit    string            `json:"unit,omitempty"`
+	Created *time.Time        `json:"created,omitempty"`
+	Source  string            `json:"source,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+}
+
+var conventionNames = map[QuantileConvention]string{Midpoint: "midpoint", Sample: "sample"}
+
+// MarshalJSON implements json.Marshaler, writing the compression, count
+// and centroids of the digest, along with its metadata and the options
+// serialized by ToBytes (see RegisterScaleFunction) if any, except for
+// transforms. For example:
+//
+//	{"compression":100,"count":3,"means":[1,2.5],"counts":[1,2]}
+func (t *TDigest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.export())
+}
+
+// export lays out the digest for MarshalJSON and MarshalMsgpack.
+func (t *TDigest) export() *exportedDigest {
+	t.settle()
+	j := &exportedDigest{
+		Compression: t.compression,
+		Count:       t.count,
+		Means:       t.summary.keys,
+		Counts:      t.summary.counts,
+		Scale:       scaleName(t.scale),
+	}
+	if j.Means == nil {
+		j.Means, j.Counts = []float64{}, []uint64{}
+	}
+	if t.convention != Midpoint {
+		j.Convention = conventionNames[t.convention]
+	}
+	if m := t.metadata; m != nil {
+		j.Metadata = &exportedMetadata{Unit: m.Unit, Source: m.Source, Tags: m.Tags}
+		if !m.Created.IsZero() {
+			j.Metadata.Created = &m.Created
+		}
+	}
+	return j
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading what MarshalJSON
+// writes. Like the FromBytes method, it replaces the centroids and
+// metadata of t, and the options data specifies, keeping the others.
+func (t *TDigest) UnmarshalJSON(data []byte) error {
+	var j exportedDigest
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	return t.restore(&j)
+}
+
+// restore validates j and replaces the centroids, metadata and options of
+// t with those of j, for UnmarshalJSON and UnmarshalMsgpack.
+func (t *TDigest) restore(j *exportedDigest) error {
+	d, err := FromCentroids(j.Means, j.Counts, Compression(j.Compression))
+	if err != nil {
+		return err
+	}
+	if d.count != j.Count {
+		return fmt.Errorf("count %d doesn't match the %d samples of the centroids", j.Count, d.count)
+	}
+
+	convention := t.convention
+	if j.Convention != "" {
+		found := false
+		for c, name := range conventionNames {
+			if name == j.Convention {
+				convention, found = c, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown quantile convention %q", j.Convention)
+		}
+	}
+	scale := t.scale
+	if j.Scale != "" {
+		if scale = lookupScale(j.Scale); scale == nil {
+			return fmt.Errorf("unknown scale function %q, see RegisterScaleFunction", j.Scale)
+		}
+	}
+
+	t.settle()
+	t.modified()
+	t.moments = moments{inexact: true}
+	t.resetDistinct()
+	var alloc SliceAllocator
+	if t.summary != nil {
+		alloc = t.summary.alloc
+		t.summary.release()
+	}
+	t.summary = newAllocatedSummary(uint(d.summary.Len()), alloc)
+	t.summary.keys = append(t.summary.keys, d.summary.keys...)
+	t.summary.counts = append(t.summary.counts, d.summary.counts...)
+	t.compression = d.compression
+	t.count = d.count
+	t.convention = convention
+	t.scale = scale
+
+	t.metadata = nil
+	if m := j.Metadata; m != nil {
+		t.metadata = &Metadata{Unit: m.Unit, Source: m.Source, Tags: m.Tags}
+		if m.Created != nil {
+			t.metadata.Created = *m.Created
+		}
+	}
+	return nil
+}
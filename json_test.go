@@ -0,0 +1,81 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	d := New(50, WithQuantileConvention(Sample), WithScaleFunction(uniformScale{}),
+		WithMetadata(Metadata{Unit: "ms", Created: created, Tags: map[string]string{"dc": "eu"}}))
+	for i := 0; i < 10000; i++ {
+		d.Add(rand.NormFloat64()*1e-3+1e6, 1)
+	}
+
+	type doc struct {
+		Service string   `json:"service"`
+		Latency *TDigest `json:"latency"`
+	}
+	buf, err := json.Marshal(doc{"api", d})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got doc
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Service != "api" {
+		t.Errorf("Expected the enclosing document to survive")
+	}
+	for _, q := range []float64{0, 0.01, 0.5, 0.99, 1} {
+		if got.Latency.Quantile(q) != d.Quantile(q) {
+			t.Errorf("Quantile(%v) = %v after a round trip, wanted exactly %v", q, got.Latency.Quantile(q), d.Quantile(q))
+		}
+	}
+	if got.Latency.compression != 50 || got.Latency.convention != Sample || !sameScale(got.Latency.scale, uniformScale{}) {
+		t.Errorf("Expected settings to survive, got %+v", got.Latency)
+	}
+	if !reflect.DeepEqual(got.Latency.Metadata(), d.Metadata()) {
+		t.Errorf("Expected metadata %+v, got %+v", d.Metadata(), got.Latency.Metadata())
+	}
+}
+
+func TestJSONStructure(t *testing.T) {
+	d := New(100)
+	buf, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != `{"compression":100,"count":0,"means":[],"counts":[]}` {
+		t.Errorf("Unexpected JSON for an empty digest: %s", buf)
+	}
+
+	d.Add(1, 1)
+	d.Add(2.5, 2)
+	buf, _ = json.Marshal(d)
+	if string(buf) != `{"compression":100,"count":3,"means":[1,2.5],"counts":[1,2]}` {
+		t.Errorf("Unexpected JSON: %s", buf)
+	}
+
+	for _, bad := range []string{
+		`{"compression":100,"count":4,"means":[1,2.5],"counts":[1,2]}`,
+		`{"compression":100,"count":1,"means":[1,2.5],"counts":[1]}`,
+		`{"compression":0,"count":0,"means":[],"counts":[]}`,
+		`{"compression":100,"count":0,"means":[],"counts":[],"convention":"median"}`,
+		`{"compression":100,"count":0,"means":[],"counts":[],"scale":"unknown"}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), new(TDigest)); err == nil {
+			t.Errorf("Expected %s to be rejected", bad)
+		} else if strings.Contains(err.Error(), "cannot unmarshal") {
+			t.Errorf("Expected a validation error for %s, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package tdigest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// MergingDigest is a digest built the way Dunning's MergingDigest is:
+// added samples are only appended to a buffer, and once it fills up it's
+// sorted and merged with the centroids in a single pass. Ingestion thus
+// skips the centroid search and the array shifting TDigest.Add does for
+// every sample, which makes it much faster for high-rate pipelines, at
+// the cost of holding a few more samples in memory.
+//
+// Centroids are sized by the same bound (or CompactionPolicy) as those of
+// TDigest, and queries are answered by the underlying TDigest once the
+// buffer is merged, so both give comparable results.
+type MergingDigest struct {
+	digest *TDigest
+
+	// buffer holds the samples added since the last merge, unsorted.
+	buffer   *summary
+	buffered uint64
+	size     int
+
+	// Merge passes reuse these to lay out the merged points.
+	means  []float64
+	counts []uint64
+}
+
+// NewMergingDigest creates an empty MergingDigest. The compression and
+// options are the same as for New, which panics on invalid ones.
+func NewMergingDigest(compression float64, options ...Option) *MergingDigest {
+	t := New(compression, options...)
+	size := int(5 * math.Ceil(t.compression))
+	return &MergingDigest{
+		digest: t,
+		buffer: newSummary(uint(size)),
+		size:   size,
+	}
+}
+
+// Add buffers count samples of value, merging the buffer into the
+// centroids if it's full.
+func (m *MergingDigest) Add(value float64, count uint64) error {
+	// NaNs would break the sorting of the buffer.
+	if count == 0 || math.IsNaN(value) {
+		return fmt.Errorf("Illegal datapoint <value: %.4f, count: %d>", value, count)
+	}
+	if n := m.digest.count + m.buffered; n+count < n {
+		return fmt.Errorf("count %d overflows the %d samples of the digest", count, n)
+	}
+
+	m.buffer.keys = append(m.buffer.keys, value)
+	m.buffer.counts = append(m.buffer.counts, count)
+	m.buffered += count
+	m.digest.moments.add(value, count, m.digest.count+m.buffered)
+	if m.digest.distinct != nil {
+		m.digest.distinct.Insert(value)
+	}
+	if m.buffer.Len() >= m.size {
+		m.flush()
+	}
+	return nil
+}
+
+// flush merges the buffered samples into the centroids.
+func (m *MergingDigest) flush() {
+	if m.buffer.Len() == 0 {
+		return
+	}
+
+	t := m.digest
+	t.settle()
+	sort.Sort(m.buffer)
+
+	// Both the buffer and the centroids are sorted, so a merge join lays
+	// them out in order for compactSorted.
+	b, s := m.buffer, t.summary
+	m.means, m.counts = m.means[:0], m.counts[:0]
+	i, j := 0, 0
+	for i < b.Len() || j < s.Len() {
+		if j == s.Len() || (i < b.Len() && b.keys[i] < s.keys[j]) {
+			m.means = append(m.means, b.keys[i])
+			m.counts = append(m.counts, b.counts[i])
+			i++
+		} else {
+			m.means = append(m.means, s.keys[j])
+			m.counts = append(m.counts, s.counts[j])
+			j++
+		}
+	}
+
+	t.compactSorted(m.means, m.counts)
+	b.keys, b.counts = b.keys[:0], b.counts[:0]
+	m.buffered = 0
+}
+
+// Quantile returns the estimated value at quantile q, see TDigest.Quantile.
+func (m *MergingDigest) Quantile(q float64) float64 {
+	m.flush()
+	return m.digest.Quantile(q)
+}
+
+// CDF returns the estimated fraction of samples at or below x, see
+// TDigest.CDF.
+func (m *MergingDigest) CDF(x float64) float64 {
+	m.flush()
+	return m.digest.CDF(x)
+}
+
+// Count returns the number of added samples, buffered ones included.
+func (m *MergingDigest) Count() uint64 {
+	return m.digest.count + m.buffered
+}
+
+// Merge merges other into m in a single merge pass. Compatibility and
+// metadata are handled as TDigest.MergeDestructive does.
+func (m *MergingDigest) Merge(other *MergingDigest) error {
+	m.flush()
+	other.flush()
+
+	t, o := m.digest, other.digest
+	if t.strict {
+		if err := t.checkCompatible(o); err != nil {
+			return err
+		}
+	}
+	if err := t.checkMetadata(o); err != nil {
+		return err
+	}
+	if err := t.mergeDistinct(o); err != nil {
+		return err
+	}
+	t.mergeMetadata(o)
+	t.moments.combine(o.exactMoments(), t.count, o.count)
+
+	m.buffer.keys = append(m.buffer.keys, o.summary.keys...)
+	m.buffer.counts = append(m.buffer.counts, o.summary.counts...)
+	m.buffered += o.count
+	m.flush()
+	return nil
+}
+
+// Digest merges the buffered samples and returns the underlying digest.
+// It can be used to serialize m, to merge it with plain digests or for
+// any query MergingDigest doesn't expose. Modifying it modifies m.
+func (m *MergingDigest) Digest() *TDigest {
+	m.flush()
+	return m.digest
+}
@@ -0,0 +1,162 @@
+package tdigest
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestMergingDigest(t *testing.T) {
+	m := NewMergingDigest(100)
+	if !math.IsNaN(m.Quantile(0.5)) {
+		t.Errorf("Expected NaN for an empty digest")
+	}
+
+	data := make([]float64, 100000)
+	for i := range data {
+		data[i] = rand.NormFloat64()
+		if err := m.Add(data[i], 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m.Count() != uint64(len(data)) {
+		t.Errorf("Expected %d samples, got %d", len(data), m.Count())
+	}
+	sort.Float64s(data)
+
+	for _, q := range []float64{0.001, 0.01, 0.1, 0.5, 0.9, 0.99, 0.999} {
+		got := m.Quantile(q)
+		if rank := float64(sort.SearchFloat64s(data, got)) / float64(len(data)); math.Abs(rank-q) > 0.005 {
+			t.Errorf("Quantile(%v) = %v, which is at quantile %v", q, got, rank)
+		}
+	}
+	if got := m.CDF(data[len(data)/2]); math.Abs(got-0.5) > 0.005 {
+		t.Errorf("CDF(median) = %v, wanted about 0.5", got)
+	}
+
+	// Merge passes keep the centroids as few as Add would.
+	if n := m.Digest().Len(); n > 20*100 {
+		t.Errorf("Expected at most 2000 centroids, got %d", n)
+	}
+}
+
+func TestMergingDigestMerge(t *testing.T) {
+	a, b := NewMergingDigest(100), NewMergingDigest(100)
+	for i := 0; i < 10000; i++ {
+		a.Add(rand.Float64(), 1)
+		b.Add(1+rand.Float64(), 1)
+	}
+
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if a.Count() != 20000 {
+		t.Errorf("Expected 20000 samples after merging, got %d", a.Count())
+	}
+	if got := a.Quantile(0.5); math.Abs(got-1) > 0.02 {
+		t.Errorf("Expected the median of the merged digests around 1, got %v", got)
+	}
+
+	ms := NewMergingDigest(100, WithMetadata(Metadata{Unit: "s"}))
+	ms.Add(1, 1)
+	mms := NewMergingDigest(100, WithMetadata(Metadata{Unit: "ms"}))
+	mms.Add(1, 1)
+	if err := ms.Merge(mms); err == nil {
+		t.Errorf("Expected merging digests of different units to fail")
+	}
+}
+
+func TestMergingDigestAdd(t *testing.T) {
+	m := NewMergingDigest(10)
+	if m.Add(1, 0) == nil {
+		t.Errorf("Expected a zero count to be rejected")
+	}
+	if m.Add(math.NaN(), 1) == nil {
+		t.Errorf("Expected NaN to be rejected")
+	}
+
+	m.Add(3, 2)
+	m.Add(1, 1)
+	if m.Count() != 3 || m.Quantile(0) != 1 || m.Quantile(1) != 3 {
+		t.Errorf("Expected buffered samples to be queryable, got count %d", m.Count())
+	}
+
+	if m.Add(2, math.MaxUint64-2) == nil {
+		t.Errorf("Expected a count overflowing the buffered samples to be rejected")
+	}
+	if m.Count() != 3 {
+		t.Errorf("Expected the rejected samples not to be counted, got %d", m.Count())
+	}
+}
+
+func BenchmarkMergingDigestAdd(b *testing.B) {
+	m := NewMergingDigest(100)
+	data := make([]float64, 1000)
+	for i := range data {
+		data[i] = rand.Float64()
+	}
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		m.Add(data[n%len(data)], 1)
+	}
+}
+
+func TestMergingDigestMoments(t *testing.T) {
+	m, plain := NewMergingDigest(100), New(100)
+	other, otherPlain := NewMergingDigest(100), New(100)
+	for i := 1; i <= 1000; i++ {
+		m.Add(float64(i), 1)
+		plain.Add(float64(i), 1)
+		other.Add(float64(i+1000), 2)
+		otherPlain.Add(float64(i+1000), 2)
+	}
+
+	check := func(name string, m *MergingDigest, plain *TDigest) {
+		d := m.Digest()
+		for _, c := range []struct {
+			stat      string
+			got, want float64
+		}{
+			{"Sum", d.Sum(), plain.Sum()},
+			{"Mean", d.Mean(), plain.Mean()},
+			{"Variance", d.Variance(), plain.Variance()},
+			{"StdDev", d.StdDev(), plain.StdDev()},
+		} {
+			if math.Abs(c.got-c.want) > 1e-6*math.Abs(c.want) {
+				t.Errorf("%s: expected %s %v like a TDigest, got %v", name, c.stat, c.want, c.got)
+			}
+		}
+	}
+	check("Add", m, plain)
+	if s := m.Digest().Sum(); s != 500500 {
+		t.Errorf("Expected a sum of 500500, got %v", s)
+	}
+
+	if err := m.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	plain.Merge(otherPlain)
+	check("Merge", m, plain)
+}
+
+func TestMergingDigestMinMax(t *testing.T) {
+	m := NewMergingDigest(10)
+	for _, i := range rand.Perm(1000) {
+		m.Add(float64(i+1), 1)
+	}
+	if d := m.Digest(); d.Min() != 1 || d.Max() != 1000 {
+		t.Errorf("Expected extremes of 1 and 1000, got %v and %v", d.Min(), d.Max())
+	}
+
+	other := NewMergingDigest(10)
+	other.Add(2000, 1)
+	other.Add(-5, 1)
+	if err := m.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	if d := m.Digest(); d.Min() != -5 || d.Max() != 2000 {
+		t.Errorf("Expected extremes of -5 and 2000 after merging, got %v and %v", d.Min(), d.Max())
+	}
+}
@@ -0,0 +1,323 @@
+package tdigest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Metadata describes what a digest measures. It is optional, survives
+// serialization and is combined on Merge according to the digest's
+// MetadataMergePolicy, which lets aggregators check they aren't mixing
+// seconds with milliseconds.
+type Metadata struct {
+	// Unit of the added values, e.g. "s" or "ms".
+	Unit string
+
+	// Created is when the digest started collecting samples.
+	Created time.Time
+
+	// Source identifies where the samples come from, e.g. a host name.
+	Source string
+
+	// Tags holds any other key/value pairs.
+	Tags map[string]string
+}
+
+// MetadataMergePolicy rules how Merge combines the metadata of digests.
+type MetadataMergePolicy int
+
+const (
+	// MetadataMergeCombine refuses to merge digests that both have a
+	// unit if the units differ, returning an *IncompatibleError. When
+	// merging, the receiver adopts the unit of the other digest if it had
+	// none, keeps the earliest creation time, drops the source if they
+	// differ and adds the tags it doesn't have. It is the default.
+	MetadataMergeCombine MetadataMergePolicy = iota
+
+	// MetadataMergeKeep leaves the metadata of the receiver untouched and
+	// doesn't validate anything.
+	MetadataMergeKeep
+)
+
+// WithMetadata attaches a copy of m to the digest.
+func WithMetadata(m Metadata) Option {
+	return func(t *TDigest) error {
+		t.SetMetadata(&m)
+		return nil
+	}
+}
+
+// WithMetadataMergePolicy sets how Merge handles metadata.
+func WithMetadataMergePolicy(policy MetadataMergePolicy) Option {
+	return func(t *TDigest) error {
+		if policy != MetadataMergeCombine && policy != MetadataMergeKeep {
+			return errors.New("unknown metadata merge policy")
+		}
+		t.metadataPolicy = policy
+		return nil
+	}
+}
+
+// Metadata returns a copy of the metadata of the digest, or nil if it has
+// none.
+func (t *TDigest) Metadata() *Metadata {
+	return t.metadata.clone()
+}
+
+// SetMetadata replaces the metadata of the digest by a copy of m. A nil m
+// removes it.
+func (t *TDigest) SetMetadata(m *Metadata) {
+	t.modified()
+	t.metadata = m.clone()
+}
+
+func (m *Metadata) clone() *Metadata {
+	if m == nil {
+		return nil
+	}
+	c := *m
+	if m.Tags != nil {
+		c.Tags = make(map[string]string, len(m.Tags))
+		for k, v := range m.Tags {
+			c.Tags[k] = v
+		}
+	}
+	return &c
+}
+
+func (t *TDigest) checkMetadata(other *TDigest) error {
+	if t.metadataPolicy == MetadataMergeKeep || t.metadata == nil || other.metadata == nil {
+		return nil
+	}
+	if t.metadata.Unit != "" && other.metadata.Unit != "" && t.metadata.Unit != other.metadata.Unit {
+		return &IncompatibleError{Setting: "unit"}
+	}
+	return nil
+}
+
+func (t *TDigest) mergeMetadata(other *TDigest) {
+	if t.metadataPolicy == MetadataMergeKeep || other.metadata == nil {
+		return
+	}
+	if t.metadata == nil {
+		t.metadata = other.metadata.clone()
+		return
+	}
+
+	m, o := t.metadata, other.metadata
+	if m.Unit == "" {
+		m.Unit = o.Unit
+	}
+	if m.Created.IsZero() || (!o.Created.IsZero() && o.Created.Before(m.Created)) {
+		m.Created = o.Created
+	}
+	if m.Source != o.Source {
+		m.Source = ""
+	}
+	for k, v := range o.Tags {
+		if m.Tags == nil {
+			m.Tags = make(map[string]string, len(o.Tags))
+		}
+		if _, ok := m.Tags[k]; !ok {
+			m.Tags[k] = v
+		}
+	}
+}
+
+// Metadata is appended to the serialized centroids, behind a marker, so
+// that readers unaware of it simply ignore it and digests without
+// metadata keep their exact encoding.
+var metadataMarker = []byte("tdmd")
+
+// appendTo appends the serialized metadata, if any, to b.
+func (m *Metadata) appendTo(b []byte) []byte {
+	if m == nil {
+		return b
+	}
+
+	var payload []byte
+	payload = appendString(payload, m.Unit)
+	payload = appendString(payload, m.Source)
+	var created int64
+	if !m.Created.IsZero() {
+		created = m.Created.UnixNano()
+	}
+	payload = binary.AppendVarint(payload, created)
+
+	keys := make([]string, 0, len(m.Tags))
+	for k := range m.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	payload = binary.AppendUvarint(payload, uint64(len(keys)))
+	for _, k := range keys {
+		payload = appendString(payload, k)
+		payload = appendString(payload, m.Tags[k])
+	}
+
+	return appendTrailer(b, metadataMarker, payload)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// decodeMetadata reads the metadata serialized by appendTo at the start
+// of buf. It returns nil without error if there is none.
+func decodeMetadata(buf []byte) (*Metadata, error) {
+	payload, _, err := decodeTrailer(buf, metadataMarker, errBadMetadata)
+	if payload == nil || err != nil {
+		return nil, err
+	}
+	return decodeMetadataPayload(payload)
+}
+
+// readMetadata is as decodeMetadata, consuming the metadata from buf. It
+// leaves buf untouched if there is none.
+func readMetadata(buf *bytes.Reader) (*Metadata, error) {
+	payload, err := readTrailer(buf, metadataMarker, errBadMetadata)
+	if payload == nil || err != nil {
+		return nil, err
+	}
+	return decodeMetadataPayload(payload)
+}
+
+func decodeMetadataPayload(payload []byte) (*Metadata, error) {
+	r := trailerReader{buf: payload, bad: errBadMetadata}
+	m := &Metadata{}
+	m.Unit = r.string()
+	m.Source = r.string()
+	if created := r.varint(); created != 0 {
+		m.Created = time.Unix(0, created).UTC()
+	}
+	numTags := r.uvarint()
+	if numTags > uint64(len(r.buf)) {
+		return nil, errBadMetadata
+	}
+	if numTags > 0 {
+		m.Tags = make(map[string]string, numTags)
+		for i := uint64(0); i < numTags && r.err == nil; i++ {
+			k := r.string()
+			m.Tags[k] = r.string()
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+var errBadMetadata = errors.New("bad metadata in serialization")
+
+// appendTrailer appends payload to b behind marker and its length.
+func appendTrailer(b, marker, payload []byte) []byte {
+	b = append(b, marker...)
+	b = binary.AppendUvarint(b, uint64(len(payload)))
+	return append(b, payload...)
+}
+
+// decodeTrailer returns the payload of the trailer with the given marker
+// at the start of buf, along with the number of bytes it takes. It
+// returns a nil payload without error if buf doesn't start with marker.
+func decodeTrailer(buf, marker []byte, bad error) ([]byte, int, error) {
+	if !bytes.HasPrefix(buf, marker) {
+		return nil, 0, nil
+	}
+	idx := len(marker)
+
+	size, read := binary.Uvarint(buf[idx:])
+	if read < 1 || size > uint64(len(buf)-idx-read) {
+		return nil, 0, bad
+	}
+	idx += read
+	return buf[idx : idx+int(size)], idx + int(size), nil
+}
+
+// readTrailer is as decodeTrailer, consuming the trailer from buf. It
+// leaves buf untouched if there is none.
+func readTrailer(buf *bytes.Reader, marker []byte, bad error) ([]byte, error) {
+	start := make([]byte, len(marker))
+	n, _ := io.ReadFull(buf, start)
+	if n < len(start) || !bytes.Equal(start, marker) {
+		_, err := buf.Seek(-int64(n), io.SeekCurrent)
+		return nil, err
+	}
+
+	size, err := binary.ReadUvarint(buf)
+	if err != nil || size > uint64(buf.Len()) {
+		return nil, bad
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(buf, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// trailerReader decodes the fields of a trailer payload, remembering the
+// first error so they can be read in a row and checked once.
+type trailerReader struct {
+	buf []byte
+	err error
+	bad error
+}
+
+func (r *trailerReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, read := binary.Uvarint(r.buf)
+	if read < 1 {
+		r.err = r.bad
+		return 0
+	}
+	r.buf = r.buf[read:]
+	return v
+}
+
+func (r *trailerReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, read := binary.Varint(r.buf)
+	if read < 1 {
+		r.err = r.bad
+		return 0
+	}
+	r.buf = r.buf[read:]
+	return v
+}
+
+func (r *trailerReader) float64() float64 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.buf) < 8 {
+		r.err = r.bad
+		return 0
+	}
+	v := math.Float64frombits(endianess.Uint64(r.buf))
+	r.buf = r.buf[8:]
+	return v
+}
+
+func (r *trailerReader) string() string {
+	n := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if n > uint64(len(r.buf)) {
+		r.err = r.bad
+		return ""
+	}
+	s := string(r.buf[:n])
+	r.buf = r.buf[n:]
+	return s
+}
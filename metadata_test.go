@@ -0,0 +1,111 @@
+package tdigest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMetadataSerialization(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	meta := Metadata{Unit: "ms", Created: created, Source: "web-1", Tags: map[string]string{"route": "/", "dc": "eu"}}
+
+	d := New(100, WithMetadata(meta))
+	for i := 0; i < 100; i++ {
+		d.Add(float64(i), 1)
+	}
+
+	plain := New(100)
+	for i := 0; i < 100; i++ {
+		plain.Add(float64(i), 1)
+	}
+
+	buf := d.ToBytes(nil)
+	if !bytes.HasPrefix(buf, plain.ToBytes(nil)) {
+		t.Errorf("Metadata should only be appended to the regular encoding")
+	}
+
+	fromMethod := &TDigest{}
+	if err := fromMethod.FromBytes(buf); err != nil {
+		t.Fatal(err)
+	}
+	asBytes, err := d.AsBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromFunc, err := FromBytes(bytes.NewReader(asBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, got := range []*Metadata{fromMethod.Metadata(), fromFunc.Metadata()} {
+		if !reflect.DeepEqual(got, &meta) {
+			t.Errorf("Expected metadata %+v, got %+v", meta, got)
+		}
+	}
+
+	if err := fromMethod.FromBytes(plain.ToBytes(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if fromMethod.Metadata() != nil {
+		t.Errorf("Decoding a digest without metadata should clear it")
+	}
+
+	if err := fromMethod.FromBytes(buf[:len(buf)-1]); err == nil {
+		t.Errorf("Expected truncated metadata to fail decoding")
+	}
+}
+
+func TestMetadataReturnsCopies(t *testing.T) {
+	d := New(100, WithMetadata(Metadata{Tags: map[string]string{"a": "b"}}))
+	d.Metadata().Tags["a"] = "c"
+	if d.Metadata().Tags["a"] != "b" {
+		t.Errorf("Metadata should return a copy")
+	}
+}
+
+func TestMetadataMerge(t *testing.T) {
+	early := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+
+	d := New(100, WithMetadata(Metadata{Created: late, Source: "a", Tags: map[string]string{"x": "1"}}))
+	other := New(100, WithMetadata(Metadata{Unit: "s", Created: early, Source: "b", Tags: map[string]string{"x": "2", "y": "3"}}))
+	other.Add(1, 1)
+
+	if err := d.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	want := &Metadata{Unit: "s", Created: early, Tags: map[string]string{"x": "1", "y": "3"}}
+	if got := d.Metadata(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected merged metadata %+v, got %+v", want, got)
+	}
+
+	ms := New(100, WithMetadata(Metadata{Unit: "ms"}))
+	ms.Add(2, 1)
+	err := d.Merge(ms)
+	if e, ok := err.(*IncompatibleError); !ok || e.Setting != "unit" {
+		t.Errorf("Expected an IncompatibleError about the unit. Got %v", err)
+	}
+	if d.count != 1 {
+		t.Errorf("Nothing should be merged on error. Got count %d", d.count)
+	}
+
+	keep := New(100, WithMetadata(Metadata{Unit: "s"}), WithMetadataMergePolicy(MetadataMergeKeep))
+	if err := keep.Merge(ms); err != nil {
+		t.Errorf("MetadataMergeKeep should not validate units. Got %v", err)
+	}
+	if keep.Metadata().Unit != "s" {
+		t.Errorf("MetadataMergeKeep should not touch the metadata")
+	}
+
+	noMeta := New(100)
+	if err := noMeta.Merge(ms); err != nil {
+		t.Fatal(err)
+	}
+	if noMeta.Metadata().Unit != "ms" {
+		t.Errorf("A digest without metadata should adopt the merged one")
+	}
+
+	shouldPanic(func() { New(100, WithMetadataMergePolicy(42)) }, t, "Unknown policies should be rejected")
+}
@@ -0,0 +1,116 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Migrate rewrites every digest of src into dst in the current canonical
+// format, that is as ToBytes serializes it, whatever older encoding it was
+// stored in. Options, such as WithEncoding, are applied to every digest
+// before it is written out. src and dst may be the same store, to migrate
+// an archive in place: FileStore.Put replaces files atomically.
+//
+// Digests are streamed through workers goroutines (at least one), so
+// archives of any size are migrated in bounded memory. Migrate stops at
+// the first error, or when ctx is done, and returns the number of digests
+// written so far.
+func Migrate(ctx context.Context, src *FileStore, dst Store, workers int, options ...Option) (int, error) {
+	if workers < 1 {
+		return 0, errors.New("at least one worker is required")
+	}
+	keys, err := src.Keys()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type job struct {
+		key string
+		ts  int64
+	}
+	jobs := make(chan job)
+
+	var (
+		migrated int64
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := migrateOne(src, dst, j.key, j.ts, options); err != nil {
+					fail(fmt.Errorf("%s at %d: %v", j.key, j.ts, err))
+					continue
+				}
+				atomic.AddInt64(&migrated, 1)
+			}
+		}()
+	}
+
+	from, to := time.Unix(0, math.MinInt64), time.Unix(0, math.MaxInt64)
+feed:
+	for _, key := range keys {
+		stamps, err := src.stamps(key, from, to)
+		if err != nil {
+			fail(fmt.Errorf("%s: %v", key, err))
+			break
+		}
+		for _, ts := range stamps {
+			if ctx.Err() != nil {
+				fail(ctx.Err())
+				break feed
+			}
+			select {
+			case jobs <- job{key, ts}:
+			case <-ctx.Done():
+				fail(ctx.Err())
+				break feed
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return int(migrated), firstErr
+}
+
+func migrateOne(src *FileStore, dst Store, key string, ts int64, options []Option) error {
+	buf, err := os.ReadFile(src.path(key, ts))
+	if err != nil {
+		return err
+	}
+	d, err := decodeStored(buf)
+	if err != nil {
+		return err
+	}
+	for _, option := range options {
+		if err := option(d); err != nil {
+			return err
+		}
+	}
+	return dst.Put(key, time.Unix(0, ts).UTC(), d)
+}
@@ -0,0 +1,88 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	src, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		d := New(100, WithEncoding(RunLengthEncoding))
+		for j := 0; j <= i; j++ {
+			d.Add(float64(j), 1)
+		}
+		if err := src.Put([]string{"a", "b/c"}[i%2], base.Add(time.Duration(i)*time.Minute), d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := NewMemoryStore()
+	n, err := Migrate(context.Background(), src, dst, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 20 {
+		t.Errorf("Expected 20 migrated digests, got %d", n)
+	}
+
+	d, err := dst.Get("b/c", base.Add(19*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.count != 20 {
+		t.Errorf("Expected 20 samples in the migrated digest, got %d", d.count)
+	}
+	if buf := dst.data["a"][base.UnixNano()]; int32(endianess.Uint32(buf)) != smallEncoding {
+		t.Errorf("Expected digests to be rewritten in the small encoding")
+	}
+
+	// In place, with options
+	if _, err := Migrate(context.Background(), src, src, 2, WithEncoding(RunLengthEncoding)); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := os.ReadFile(src.path("a", base.UnixNano()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int32(endianess.Uint32(buf)) != rleEncoding {
+		t.Errorf("Expected options to be applied before rewriting digests")
+	}
+}
+
+func TestMigrateErrors(t *testing.T) {
+	src, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := New(100)
+	d.Add(1, 1)
+	src.Put("a", time.Unix(0, 1), d)
+	src.Put("a", time.Unix(0, 2), d)
+	if err := os.WriteFile(src.path("a", 2), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Migrate(context.Background(), src, NewMemoryStore(), 1); err == nil || !strings.Contains(err.Error(), "a at 2") {
+		t.Errorf("Expected an error naming the broken digest, got %v", err)
+	}
+	if _, err := Migrate(context.Background(), src, NewMemoryStore(), 0); err == nil {
+		t.Errorf("Expected zero workers to be rejected")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Migrate(ctx, src, NewMemoryStore(), 1); err != context.Canceled {
+		t.Errorf("Expected the context error, got %v", err)
+	}
+}
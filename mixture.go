@@ -0,0 +1,75 @@
+package tdigest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Mixture returns a digest for the mixture of the distributions described
+// by digests, where the i-th one accounts for a weights[i] share of the
+// result regardless of how many samples it holds. This is what's needed to
+// blend, say, per-region latency curves by traffic share. The inputs are
+// not modified.
+//
+// The result has as many samples as all the inputs together and the
+// highest of their compressions.
+func Mixture(weights []float64, digests []*TDigest) (*TDigest, error) {
+	if len(weights) != len(digests) {
+		return nil, fmt.Errorf("got %d weights but %d digests", len(weights), len(digests))
+	}
+
+	var totalWeight float64
+	var totalCount uint64
+	compression := 1.0
+	for i, w := range weights {
+		if !(w >= 0) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("invalid weight %v for digest %d", w, i)
+		}
+		if w > 0 && (digests[i] == nil || digests[i].count == 0) {
+			return nil, fmt.Errorf("digest %d is empty but has a positive weight", i)
+		}
+		if w == 0 {
+			continue
+		}
+		totalWeight += w
+		totalCount += digests[i].count
+		compression = math.Max(compression, digests[i].compression)
+	}
+	if totalWeight == 0 {
+		return nil, errors.New("at least one weight must be positive")
+	}
+
+	var means []float64
+	var counts []uint64
+	for i, d := range digests {
+		if weights[i] == 0 {
+			continue
+		}
+		d = d.settled()
+
+		// Rescale the centroids so this digest holds its share of the total
+		// count, rounding cumulative ranks so no weight gets lost.
+		scale := weights[i] / totalWeight * float64(totalCount) / float64(d.count)
+		var before, rounded uint64
+		for j, mean := range d.summary.keys {
+			before += d.summary.counts[j]
+			next := uint64(math.Floor(float64(before)*scale + 0.5))
+			if next > rounded {
+				means = append(means, mean)
+				counts = append(counts, next-rounded)
+				rounded = next
+			}
+		}
+	}
+
+	t, err := FromCentroids(means, counts, Compression(compression))
+	if err != nil {
+		return nil, err
+	}
+	means = append(means[:0], t.summary.keys...)
+	counts = append(counts[:0], t.summary.counts...)
+	t.compactSorted(means, counts)
+
+	return t, nil
+}
@@ -0,0 +1,61 @@
+package tdigest
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestMixture(t *testing.T) {
+	// A large region around 0 and a small one around 10. With equal
+	// weights each should account for half of the mixture, regardless of
+	// their sample counts.
+	low := New(100)
+	for i := 0; i < 9000; i++ {
+		low.Add(rand.Float64(), 1)
+	}
+	high := New(50)
+	for i := 0; i < 1000; i++ {
+		high.Add(10+rand.Float64(), 1)
+	}
+
+	lowBefore := &summary{keys: append([]float64{}, low.summary.keys...), counts: append([]uint64{}, low.summary.counts...)}
+
+	mix, err := Mixture([]float64{1, 1}, []*TDigest{low, high})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(low.summary, lowBefore) {
+		t.Errorf("Mixture should not modify its inputs")
+	}
+	if mix.compression != 100 {
+		t.Errorf("Expected the highest compression, got %.1f", mix.compression)
+	}
+	if mix.count < 9999 || mix.count > 10001 {
+		t.Errorf("Expected about 10000 samples, got %d", mix.count)
+	}
+
+	if got := mix.Quantile(0.25); math.Abs(got-0.5) > 0.05 {
+		t.Errorf("Quantile(0.25) = %.4f, wanted about 0.5", got)
+	}
+	if got := mix.Quantile(0.75); math.Abs(got-10.5) > 0.05 {
+		t.Errorf("Quantile(0.75) = %.4f, wanted about 10.5", got)
+	}
+
+	mix, err = Mixture([]float64{3, 0}, []*TDigest{high, New(10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(mix.Quantile(0.5)-high.Quantile(0.5)) > 0.02 {
+		t.Errorf("A single weighted digest should be reproduced. Got p50=%.4f, wanted %.4f", mix.Quantile(0.5), high.Quantile(0.5))
+	}
+
+	for _, weights := range [][]float64{{1}, {0, 0}, {-1, 1}, {math.NaN(), 1}, {1, 1}} {
+		_, err := Mixture(weights, []*TDigest{low, New(10)})
+		if err == nil {
+			t.Errorf("Expected Mixture(%v) to fail", weights)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package tdigest
+
+import "math"
+
+// moments tracks the sum, mean, variance and extremes of the samples added
+// to a digest as they are added, so that they are exact rather than
+// estimated from centroids. The mean and variance follow Welford's
+// algorithm, which unlike sums of squares doesn't lose precision to
+// cancellation.
+type moments struct {
+	sum      float64
+	mean     float64
+	m2       float64 // sum of the squared deviations from the mean
+	min, max float64
+
+	// inexact is set once samples reached the digest as centroids, e.g.
+	// through deserialization, whose exact moments are unknown.
+	inexact bool
+}
+
+// add accounts for count samples of x, making a total of n.
+func (m *moments) add(x float64, count, n uint64) {
+	w := float64(count)
+	m.sum += w * x
+	delta := x - m.mean
+	m.mean += delta * w / float64(n)
+	m.m2 += w * delta * (x - m.mean)
+	if n == count {
+		m.min, m.max = x, x
+	} else {
+		m.min, m.max = math.Min(m.min, x), math.Max(m.max, x)
+	}
+}
+
+// combine accounts for the samples o describes, on of them, joining the n
+// samples m describes.
+func (m *moments) combine(o moments, n, on uint64) {
+	if on == 0 {
+		return
+	}
+	total := float64(n) + float64(on)
+	delta := o.mean - m.mean
+	m.sum += o.sum
+	m.mean += delta * float64(on) / total
+	m.m2 += o.m2 + delta*delta*float64(n)*float64(on)/total
+	m.inexact = m.inexact || o.inexact
+	if n == 0 {
+		m.min, m.max = o.min, o.max
+	} else {
+		m.min, m.max = math.Min(m.min, o.min), math.Max(m.max, o.max)
+	}
+}
+
+// exactMoments returns the moments of the samples of the digest, estimated
+// from its centroids if they are inexact.
+func (t *TDigest) exactMoments() moments {
+	if !t.moments.inexact {
+		return t.moments
+	}
+	t.settle()
+	m := moments{inexact: true}
+	var n uint64
+	for i, x := range t.summary.keys {
+		n += t.summary.counts[i]
+		m.add(x, t.summary.counts[i], n)
+	}
+	return m
+}
+
+// Sum returns the sum of the samples of the digest. It is computed as
+// samples are added, so it is exact up to floating point rounding, unless
+// samples came in as centroids: deserialized, built by FromCentroids or
+// merged from such digests. It is estimated from the centroids then.
+func (t *TDigest) Sum() float64 {
+	return t.exactMoments().sum
+}
+
+// Mean returns the mean of the samples of the digest, or NaN if it is
+// empty. Like Sum, it is exact unless samples came in as centroids.
+func (t *TDigest) Mean() float64 {
+	if t.count == 0 {
+		return math.NaN()
+	}
+	return t.exactMoments().mean
+}
+
+// Variance returns the population variance of the samples of the digest,
+// or NaN if it is empty. Like Sum, it is exact unless samples came in as
+// centroids; the estimate ignores the spread of samples within every
+// centroid then, so it tends to be low.
+func (t *TDigest) Variance() float64 {
+	if t.count == 0 {
+		return math.NaN()
+	}
+	return t.exactMoments().m2 / float64(t.count)
+}
+
+// StdDev returns the population standard deviation of the samples of the
+// digest, or NaN if it is empty, see Variance.
+func (t *TDigest) StdDev() float64 {
+	return math.Sqrt(t.Variance())
+}
+
+// Min returns the smallest sample added to the digest, or NaN if it is
+// empty. Unlike Quantile(0), which returns the mean of the first centroid,
+// it is exact, unless samples came in as centroids (see Sum), in which
+// case it is the smallest centroid mean.
+func (t *TDigest) Min() float64 {
+	if t.count == 0 {
+		return math.NaN()
+	}
+	return t.exactMoments().min
+}
+
+// Max returns the largest sample added to the digest, or NaN if it is
+// empty. Like Min, it is exact unless samples came in as centroids.
+func (t *TDigest) Max() float64 {
+	if t.count == 0 {
+		return math.NaN()
+	}
+	return t.exactMoments().max
+}
@@ -0,0 +1,186 @@
+package tdigest
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// naiveMoments computes the sum, mean and population variance of values
+// the way a user would.
+func naiveMoments(values []float64) (sum, mean, variance float64) {
+	for _, x := range values {
+		sum += x
+	}
+	mean = sum / float64(len(values))
+	for _, x := range values {
+		variance += (x - mean) * (x - mean)
+	}
+	return sum, mean, variance / float64(len(values))
+}
+
+func assertMoments(t *testing.T, name string, d *TDigest, values []float64, tolerance float64) {
+	t.Helper()
+	sum, mean, variance := naiveMoments(values)
+	for _, m := range []struct {
+		what      string
+		got, want float64
+	}{
+		{"sum", d.Sum(), sum},
+		{"mean", d.Mean(), mean},
+		{"variance", d.Variance(), variance},
+		{"stddev", d.StdDev(), math.Sqrt(variance)},
+	} {
+		if math.Abs(m.got-m.want) > tolerance*math.Abs(m.want) {
+			t.Errorf("%s: expected a %s of %v, got %v", name, m.what, m.want, m.got)
+		}
+	}
+}
+
+func TestMoments(t *testing.T) {
+	values := make([]float64, 20000)
+	for i := range values {
+		// A large offset makes sums of squares lose all precision: their
+		// rounding errors alone would exceed the variance.
+		values[i] = 1e9 + rand.NormFloat64()
+	}
+
+	for name, options := range map[string][]Option{
+		"default":                {},
+		"background compression": {WithBackgroundCompression()},
+		"buffered":               {WithBufferedAdd(100)},
+	} {
+		d := New(10, options...)
+		for _, x := range values {
+			d.Add(x, 1)
+		}
+		assertMoments(t, name, d, values, 1e-4)
+	}
+
+	d := New(10)
+	if err := d.AddBatch(values); err != nil {
+		t.Fatal(err)
+	}
+	assertMoments(t, "AddBatch", d, values, 1e-4)
+
+	d, err := FromSamples(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMoments(t, "FromSamples", d, values, 1e-4)
+
+	a, b := New(10), New(10)
+	for i, x := range values {
+		if i%3 == 0 {
+			a.Add(x, 1)
+		} else {
+			b.Add(x, 1)
+		}
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	assertMoments(t, "Merge", a, values, 1e-4)
+
+	a.Compress()
+	assertMoments(t, "Compress", a, values, 1e-4)
+}
+
+func TestInexactMoments(t *testing.T) {
+	values := make([]float64, 10000)
+	for i := range values {
+		values[i] = rand.ExpFloat64()
+	}
+	d := New(100)
+	for _, x := range values {
+		d.Add(x, 1)
+	}
+
+	decoded, err := FromBytes(bytes.NewReader(d.ToBytes(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.moments.inexact {
+		t.Fatalf("Expected the moments of decoded digests to be estimated")
+	}
+	// Centroids hide some of the spread.
+	assertMoments(t, "FromBytes", decoded, values, 0.02)
+	if decoded.Variance() > d.Variance() {
+		t.Errorf("Expected the estimated variance to be low")
+	}
+
+	// Merging exact moments into estimated ones estimates the result.
+	decoded.Merge(d)
+	assertMoments(t, "merged", decoded, append(values, values...), 0.02)
+}
+
+func TestMomentsEdgeCases(t *testing.T) {
+	d := New(100)
+	if d.Sum() != 0 || !math.IsNaN(d.Mean()) || !math.IsNaN(d.Variance()) || !math.IsNaN(d.StdDev()) {
+		t.Errorf("Expected a sum of 0 and NaN moments for an empty digest")
+	}
+
+	d.Add(2, 3)
+	d.Add(4, 1)
+	if d.Sum() != 10 || d.Mean() != 2.5 || d.Variance() != 0.75 {
+		t.Errorf("Expected weighted moments, got %v, %v and %v", d.Sum(), d.Mean(), d.Variance())
+	}
+
+	d.Reset()
+	if d.Sum() != 0 || !math.IsNaN(d.Mean()) {
+		t.Errorf("Expected Reset to clear the moments")
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	d := New(10)
+	if !math.IsNaN(d.Min()) || !math.IsNaN(d.Max()) {
+		t.Errorf("Expected NaN extremes for an empty digest")
+	}
+
+	other := New(10)
+	for i := 0; i < 10000; i++ {
+		d.Add(rand.Float64(), 1)
+		other.Add(rand.Float64()+0.5, 1)
+	}
+	d.Add(-1, 1)
+	other.Add(7, 1)
+	d.Add(0.5, 1)
+	if d.Min() != -1 || d.Max() >= 1 {
+		t.Errorf("Expected extremes of -1 and below 1, got %v and %v", d.Min(), d.Max())
+	}
+
+	// Merged centroids drift away from the extremes, which stay exact.
+	if err := d.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	d.Compress()
+	if d.Min() != -1 || d.Max() != 7 {
+		t.Errorf("Expected extremes of -1 and 7 after merging, got %v and %v", d.Min(), d.Max())
+	}
+	if f := d.Freeze(); f.Min() != -1 || f.Max() != 7 {
+		t.Errorf("Expected frozen copies to keep the extremes")
+	}
+
+	empty := New(10)
+	empty.Merge(d)
+	if empty.Min() != -1 || empty.Max() != 7 {
+		t.Errorf("Expected merging into an empty digest to take the extremes, got %v and %v", empty.Min(), empty.Max())
+	}
+
+	decoded, err := FromBytes(bytes.NewReader(d.ToBytes(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Min() != decoded.Quantile(0) || decoded.Max() != decoded.Quantile(1) {
+		t.Errorf("Expected the extremes of decoded digests to be the extreme centroids")
+	}
+
+	inf := New(10)
+	inf.Add(math.Inf(-1), 1)
+	inf.Add(1, 1)
+	if !math.IsInf(inf.Min(), -1) || inf.Max() != 1 {
+		t.Errorf("Expected infinite samples to be kept, got %v and %v", inf.Min(), inf.Max())
+	}
+}
@@ -0,0 +1,478 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// MarshalMsgpack serializes the digest as a MessagePack map with the same
+// keys and values as MarshalJSON, so that it can be embedded in msgpack
+// records (Fluent Bit, for instance) as a structure rather than a binary
+// blob. Means are written as float64s and metadata creation times with the
+// timestamp extension. It implements the Marshaler interface of the
+// vmihailenco/msgpack package.
+func (t *TDigest) MarshalMsgpack() ([]byte, error) {
+	j := t.export()
+
+	fields := 4
+	for _, set := range []bool{j.Convention != "", j.Scale != "", j.Metadata != nil} {
+		if set {
+			fields++
+		}
+	}
+
+	b := appendMsgpackMap(nil, fields)
+	b = appendMsgpackString(b, "compression")
+	b = appendMsgpackFloat(b, j.Compression)
+	b = appendMsgpackString(b, "count")
+	b = appendMsgpackUint(b, j.Count)
+	b = appendMsgpackString(b, "means")
+	b = appendMsgpackArray(b, len(j.Means))
+	for _, mean := range j.Means {
+		b = appendMsgpackFloat(b, mean)
+	}
+	b = appendMsgpackString(b, "counts")
+	b = appendMsgpackArray(b, len(j.Counts))
+	for _, count := range j.Counts {
+		b = appendMsgpackUint(b, count)
+	}
+	if j.Convention != "" {
+		b = appendMsgpackString(b, "convention")
+		b = appendMsgpackString(b, j.Convention)
+	}
+	if j.Scale != "" {
+		b = appendMsgpackString(b, "scale")
+		b = appendMsgpackString(b, j.Scale)
+	}
+	if m := j.Metadata; m != nil {
+		b = appendMsgpackString(b, "metadata")
+		b = m.appendMsgpack(b)
+	}
+	return b, nil
+}
+
+func (m *exportedMetadata) appendMsgpack(b []byte) []byte {
+	fields := 0
+	for _, set := range []bool{m.Unit != "", m.Created != nil, m.Source != "", len(m.Tags) > 0} {
+		if set {
+			fields++
+		}
+	}
+
+	b = appendMsgpackMap(b, fields)
+	if m.Unit != "" {
+		b = appendMsgpackString(b, "unit")
+		b = appendMsgpackString(b, m.Unit)
+	}
+	if m.Created != nil {
+		b = appendMsgpackString(b, "created")
+		b = appendMsgpackTime(b, *m.Created)
+	}
+	if m.Source != "" {
+		b = appendMsgpackString(b, "source")
+		b = appendMsgpackString(b, m.Source)
+	}
+	if len(m.Tags) > 0 {
+		b = appendMsgpackString(b, "tags")
+		// Sorted like the metadata trailer, so that encodings can be
+		// hashed and compared.
+		keys := make([]string, 0, len(m.Tags))
+		for k := range m.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendMsgpackMap(b, len(keys))
+		for _, k := range keys {
+			b = appendMsgpackString(b, k)
+			b = appendMsgpackString(b, m.Tags[k])
+		}
+	}
+	return b
+}
+
+// UnmarshalMsgpack deserializes what MarshalMsgpack writes, validating it
+// the way UnmarshalJSON does. Numbers may use any msgpack representation,
+// so records re-encoded along a pipeline can still be read, and unknown
+// keys are ignored. It implements the Unmarshaler interface of the
+// vmihailenco/msgpack package.
+func (t *TDigest) UnmarshalMsgpack(data []byte) error {
+	r := msgpackReader{buf: data}
+	var j exportedDigest
+	for n := r.mapLen(); n > 0 && r.err == nil; n-- {
+		switch key := r.string(); key {
+		case "compression":
+			j.Compression = r.float()
+		case "count":
+			j.Count = r.uint()
+		case "means":
+			j.Means = make([]float64, r.arrayLen())
+			for i := range j.Means {
+				j.Means[i] = r.float()
+			}
+		case "counts":
+			j.Counts = make([]uint64, r.arrayLen())
+			for i := range j.Counts {
+				j.Counts[i] = r.uint()
+			}
+		case "convention":
+			j.Convention = r.optionalString()
+		case "scale":
+			j.Scale = r.optionalString()
+		case "metadata":
+			if !r.nil() {
+				j.Metadata = r.metadata()
+			}
+		default:
+			r.skip()
+		}
+	}
+	if r.err == nil && len(r.buf) > 0 {
+		r.err = errors.New("msgpack: unexpected data after the digest")
+	}
+	if r.err != nil {
+		return r.err
+	}
+	return t.restore(&j)
+}
+
+func (r *msgpackReader) metadata() *exportedMetadata {
+	m := &exportedMetadata{}
+	for n := r.mapLen(); n > 0 && r.err == nil; n-- {
+		switch key := r.string(); key {
+		case "unit":
+			m.Unit = r.optionalString()
+		case "created":
+			if !r.nil() {
+				created := r.time()
+				m.Created = &created
+			}
+		case "source":
+			m.Source = r.optionalString()
+		case "tags":
+			if r.nil() {
+				continue
+			}
+			tags := r.mapLen()
+			m.Tags = make(map[string]string, tags)
+			for ; tags > 0 && r.err == nil; tags-- {
+				k := r.string()
+				m.Tags[k] = r.string()
+			}
+		default:
+			r.skip()
+		}
+	}
+	return m
+}
+
+func appendMsgpackHeader(b []byte, n int, fix, c16, c32 byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return endianess.AppendUint16(append(b, c16), uint16(n))
+	default:
+		return endianess.AppendUint32(append(b, c32), uint32(n))
+	}
+}
+
+func appendMsgpackMap(b []byte, n int) []byte {
+	return appendMsgpackHeader(b, n, 0x80, 0xde, 0xdf)
+}
+
+func appendMsgpackArray(b []byte, n int) []byte {
+	return appendMsgpackHeader(b, n, 0x90, 0xdc, 0xdd)
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = endianess.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = endianess.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackFloat(b []byte, x float64) []byte {
+	return endianess.AppendUint64(append(b, 0xcb), math.Float64bits(x))
+}
+
+func appendMsgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 0x80:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return endianess.AppendUint16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return endianess.AppendUint32(append(b, 0xce), uint32(v))
+	default:
+		return endianess.AppendUint64(append(b, 0xcf), v)
+	}
+}
+
+// appendMsgpackTime appends ts as a 96 bit timestamp extension, which
+// holds any time.
+func appendMsgpackTime(b []byte, ts time.Time) []byte {
+	b = append(b, 0xc7, 12, 0xff)
+	b = endianess.AppendUint32(b, uint32(ts.Nanosecond()))
+	return endianess.AppendUint64(b, uint64(ts.Unix()))
+}
+
+// msgpackReader decodes the msgpack values a digest is made of,
+// remembering the first error so they can be read in a row and checked
+// once, like trailerReader.
+type msgpackReader struct {
+	buf []byte
+	err error
+}
+
+func (r *msgpackReader) fail(expected string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("msgpack: expected %s", expected)
+	}
+}
+
+func (r *msgpackReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.buf) {
+		r.err = errors.New("msgpack: unexpected end of data")
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *msgpackReader) next() byte {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// bigEndian reads an n byte unsigned integer.
+func (r *msgpackReader) bigEndian(n int) uint64 {
+	var v uint64
+	for _, c := range r.take(n) {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// length reads an n byte length of elements, which must each take at
+// least a byte of what's left, so that bogus lengths can't make callers
+// allocate much.
+func (r *msgpackReader) length(n int) int {
+	l := r.bigEndian(n)
+	if l > uint64(len(r.buf)) {
+		r.fail("fewer elements")
+		return 0
+	}
+	return int(l)
+}
+
+// nil consumes a nil value if there is one.
+func (r *msgpackReader) nil() bool {
+	if r.err == nil && len(r.buf) > 0 && r.buf[0] == 0xc0 {
+		r.buf = r.buf[1:]
+		return true
+	}
+	return false
+}
+
+func (r *msgpackReader) mapLen() int {
+	switch c := r.next(); {
+	case c >= 0x80 && c <= 0x8f:
+		return int(c & 0x0f)
+	case c == 0xde:
+		return r.length(2)
+	case c == 0xdf:
+		return r.length(4)
+	}
+	r.fail("a map")
+	return 0
+}
+
+func (r *msgpackReader) arrayLen() int {
+	switch c := r.next(); {
+	case c >= 0x90 && c <= 0x9f:
+		return int(c & 0x0f)
+	case c == 0xdc:
+		return r.length(2)
+	case c == 0xdd:
+		return r.length(4)
+	}
+	r.fail("an array")
+	return 0
+}
+
+func (r *msgpackReader) string() string {
+	var n int
+	switch c := r.next(); {
+	case c >= 0xa0 && c <= 0xbf:
+		n = int(c & 0x1f)
+	case c == 0xd9:
+		n = int(r.bigEndian(1))
+	case c == 0xda:
+		n = int(r.bigEndian(2))
+	case c == 0xdb:
+		n = int(r.bigEndian(4))
+	default:
+		r.fail("a string")
+		return ""
+	}
+	return string(r.take(n))
+}
+
+// optionalString is like string, reading nil as an empty string.
+func (r *msgpackReader) optionalString() string {
+	if r.nil() {
+		return ""
+	}
+	return r.string()
+}
+
+// number reads any integer or float, returning it as an uint64 or
+// int64 if it's an integer, or as a float64 otherwise.
+func (r *msgpackReader) number() (u uint64, i int64, f float64, kind byte) {
+	switch c := r.next(); {
+	case c <= 0x7f:
+		return uint64(c), 0, 0, 'u'
+	case c >= 0xe0:
+		return 0, int64(int8(c)), 0, 'i'
+	case c >= 0xcc && c <= 0xcf:
+		return r.bigEndian(1 << (c - 0xcc)), 0, 0, 'u'
+	case c >= 0xd0 && c <= 0xd3:
+		n := 1 << (c - 0xd0)
+		v := r.bigEndian(n)
+		// Sign extend the n byte integer.
+		shift := 64 - 8*n
+		return 0, int64(v<<shift) >> shift, 0, 'i'
+	case c == 0xca:
+		return 0, 0, float64(math.Float32frombits(uint32(r.bigEndian(4)))), 'f'
+	case c == 0xcb:
+		return 0, 0, math.Float64frombits(r.bigEndian(8)), 'f'
+	}
+	r.fail("a number")
+	return 0, 0, 0, 0
+}
+
+func (r *msgpackReader) float() float64 {
+	u, i, f, kind := r.number()
+	switch kind {
+	case 'u':
+		return float64(u)
+	case 'i':
+		return float64(i)
+	}
+	return f
+}
+
+func (r *msgpackReader) uint() uint64 {
+	u, i, _, kind := r.number()
+	switch kind {
+	case 'u':
+		return u
+	case 'i':
+		if i >= 0 {
+			return uint64(i)
+		}
+	}
+	r.fail("a non-negative integer")
+	return 0
+}
+
+// time reads a timestamp extension in any of its 32, 64 or 96 bit forms.
+func (r *msgpackReader) time() time.Time {
+	var size int
+	switch c := r.next(); c {
+	case 0xd6:
+		size = 4
+	case 0xd7:
+		size = 8
+	case 0xc7:
+		size = int(r.bigEndian(1))
+	default:
+		r.fail("a timestamp")
+		return time.Time{}
+	}
+	if r.next() != 0xff {
+		r.fail("a timestamp")
+		return time.Time{}
+	}
+
+	switch size {
+	case 4:
+		return time.Unix(int64(r.bigEndian(4)), 0).UTC()
+	case 8:
+		v := r.bigEndian(8)
+		return time.Unix(int64(v&(1<<34-1)), int64(v>>34)).UTC()
+	case 12:
+		nsec := r.bigEndian(4)
+		return time.Unix(int64(r.bigEndian(8)), int64(nsec)).UTC()
+	}
+	r.fail("a timestamp")
+	return time.Time{}
+}
+
+// skip consumes a value of any type. Nested values are counted rather
+// than recursed into, so deeply nested input can't exhaust the stack.
+func (r *msgpackReader) skip() {
+	for pending := 1; pending > 0 && r.err == nil; pending-- {
+		switch c := r.next(); {
+		case c <= 0x7f || c >= 0xe0 || c == 0xc0 || c == 0xc2 || c == 0xc3:
+		case c >= 0x80 && c <= 0x8f:
+			pending += 2 * int(c&0x0f)
+		case c >= 0x90 && c <= 0x9f:
+			pending += int(c & 0x0f)
+		case c >= 0xa0 && c <= 0xbf:
+			r.take(int(c & 0x1f))
+		case c == 0xc4 || c == 0xd9:
+			r.take(int(r.bigEndian(1)))
+		case c == 0xc5 || c == 0xda:
+			r.take(int(r.bigEndian(2)))
+		case c == 0xc6 || c == 0xdb:
+			r.take(int(r.bigEndian(4)))
+		case c == 0xc7:
+			r.take(int(r.bigEndian(1)) + 1)
+		case c == 0xc8:
+			r.take(int(r.bigEndian(2)) + 1)
+		case c == 0xc9:
+			r.take(int(r.bigEndian(4)) + 1)
+		case c == 0xca:
+			r.take(4)
+		case c == 0xcb:
+			r.take(8)
+		case c >= 0xcc && c <= 0xcf:
+			r.take(1 << (c - 0xcc))
+		case c >= 0xd0 && c <= 0xd3:
+			r.take(1 << (c - 0xd0))
+		case c >= 0xd4 && c <= 0xd8:
+			r.take(1 + 1<<(c-0xd4))
+		case c == 0xdc:
+			pending += r.length(2)
+		case c == 0xdd:
+			pending += r.length(4)
+		case c == 0xde:
+			pending += 2 * r.length(2)
+		case c == 0xdf:
+			pending += 2 * r.length(4)
+		default:
+			r.fail("a msgpack value")
+		}
+	}
+}
@@ -0,0 +1,131 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"encoding/hex"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	d := New(50, WithQuantileConvention(Sample), WithScaleFunction(uniformScale{}),
+		WithMetadata(Metadata{Unit: "ms", Created: created, Source: "api", Tags: map[string]string{"dc": "eu", "host": "a"}}))
+	for i := 0; i < 10000; i++ {
+		d.Add(rand.NormFloat64()*1e-3+1e6, uint64(1+i%300))
+	}
+
+	buf, err := d.MarshalMsgpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := New(100)
+	if err := got.UnmarshalMsgpack(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []float64{0, 0.01, 0.5, 0.99, 1} {
+		if got.Quantile(q) != d.Quantile(q) {
+			t.Errorf("Quantile(%v) = %v after a round trip, wanted exactly %v", q, got.Quantile(q), d.Quantile(q))
+		}
+	}
+	if got.compression != 50 || got.count != d.count || got.convention != Sample || !sameScale(got.scale, uniformScale{}) {
+		t.Errorf("Expected settings to survive, got %+v", got)
+	}
+	if !reflect.DeepEqual(got.Metadata(), d.Metadata()) {
+		t.Errorf("Expected metadata %+v, got %+v", d.Metadata(), got.Metadata())
+	}
+}
+
+func TestMsgpackDeterministic(t *testing.T) {
+	tags := map[string]string{}
+	for i := 0; i < 20; i++ {
+		tags[string(rune('a'+i))] = "v"
+	}
+	d := New(100, WithMetadata(Metadata{Tags: tags}))
+	d.Add(1, 1)
+	first, err := d.MarshalMsgpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if buf, _ := d.MarshalMsgpack(); string(buf) != string(first) {
+			t.Fatalf("Expected the same bytes on every call, got %x and %x", first, buf)
+		}
+	}
+}
+
+func TestMsgpackStructure(t *testing.T) {
+	d := New(100)
+	d.Add(1, 1)
+	d.Add(2.5, 300)
+	buf, err := d.MarshalMsgpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// {"compression": 100.0, "count": 301, "means": [1.0, 2.5], "counts": [1, 300]}
+	want := "84" +
+		"ab636f6d7072657373696f6e" + "cb4059000000000000" +
+		"a5636f756e74" + "cd012d" +
+		"a56d65616e73" + "92" + "cb3ff0000000000000" + "cb4004000000000000" +
+		"a6636f756e7473" + "92" + "01" + "cd012c"
+	if got := hex.EncodeToString(buf); got != want {
+		t.Errorf("Unexpected msgpack:\n%s\nwanted\n%s", got, want)
+	}
+}
+
+func TestMsgpackReencoded(t *testing.T) {
+	// The same digest as a pipeline might re-encode it, with compact
+	// numbers, nil options, a 64 bit timestamp and keys of its own.
+	b := appendMsgpackMap(nil, 8)
+	b = appendMsgpackString(b, "pipeline")
+	b = append(b, 0x92, 0x81, 0xa1, 'k', 0xc3, 0xc4, 0x02, 0xff, 0xff)
+	b = appendMsgpackString(b, "compression")
+	b = append(b, 0x64)
+	b = appendMsgpackString(b, "count")
+	b = append(b, 0xd1, 0x01, 0x2d)
+	b = appendMsgpackString(b, "means")
+	b = append(b, 0x92, 0xca)
+	b = endianess.AppendUint32(b, math.Float32bits(1))
+	b = appendMsgpackFloat(b, 2.5)
+	b = appendMsgpackString(b, "counts")
+	b = append(b, 0xdc, 0x00, 0x02, 0xd0, 0x01, 0xcd, 0x01, 0x2c)
+	b = appendMsgpackString(b, "convention")
+	b = append(b, 0xc0)
+	b = appendMsgpackString(b, "scale")
+	b = append(b, 0xc0)
+	b = appendMsgpackString(b, "metadata")
+	b = appendMsgpackMap(b, 2)
+	b = appendMsgpackString(b, "unit")
+	b = appendMsgpackString(b, "ms")
+	b = appendMsgpackString(b, "created")
+	b = append(b, 0xd7, 0xff)
+	b = endianess.AppendUint64(b, 5<<34|1577934245)
+
+	d := New(100, WithQuantileConvention(Sample))
+	if err := d.UnmarshalMsgpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if d.count != 301 || d.Len() != 2 || d.Quantile(1) != 2.5 || d.convention != Sample {
+		t.Errorf("Unexpected digest %+v", d)
+	}
+	if m := d.Metadata(); m.Unit != "ms" || !m.Created.Equal(time.Date(2020, 1, 2, 3, 4, 5, 5, time.UTC)) {
+		t.Errorf("Unexpected metadata %+v", m)
+	}
+
+	for name, bad := range map[string][]byte{
+		"trailing data":  append(append([]byte(nil), b...), 0xc0),
+		"truncated":      b[:len(b)-1],
+		"not a map":      {0x90},
+		"negative count": append(appendMsgpackString([]byte{0x81}, "count"), 0xff),
+		"count mismatch": append(appendMsgpackString([]byte{0x81}, "count"), 0x01),
+		"huge array":     append(appendMsgpackString([]byte{0x81}, "means"), 0xdd, 0xff, 0xff, 0xff, 0xff),
+	} {
+		if err := new(TDigest).UnmarshalMsgpack(bad); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
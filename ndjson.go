@@ -0,0 +1,81 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ndjsonLine is a digest as written in an NDJSON stream. The digest is
+// base64 encoded by encoding/json.
+type ndjsonLine struct {
+	Key    string    `json:"key"`
+	Time   time.Time `json:"time"`
+	Digest []byte    `json:"digest"`
+}
+
+// maxNDJSONLine bounds the size of a line read by NDJSONReader.
+const maxNDJSONLine = 64 << 20
+
+// NDJSONWriter writes digests as newline-delimited JSON, one object per
+// line with a "key", a "time" in RFC 3339 format and a base64 encoded
+// "digest" as serialized by ToBytes.
+type NDJSONWriter struct {
+	enc *json.Encoder
+}
+
+// NewNDJSONWriter creates an NDJSONWriter writing to w.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes d as a single line.
+func (w *NDJSONWriter) Write(d StoredDigest) error {
+	return w.enc.Encode(ndjsonLine{Key: d.Key, Time: d.Time, Digest: d.Digest.ToBytes(nil)})
+}
+
+// NDJSONReader reads digests written by NDJSONWriter. Blank lines are
+// skipped.
+type NDJSONReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewNDJSONReader creates an NDJSONReader reading from r.
+func NewNDJSONReader(r io.Reader) *NDJSONReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxNDJSONLine)
+	return &NDJSONReader{scanner: scanner}
+}
+
+// Read returns the next digest of the stream, or io.EOF once there are
+// none left.
+func (r *NDJSONReader) Read() (StoredDigest, error) {
+	for r.scanner.Scan() {
+		r.line++
+		buf := r.scanner.Bytes()
+		if len(bytes.TrimSpace(buf)) == 0 {
+			continue
+		}
+
+		var line ndjsonLine
+		if err := json.Unmarshal(buf, &line); err != nil {
+			return StoredDigest{}, fmt.Errorf("line %d: %v", r.line, err)
+		}
+		d, err := decodeStored(line.Digest)
+		if err != nil {
+			return StoredDigest{}, fmt.Errorf("line %d: %v", r.line, err)
+		}
+		return StoredDigest{Key: line.Key, Time: line.Time, Digest: d}, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return StoredDigest{}, err
+	}
+	return StoredDigest{}, io.EOF
+}
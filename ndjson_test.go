@@ -0,0 +1,51 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNDJSON(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	w := NewNDJSONWriter(&buf)
+	for i := 0; i < 3; i++ {
+		d := New(100)
+		d.Add(float64(i), uint64(i+1))
+		if err := w.Write(StoredDigest{Key: "latency", Time: base.Add(time.Duration(i) * time.Minute), Digest: d}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 3 {
+		t.Errorf("Expected one line per digest, got %d lines", lines)
+	}
+
+	r := NewNDJSONReader(strings.NewReader(strings.Replace(buf.String(), "\n", "\n\n", 1)))
+	for i := 0; i < 3; i++ {
+		d, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Key != "latency" || !d.Time.Equal(base.Add(time.Duration(i)*time.Minute)) {
+			t.Errorf("Unexpected key or time %q %v", d.Key, d.Time)
+		}
+		if d.Digest.count != uint64(i+1) || d.Digest.Quantile(0.5) != float64(i) {
+			t.Errorf("Unexpected digest %d: count %d, median %v", i, d.Digest.count, d.Digest.Quantile(0.5))
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Expected io.EOF at the end of the stream, got %v", err)
+	}
+
+	r = NewNDJSONReader(strings.NewReader(`{"key": "x", "digest": "AAAA"}`))
+	if _, err := r.Read(); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Expected an error for a bad digest, got %v", err)
+	}
+}
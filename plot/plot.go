@@ -0,0 +1,108 @@
+//go:build !tdigest_lite
+
+// Package plot samples the distribution a digest estimates into series of
+// points for plotting. The series implement the XYer interface of
+// gonum.org/v1/plot/plotter, so that they can be given to its plotters
+// as they are:
+//
+//	line, err := plotter.NewLine(plot.CDF(d, 100))
+//
+// This package doesn't depend on gonum, but Go interfaces don't need it to.
+package plot
+
+import "math"
+
+// Digest is the part of tdigest.TDigest and tdigest.FrozenDigest the
+// series are sampled from.
+type Digest interface {
+	Quantile(q float64) float64
+	CDF(x float64) float64
+}
+
+// XY is a point of a series.
+type XY struct {
+	X, Y float64
+}
+
+// XYs is a series of points, in increasing order of X.
+type XYs []XY
+
+// Len returns the number of points of the series.
+func (xys XYs) Len() int {
+	return len(xys)
+}
+
+// XY returns the coordinates of the i-th point of the series.
+func (xys XYs) XY(i int) (x, y float64) {
+	return xys[i].X, xys[i].Y
+}
+
+// CDF samples the cumulative distribution function of d at n evenly
+// spaced values, from the smallest to the largest value of d. It returns
+// nil for an empty digest, and a single point for a digest of one value.
+// n must be at least 2.
+func CDF(d Digest, n int) XYs {
+	lo, hi, ok := bounds(d, n)
+	if !ok {
+		return nil
+	}
+	if lo == hi {
+		return XYs{{lo, 1}}
+	}
+	xys := make(XYs, n)
+	for i := range xys {
+		x := lo + (hi-lo)*float64(i)/float64(n-1)
+		xys[i] = XY{x, d.CDF(x)}
+	}
+	return xys
+}
+
+// PDF estimates the probability density function of d over n bins of
+// equal width, from the smallest to the largest value of d, as the
+// fraction of the samples in each bin divided by its width. Points are
+// placed at the middle of their bin. It returns nil for an empty digest,
+// and for a digest of one value since its density is not defined. n must
+// be at least 2.
+func PDF(d Digest, n int) XYs {
+	lo, hi, ok := bounds(d, n)
+	if !ok || lo == hi {
+		return nil
+	}
+	width := (hi - lo) / float64(n)
+	xys := make(XYs, n)
+	prev := 0.0
+	for i := range xys {
+		next := 1.0
+		if i < n-1 {
+			next = d.CDF(lo + width*float64(i+1))
+		}
+		xys[i] = XY{lo + width*(float64(i)+0.5), (next - prev) / width}
+		prev = next
+	}
+	return xys
+}
+
+// Quantile samples the quantile function of d at n evenly spaced
+// quantiles, from 0 to 1. It returns nil for an empty digest. n must be at
+// least 2.
+func Quantile(d Digest, n int) XYs {
+	if _, _, ok := bounds(d, n); !ok {
+		return nil
+	}
+	xys := make(XYs, n)
+	for i := range xys {
+		q := float64(i) / float64(n-1)
+		xys[i] = XY{q, d.Quantile(q)}
+	}
+	return xys
+}
+
+// bounds returns the smallest and largest values of d, and whether it
+// holds any.
+func bounds(d Digest, n int) (lo, hi float64, ok bool) {
+	if n < 2 {
+		panic("n must be at least 2")
+	}
+	lo, hi = d.Quantile(0), d.Quantile(1)
+	return lo, hi, !math.IsNaN(lo)
+}
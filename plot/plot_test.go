@@ -0,0 +1,82 @@
+//go:build !tdigest_lite
+
+package plot
+
+import (
+	"math"
+	"testing"
+
+	tdigest "github.com/honeycombio/go-tdigest"
+)
+
+// xyer is the XYer interface of gonum.org/v1/plot/plotter.
+type xyer interface {
+	Len() int
+	XY(int) (x, y float64)
+}
+
+var _ xyer = XYs(nil)
+
+func TestSeries(t *testing.T) {
+	d := tdigest.New(100)
+	for i := 0; i <= 10000; i++ {
+		d.Add(float64(i)/100, 1)
+	}
+	f := d.Freeze()
+
+	cdf := CDF(f, 11)
+	if cdf.Len() != 11 {
+		t.Fatalf("Expected 11 points, got %d", cdf.Len())
+	}
+	for i := 0; i < cdf.Len(); i++ {
+		x, y := cdf.XY(i)
+		if math.Abs(x-float64(10*i)) > 1e-9 || math.Abs(y-x/100) > 0.01 {
+			t.Errorf("Expected the CDF at %v to be about %v, got %v", x, x/100, y)
+		}
+	}
+
+	pdf := PDF(d, 10)
+	total := 0.0
+	for i, p := range pdf {
+		if math.Abs(p.X-float64(10*i+5)) > 1e-9 || math.Abs(p.Y-0.01) > 0.002 {
+			t.Errorf("Expected a density of about 0.01 at %v, got %v", p.X, p.Y)
+		}
+		total += p.Y * 10
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("Expected the density to integrate to 1, got %v", total)
+	}
+
+	qf := Quantile(f, 5)
+	for i, p := range qf {
+		if p.X != float64(i)/4 || math.Abs(p.Y-100*p.X) > 1 {
+			t.Errorf("Expected the quantile %v to be about %v, got %v", p.X, 100*p.X, p.Y)
+		}
+	}
+}
+
+func TestDegenerateSeries(t *testing.T) {
+	empty := tdigest.New(100)
+	if CDF(empty, 10) != nil || PDF(empty, 10) != nil || Quantile(empty, 10) != nil {
+		t.Errorf("Expected no points for an empty digest")
+	}
+
+	one := tdigest.New(100)
+	one.Add(3, 5)
+	if xys := CDF(one, 10); len(xys) != 1 || xys[0] != (XY{3, 1}) {
+		t.Errorf("Expected a single CDF point for a single value, got %v", xys)
+	}
+	if PDF(one, 10) != nil {
+		t.Errorf("Expected no density for a single value")
+	}
+	if xys := Quantile(one, 10); len(xys) != 10 || xys[9].Y != 3 {
+		t.Errorf("Expected a flat quantile function, got %v", xys)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic for fewer than 2 points")
+		}
+	}()
+	CDF(one, 1)
+}
@@ -0,0 +1,116 @@
+package tdigest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const quantizedEncoding int32 = 4
+
+// QuantizedEncoding is a lossy encoding rounding centroid means to
+// multiples of a fixed step, see WithQuantizedEncoding. Other
+// implementations can't read it.
+const QuantizedEncoding = Encoding(quantizedEncoding)
+
+// maxQuantum bounds the multiples of the step means are rounded to, so
+// that differences between them never overflow.
+const maxQuantum = 1 << 61
+
+// WithQuantizedEncoding makes ToBytes and AsBytes round centroid means to
+// the nearest multiple of step, storing them as small integers. Payloads
+// then take a byte or two per mean instead of four, at the price of
+// moving every mean by at most step/2. Quantile estimates move by about
+// as much, except around centroids closer together than step: their means
+// may round to the same value, in which case they are combined, and the
+// estimates nearby can move by up to the distance to the neighbouring
+// centroids. Pick a step no coarser than the resolution the values are
+// read at, e.g. a microsecond for latencies in seconds.
+func WithQuantizedEncoding(step float64) Option {
+	return func(t *TDigest) error {
+		if !(step > 0) || math.IsInf(step, 0) {
+			return errors.New("quantization step must be positive and finite")
+		}
+		t.output = QuantizedEncoding
+		t.quantum = step
+		return nil
+	}
+}
+
+// appendQuantizedMeans appends the step followed by the zigzag varint
+// deltas between the rounded means.
+func appendQuantizedMeans(b []byte, means []float64, step float64) []byte {
+	b = endianess.AppendUint64(b, math.Float64bits(step))
+	var prev int64
+	for _, mean := range means {
+		q := int64(math.Max(-maxQuantum, math.Min(maxQuantum, math.Round(mean/step))))
+		b = binary.AppendVarint(b, q-prev)
+		prev = q
+	}
+	return b
+}
+
+// decodeQuantizedMeans fills means from what appendQuantizedMeans wrote,
+// returning the number of bytes read.
+func decodeQuantizedMeans(buf []byte, means []float64) (int, error) {
+	if len(buf) < 8 {
+		return 0, errors.New("buffer too small for deserialization")
+	}
+	step := math.Float64frombits(endianess.Uint64(buf))
+	if !(step > 0) || math.IsInf(step, 0) {
+		return 0, errors.New("bad quantization step in serialization")
+	}
+
+	idx := 8
+	var q int64
+	for i := range means {
+		delta, read := binary.Varint(buf[idx:])
+		if read < 1 {
+			return 0, errors.New("error decoding varint")
+		}
+		idx += read
+		q += delta
+		means[i] = float64(q) * step
+	}
+	return idx, nil
+}
+
+// readQuantizedMeans is like decodeQuantizedMeans, reading from buf.
+func readQuantizedMeans(buf *bytes.Reader, means []float64) error {
+	var step float64
+	if err := binary.Read(buf, endianess, &step); err != nil {
+		return err
+	}
+	if !(step > 0) || math.IsInf(step, 0) {
+		return errors.New("bad quantization step in serialization")
+	}
+
+	var q int64
+	for i := range means {
+		delta, err := binary.ReadVarint(buf)
+		if err != nil {
+			return err
+		}
+		q += delta
+		means[i] = float64(q) * step
+	}
+	return nil
+}
+
+// combineEqualMeans merges neighbouring centroids sharing a mean, which
+// quantization can produce.
+func (s *summary) combineEqualMeans() {
+	n := 0
+	for i := range s.keys {
+		if n > 0 && s.keys[i] == s.keys[n-1] {
+			s.counts[n-1] += s.counts[i]
+			continue
+		}
+		s.keys[n] = s.keys[i]
+		s.counts[n] = s.counts[i]
+		n++
+	}
+	s.keys = s.keys[:n]
+	s.counts = s.counts[:n]
+}
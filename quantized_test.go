@@ -0,0 +1,69 @@
+package tdigest
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestQuantizedEncoding(t *testing.T) {
+	const step = 0.01
+	t1 := New(100, WithQuantizedEncoding(step))
+	for i := 0; i < 10000; i++ {
+		t1.Add(rand.Float64()*1000, 1)
+	}
+
+	quantized := t1.ToBytes(nil)
+	asBytes, err := t1.AsBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(quantized, asBytes) {
+		t.Errorf("AsBytes serialized to something else than ToBytes")
+	}
+
+	t1.output = SmallEncoding
+	if small := t1.ToBytes(nil); len(quantized) >= len(small) {
+		t.Errorf("Expected the quantized encoding to be smaller. Got %d bytes, %d with the small encoding", len(quantized), len(small))
+	}
+
+	t2, err := FromBytes(bytes.NewReader(quantized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t3 := &TDigest{}
+	if err := t3.FromBytes(quantized); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(t2.summary.keys, t3.summary.keys) || !reflect.DeepEqual(t2.summary.counts, t3.summary.counts) {
+		t.Errorf("Both FromBytes should decode to the same centroids")
+	}
+
+	// Means move by step/2 at most, estimates slightly more where
+	// centroids got combined.
+	for i, mean := range t1.summary.keys {
+		if j := t3.summary.FindIndex(mean - step/2); j >= t3.Len() || math.Abs(t3.summary.keys[j]-mean) > step/2+1e-9 {
+			t.Fatalf("Mean %d (%v) moved by more than step/2", i, mean)
+		}
+	}
+	for _, q := range []float64{0, 0.01, 0.5, 0.99, 1} {
+		if diff := math.Abs(t3.Quantile(q) - t1.Quantile(q)); diff > 0.5 {
+			t.Errorf("Quantile(%v) moved by %v", q, diff)
+		}
+	}
+
+	// A step coarser than the data combines centroids, but keeps counts.
+	coarse := New(100, WithQuantizedEncoding(100))
+	coarse.summary, coarse.count = t1.summary, t1.count
+	if err := t3.FromBytes(coarse.ToBytes(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if t3.Len() > 11 || t3.count != t1.count {
+		t.Errorf("Expected at most 11 centroids holding %d samples, got %d holding %d", t1.count, t3.Len(), t3.count)
+	}
+
+	shouldPanic(func() { New(100, WithQuantizedEncoding(0)) }, t, "A zero step should panic!")
+	shouldPanic(func() { New(100, WithEncoding(QuantizedEncoding)) }, t, "QuantizedEncoding without a step should panic!")
+}
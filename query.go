@@ -0,0 +1,67 @@
+package tdigest
+
+import "errors"
+
+// QueryCompressionPolicy decides whether a digest compresses itself before
+// answering a query. Add only compresses once the summary holds about 20
+// times the compression in centroids, so queries usually run against a
+// summary larger than needed; compressing first makes them cheaper and
+// slightly more consistent, at the cost of an occasional expensive query.
+type QueryCompressionPolicy interface {
+	// CompressBeforeQuery reports whether a digest of the given
+	// compression, whose summary holds the given number of centroids,
+	// should be compressed before being queried.
+	CompressBeforeQuery(centroids int, compression float64) bool
+}
+
+type queryCompressionFunc func(centroids int, compression float64) bool
+
+func (f queryCompressionFunc) CompressBeforeQuery(centroids int, compression float64) bool {
+	return f(centroids, compression)
+}
+
+var (
+	// NeverCompressOnQuery leaves compression to Add and explicit calls to
+	// Compress. It is the default.
+	NeverCompressOnQuery QueryCompressionPolicy = queryCompressionFunc(func(int, float64) bool { return false })
+
+	// AlwaysCompressOnQuery compresses before every query.
+	AlwaysCompressOnQuery QueryCompressionPolicy = queryCompressionFunc(func(int, float64) bool { return true })
+)
+
+// CompressOnQueryAbove compresses before a query when the summary holds
+// more than the given number of centroids.
+func CompressOnQueryAbove(centroids int) QueryCompressionPolicy {
+	return queryCompressionFunc(func(n int, _ float64) bool { return n > centroids })
+}
+
+// WithQueryCompression sets when the digest compresses itself before a
+// query.
+func WithQueryCompression(policy QueryCompressionPolicy) Option {
+	return func(t *TDigest) error {
+		if policy == nil {
+			return errors.New("QueryCompressionPolicy must not be nil")
+		}
+		t.queryCompression = policy
+		return nil
+	}
+}
+
+// prepareQuery is called by the query methods before they read the
+// summary.
+func (t *TDigest) prepareQuery() {
+	t.settle()
+	if t.queryCompression != nil && t.queryCompression.CompressBeforeQuery(t.summary.Len(), t.compression) {
+		t.Compress()
+	}
+}
+
+// queryReady reports whether the query methods can run without modifying
+// the digest, i.e. without settling a background compression, folding in
+// buffered samples or compressing first, so that concurrent queries are safe.
+func (t *TDigest) queryReady() bool {
+	if t.pending != nil || t.buffered() {
+		return false
+	}
+	return t.queryCompression == nil || !t.queryCompression.CompressBeforeQuery(t.summary.Len(), t.compression)
+}
@@ -0,0 +1,46 @@
+package tdigest
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestQueryCompression(t *testing.T) {
+	fill := func(d *TDigest) *TDigest {
+		for i := 0; i < 1000; i++ {
+			d.Add(rand.Float64(), 1)
+		}
+		return d
+	}
+
+	never := fill(New(10))
+	before := never.Len()
+	never.Quantile(0.5)
+	if never.Len() != before {
+		t.Errorf("Queries should not compress by default")
+	}
+
+	always := fill(New(10, WithQueryCompression(AlwaysCompressOnQuery)))
+	before = always.Len()
+	always.Quantile(0.5)
+	if always.Len() >= before {
+		t.Errorf("Expected AlwaysCompressOnQuery to compress. Got %d centroids, had %d", always.Len(), before)
+	}
+
+	above := fill(New(10, WithQueryCompression(CompressOnQueryAbove(1000))))
+	before = above.Len()
+	above.Quantile(0.5)
+	if above.Len() != before {
+		t.Errorf("Expected no compression below the threshold")
+	}
+
+	above = fill(New(10, WithQueryCompression(CompressOnQueryAbove(50))))
+	before = above.Len()
+	above.Quantile(0.5)
+	if above.Len() >= before {
+		t.Errorf("Expected compression above the threshold. Got %d centroids, had %d", above.Len(), before)
+	}
+	assertDifferenceSmallerThan(above, 0.5, 0.05, t)
+
+	shouldPanic(func() { New(10, WithQueryCompression(nil)) }, t, "A nil policy should panic!")
+}
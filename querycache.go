@@ -0,0 +1,94 @@
+package tdigest
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// queryCacheSize bounds the number of quantiles a cache remembers. Past
+// it, the cache starts over, which only costs recomputing the quantiles
+// still being asked for.
+const queryCacheSize = 64
+
+// WithQueryCache makes Quantile remember its results, so that asking for
+// the same quantiles over and over, as dashboards do, doesn't recompute
+// them every time. A result is reused for as long as the digest doesn't
+// change. With a positive ttl, it is also reused when the digest changed
+// but the result is less than ttl old, trading staleness for even fewer
+// computations on digests that keep getting samples; with a ttl of 0,
+// results are never stale.
+//
+// The cache is safe for the concurrent queries ConcurrentTDigest allows.
+func WithQueryCache(ttl time.Duration) Option {
+	return func(t *TDigest) error {
+		if ttl < 0 {
+			return errors.New("query cache TTL must not be negative")
+		}
+		t.cache = &queryCache{ttl: ttl}
+		return nil
+	}
+}
+
+type queryCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[float64]cachedQuantile
+}
+
+type cachedQuantile struct {
+	value      float64
+	generation uint64
+	computed   time.Time
+}
+
+// Generation returns a number that grows every time the digest changes:
+// when samples are added, digests merged in, the centroids compressed or
+// replaced by deserialization, or the metadata set. Caches and replication
+// layers can compare it to the generation they last saw to detect changes
+// without looking at the contents. Generations start at 0 and aren't
+// serialized, so they're only meaningful for a single instance.
+func (t *TDigest) Generation() uint64 {
+	return t.generation
+}
+
+// modified records that the digest changed, invalidating the results
+// cached so far.
+func (t *TDigest) modified() {
+	t.generation++
+}
+
+// get returns the value cached for q, if still valid for a digest of the
+// given generation.
+func (c *queryCache) get(q float64, generation uint64) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[q]
+	if !ok {
+		return 0, false
+	}
+	if e.generation == generation || (c.ttl > 0 && time.Since(e.computed) < c.ttl) {
+		return e.value, true
+	}
+	return 0, false
+}
+
+// put caches the value of q for a digest of the given generation.
+func (c *queryCache) put(q, value float64, generation uint64) {
+	// NaN keys could never be found again.
+	if math.IsNaN(q) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || len(c.entries) >= queryCacheSize {
+		c.entries = make(map[float64]cachedQuantile)
+	}
+	e := cachedQuantile{value: value, generation: generation}
+	if c.ttl > 0 {
+		e.computed = time.Now()
+	}
+	c.entries[q] = e
+}
@@ -0,0 +1,158 @@
+package tdigest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryCache(t *testing.T) {
+	tdigest := New(100, WithQueryCache(0))
+	for i := 1; i <= 100; i++ {
+		tdigest.Add(float64(i), 1)
+	}
+
+	want := tdigest.Quantile(0.5)
+	generation := tdigest.generation
+	if got := tdigest.Quantile(0.5); got != want {
+		t.Errorf("Expected the cached median %v, got %v", want, got)
+	}
+	if e, ok := tdigest.cache.entries[0.5]; !ok || e.generation != generation {
+		t.Errorf("Expected the median to be cached, got %+v", tdigest.cache.entries)
+	}
+
+	other := New(100)
+	other.Add(5, 1)
+	for _, mutate := range []func(){
+		func() { tdigest.Add(1000, 100) },
+		func() { tdigest.Merge(other) },
+		func() { tdigest.Compress() },
+		func() { tdigest.FromBytes(other.ToBytes(nil)) },
+	} {
+		before := tdigest.generation
+		mutate()
+		if tdigest.generation == before {
+			t.Errorf("Expected the generation to change")
+		}
+	}
+	if got := tdigest.Quantile(0.5); got != 5 {
+		t.Errorf("Expected the cache to be invalidated, got a median of %v", got)
+	}
+
+	for i := 0; i < queryCacheSize*2; i++ {
+		tdigest.Quantile(float64(i) / (queryCacheSize * 2))
+	}
+	if n := len(tdigest.cache.entries); n > queryCacheSize {
+		t.Errorf("Expected at most %d cached quantiles, got %d", queryCacheSize, n)
+	}
+}
+
+func TestQueryCacheTTL(t *testing.T) {
+	tdigest := New(100, WithQueryCache(time.Hour))
+	tdigest.Add(1, 1)
+	if got := tdigest.Quantile(1); got != 1 {
+		t.Fatalf("Expected a maximum of 1, got %v", got)
+	}
+
+	// Results younger than the TTL survive changes to the digest.
+	tdigest.Add(2, 1)
+	if got := tdigest.Quantile(1); got != 1 {
+		t.Errorf("Expected the stale maximum 1, got %v", got)
+	}
+
+	e := tdigest.cache.entries[1]
+	e.computed = e.computed.Add(-2 * time.Hour)
+	tdigest.cache.entries[1] = e
+	if got := tdigest.Quantile(1); got != 2 {
+		t.Errorf("Expected the expired result to be recomputed, got %v", got)
+	}
+}
+
+func TestQueryCacheConcurrent(t *testing.T) {
+	c := NewConcurrent(100, WithQueryCache(0))
+	for i := 0; i < 1000; i++ {
+		c.Add(float64(i), 1)
+	}
+
+	done := make(chan bool)
+	for r := 0; r < 4; r++ {
+		go func() {
+			for i := 0; i < 1000; i++ {
+				c.Quantile(float64(i%10) / 10)
+			}
+			done <- true
+		}()
+	}
+	for r := 0; r < 4; r++ {
+		<-done
+	}
+
+	// Snapshots don't share the cache of the digest.
+	s := c.Snapshot()
+	s.Add(1e6, 1000)
+	s.Quantile(0.9)
+	c.Do(func(d *TDigest) {
+		if s.cache == d.cache {
+			t.Errorf("Expected snapshots to have a cache of their own")
+		}
+	})
+	if c.Quantile(0.9) > 1000 {
+		t.Errorf("Expected changes to the snapshot not to reach the cache of the digest")
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	tdigest := New(100)
+	if g := tdigest.Generation(); g != 0 {
+		t.Errorf("Expected new digests to start at generation 0, got %d", g)
+	}
+
+	last := tdigest.Generation()
+	for _, tc := range []struct {
+		name   string
+		mutate func()
+	}{
+		{"Add", func() { tdigest.Add(1, 1) }},
+		{"AddBatch", func() { tdigest.AddBatch([]float64{2, 3}) }},
+		{"Merge", func() { tdigest.Merge(New(100, WithMetadata(Metadata{Source: "a"}))) }},
+		{"Compress", func() { tdigest.Compress() }},
+		{"SetMetadata", func() { tdigest.SetMetadata(&Metadata{Unit: "ms"}) }},
+		{"FromBytes", func() { tdigest.FromBytes(tdigest.ToBytes(nil)) }},
+	} {
+		tc.mutate()
+		if g := tdigest.Generation(); g <= last {
+			t.Errorf("%s: expected the generation to grow past %d, got %d", tc.name, last, g)
+		}
+		last = tdigest.Generation()
+	}
+
+	tdigest.Quantile(0.5)
+	tdigest.ToBytes(nil)
+	if tdigest.Generation() != last {
+		t.Errorf("Expected queries and serialization not to change the generation")
+	}
+
+	c := NewConcurrent(100)
+	s := NewSharded(4, 100)
+	c.Add(1, 1)
+	s.Add(1, 1)
+	if c.Generation() == 0 || s.Generation() == 0 {
+		t.Errorf("Expected concurrent digests to report changes")
+	}
+}
+
+func TestWithQueryCacheRejectsNegativeTTL(t *testing.T) {
+	if _, err := newWithOptions(100, []Option{WithQueryCache(-time.Second)}); err == nil {
+		t.Errorf("Expected a negative TTL to be rejected")
+	}
+}
+
+func BenchmarkQuantileCached(b *testing.B) {
+	tdigest := New(100, WithQueryCache(0))
+	for i := 0; i < 100000; i++ {
+		tdigest.Add(float64(i), 1)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		tdigest.Quantile(0.99)
+	}
+}
@@ -0,0 +1,115 @@
+package tdigest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ratioGrid is the number of quantiles of each digest Ratio.Distribution
+// pairs up, so that it estimates the ratios from ratioGrid² of them.
+const ratioGrid = 100
+
+// Ratio keeps the distributions of the numerators and denominators of a
+// ratio metric, such as the errors and requests of every interval for an
+// error rate, or the work done and resources used for an efficiency.
+type Ratio struct {
+	Numerator   *TDigest
+	Denominator *TDigest
+}
+
+// NewRatio creates a Ratio whose digests are created by New with the given
+// compression and options. It panics on invalid ones, as New does.
+func NewRatio(compression float64, options ...Option) *Ratio {
+	return &Ratio{
+		Numerator:   New(compression, options...),
+		Denominator: New(compression, options...),
+	}
+}
+
+// Add registers an observation of the ratio metric. Neither value is added
+// if either is invalid.
+func (r *Ratio) Add(numerator, denominator float64) error {
+	if math.IsNaN(numerator) || math.IsNaN(denominator) {
+		return fmt.Errorf("Illegal ratio <numerator: %.4f, denominator: %.4f>", numerator, denominator)
+	}
+	if err := r.Numerator.Add(numerator, 1); err != nil {
+		return err
+	}
+	return r.Denominator.Add(denominator, 1)
+}
+
+// Merge joins the numerators and denominators of other into those of r.
+func (r *Ratio) Merge(other *Ratio) error {
+	if err := r.Numerator.Merge(other.Numerator); err != nil {
+		return err
+	}
+	return r.Denominator.Merge(other.Denominator)
+}
+
+// NumeratorQuantile returns the estimated numerator at quantile q.
+func (r *Ratio) NumeratorQuantile(q float64) float64 {
+	return r.Numerator.Quantile(q)
+}
+
+// DenominatorQuantile returns the estimated denominator at quantile q.
+func (r *Ratio) DenominatorQuantile(q float64) float64 {
+	return r.Denominator.Quantile(q)
+}
+
+// MeanRatio returns the ratio of the sums of numerators and denominators,
+// the ratio over every observation together, such as the overall error
+// rate. It is NaN when there are no observations.
+func (r *Ratio) MeanRatio() float64 {
+	if r.Denominator.count == 0 {
+		return math.NaN()
+	}
+	return r.Numerator.Sum() / r.Denominator.Sum()
+}
+
+// Distribution estimates the distribution of the ratio of a numerator to
+// a denominator, taking them to be independent: it divides evenly spaced
+// quantiles of the numerators by evenly spaced quantiles of the
+// denominators, skipping zero denominators, and summarizes the results.
+// Numerators and denominators that grow together, as errors do with
+// requests, make it spread wider than the actual ratios. It fails if a
+// digest is empty or every denominator is zero.
+func (r *Ratio) Distribution() (*TDigest, error) {
+	if r.Numerator.count == 0 || r.Denominator.count == 0 {
+		return nil, errors.New("ratio has no observations")
+	}
+	numerators, denominators := make([]float64, ratioGrid), make([]float64, 0, ratioGrid)
+	for i := range numerators {
+		q := (float64(i) + 0.5) / ratioGrid
+		numerators[i] = r.Numerator.Quantile(q)
+		if d := r.Denominator.Quantile(q); d != 0 {
+			denominators = append(denominators, d)
+		}
+	}
+	if len(denominators) == 0 {
+		return nil, errors.New("every denominator is zero")
+	}
+
+	ratios := make([]float64, 0, len(numerators)*len(denominators))
+	for _, n := range numerators {
+		for _, d := range denominators {
+			if ratio := n / d; !math.IsNaN(ratio) {
+				ratios = append(ratios, ratio)
+			}
+		}
+	}
+	return FromSamples(ratios, Compression(math.Max(r.Numerator.compression, r.Denominator.compression)))
+}
+
+// Quantile returns the estimated ratio at quantile q of the Distribution,
+// or NaN if it can't be estimated.
+func (r *Ratio) Quantile(q float64) float64 {
+	if q < 0 || q > 1 {
+		panic("q must be between 0 and 1 (inclusive)")
+	}
+	d, err := r.Distribution()
+	if err != nil {
+		return math.NaN()
+	}
+	return d.Quantile(q)
+}
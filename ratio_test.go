@@ -0,0 +1,69 @@
+package tdigest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRatio(t *testing.T) {
+	r := NewRatio(100)
+	if !math.IsNaN(r.MeanRatio()) || !math.IsNaN(r.Quantile(0.5)) {
+		t.Errorf("Expected NaN ratios without observations")
+	}
+	if _, err := r.Distribution(); err == nil {
+		t.Errorf("Expected no distribution without observations")
+	}
+
+	for i := 0; i < 10000; i++ {
+		if err := r.Add(float64(i%101)/10, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Add(math.NaN(), 1); err == nil {
+		t.Errorf("Expected a NaN numerator to be rejected")
+	}
+	if r.Numerator.count != 10000 || r.Denominator.count != 10000 {
+		t.Errorf("Expected rejected observations not to be added to either digest")
+	}
+
+	if m := r.MeanRatio(); math.Abs(m-0.05) > 1e-3 {
+		t.Errorf("Expected a mean ratio of about 0.05, got %v", m)
+	}
+	if q := r.NumeratorQuantile(0.5); math.Abs(q-5) > 0.2 {
+		t.Errorf("Expected a median numerator of about 5, got %v", q)
+	}
+	if q := r.DenominatorQuantile(0.5); q != 100 {
+		t.Errorf("Expected a median denominator of 100, got %v", q)
+	}
+	for _, q := range []float64{0.1, 0.5, 0.9} {
+		if v := r.Quantile(q); math.Abs(v-q/10) > 0.003 {
+			t.Errorf("Expected the ratio at %v to be about %v, got %v", q, q/10, v)
+		}
+	}
+
+	other := NewRatio(100)
+	other.Add(1, 2)
+	if err := r.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	if r.Numerator.count != 10001 || r.Denominator.Quantile(0) != 2 {
+		t.Errorf("Expected both digests to be merged")
+	}
+}
+
+func TestRatioZeroDenominators(t *testing.T) {
+	r := NewRatio(100)
+	r.Add(1, 0)
+	if _, err := r.Distribution(); err == nil {
+		t.Errorf("Expected no distribution when every denominator is zero")
+	}
+
+	r.Add(1, 4)
+	d, err := r.Distribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Quantile(0) != 0.25 || d.Quantile(1) != 0.25 {
+		t.Errorf("Expected zero denominators to be skipped, got ratios from %v to %v", d.Quantile(0), d.Quantile(1))
+	}
+}
@@ -0,0 +1,55 @@
+package tdigest
+
+import "errors"
+
+// WithRecentValueCache makes Add remember the positions of the last size
+// distinct values it saw that exactly match a centroid mean. Adding one of
+// those values again then skips the centroid search altogether, which pays
+// off for workloads with long runs of identical (typically quantized)
+// values. Digest contents are the same with or without the cache.
+func WithRecentValueCache(size int) Option {
+	return func(t *TDigest) error {
+		if size < 1 {
+			return errors.New("recent value cache size must be >= 1")
+		}
+		t.recent = make([]int, 0, size)
+		return nil
+	}
+}
+
+// addRecent tries to add count to the centroid with the exact given mean,
+// using the cache of recently seen values. It reports whether it did.
+func (t *TDigest) addRecent(value float64, count uint64) bool {
+	s := t.summary
+	for i, idx := range t.recent {
+		if idx >= s.Len() || s.keys[idx] != value {
+			continue
+		}
+
+		// A centroid sharing the exact mean of the value always absorbs it,
+		// and its mean stays the same, so the summary order is unaffected.
+		s.counts[idx] += count
+		t.count += count
+
+		copy(t.recent[1:i+1], t.recent[:i])
+		t.recent[0] = idx
+		return true
+	}
+	return false
+}
+
+// rememberRecent records the position of value if it is now the mean of
+// a centroid, evicting the least recently used entry if needed.
+func (t *TDigest) rememberRecent(value float64) {
+	s := t.summary
+	idx := s.FindIndex(value)
+	if !s.meanAtIndexIs(idx, value) {
+		return
+	}
+
+	if len(t.recent) < cap(t.recent) {
+		t.recent = append(t.recent, 0)
+	}
+	copy(t.recent[1:], t.recent)
+	t.recent[0] = idx
+}
@@ -0,0 +1,77 @@
+package tdigest
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestRecentValueCache(t *testing.T) {
+	plain := New(100)
+	cached := New(100, WithRecentValueCache(4))
+
+	// Quantized values in long runs, interleaved with noise.
+	for i := 0; i < 10000; i++ {
+		x := float64(rand.Intn(8)) / 8
+		if i%10 == 0 {
+			x = rand.Float64()
+		}
+		for j := 0; j < 1+rand.Intn(5); j++ {
+			plain.Add(x, 1)
+			cached.Add(x, 1)
+		}
+	}
+
+	// Add picks randomly between equidistant centroids, so the digests
+	// may differ slightly, but not in any observable way.
+	if plain.count != cached.count {
+		t.Errorf("Expected equal counts. Got %d and %d", plain.count, cached.count)
+	}
+	checkSorted(cached.summary, t)
+
+	for _, q := range []float64{0.01, 0.25, 0.5, 0.75, 0.99} {
+		if d := plain.Quantile(q) - cached.Quantile(q); d > 0.01 || d < -0.01 {
+			t.Errorf("Quantile(%.2f) differs: %.4f vs %.4f", q, plain.Quantile(q), cached.Quantile(q))
+		}
+	}
+}
+
+func TestRecentValueCacheIsExact(t *testing.T) {
+	// Without any randomness involved, the cache must not change anything.
+	plain := New(100)
+	cached := New(100, WithRecentValueCache(2))
+	for _, x := range []float64{1, 1, 2, 2, 3, 1, 1, 4, 2, 5, 5, 5, 1} {
+		plain.Add(x, 2)
+		cached.Add(x, 2)
+	}
+
+	if !reflect.DeepEqual(plain.summary, cached.summary) || plain.count != cached.count {
+		t.Errorf("Expected identical digests. Got %v and %v", plain.summary, cached.summary)
+	}
+
+	shouldPanic(func() {
+		New(100, WithRecentValueCache(0))
+	}, t, "An empty recent value cache should panic!")
+}
+
+func benchmarkAddQuantizedRuns(b *testing.B, options ...Option) {
+	t := New(100, options...)
+
+	data := make([]float64, b.N)
+	for n := range data {
+		data[n] = float64((n/100)%50) / 50
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		t.Add(data[n], 1)
+	}
+}
+
+func BenchmarkAddQuantizedRuns(b *testing.B) {
+	benchmarkAddQuantizedRuns(b)
+}
+
+func BenchmarkAddQuantizedRunsCached(b *testing.B) {
+	benchmarkAddQuantizedRuns(b, WithRecentValueCache(4))
+}
@@ -0,0 +1,99 @@
+package tdigest
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Registry holds named digests, created on first use, for instrumenting
+// programs without passing digests around. It is safe for concurrent use.
+// Most programs only need the package-level functions using
+// DefaultRegistry, such as Observe and Quantile.
+type Registry struct {
+	compression float64
+	options     []Option
+
+	mu      sync.RWMutex
+	digests map[string]*ConcurrentTDigest
+}
+
+// NewRegistry creates a Registry whose digests are created with the given
+// compression and options. It panics like New if they're invalid.
+func NewRegistry(compression float64, options ...Option) *Registry {
+	New(compression, options...)
+	return &Registry{compression: compression, options: options, digests: make(map[string]*ConcurrentTDigest)}
+}
+
+// DefaultRegistry is the registry of the package-level functions. Its
+// digests use DefaultCompression. Nothing is registered in it until they
+// are used.
+var DefaultRegistry = NewRegistry(DefaultCompression)
+
+// Digest returns the digest registered under name, creating it if needed.
+func (r *Registry) Digest(name string) *ConcurrentTDigest {
+	r.mu.RLock()
+	c, ok := r.digests[name]
+	r.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.digests[name]; ok {
+		return c
+	}
+	c = NewConcurrent(r.compression, r.options...)
+	r.digests[name] = c
+	return c
+}
+
+// Observe adds a sample of value v to the digest registered under name,
+// creating it if needed. NaN values are ignored.
+func (r *Registry) Observe(name string, v float64) {
+	r.Digest(name).Add(v, 1)
+}
+
+// Quantile returns the estimated value at quantile q of the digest
+// registered under name, or NaN if there is none. See TDigest.Quantile.
+func (r *Registry) Quantile(name string, q float64) float64 {
+	r.mu.RLock()
+	c, ok := r.digests[name]
+	r.mu.RUnlock()
+	if !ok {
+		if q < 0 || q > 1 {
+			panic("q must be between 0 and 1 (inclusive)")
+		}
+		return math.NaN()
+	}
+	return c.Quantile(q)
+}
+
+// Names returns the names of the registered digests, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.digests))
+	for name := range r.digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Observe adds a sample of value v to the digest of DefaultRegistry
+// registered under name, creating it if needed, for quick instrumentation:
+//
+//	start := time.Now()
+//	handle(req)
+//	tdigest.Observe("handle_ms", float64(time.Since(start).Milliseconds()))
+func Observe(name string, v float64) {
+	DefaultRegistry.Observe(name, v)
+}
+
+// Quantile returns the estimated value at quantile q of the digest of
+// DefaultRegistry registered under name, or NaN if there is none.
+func Quantile(name string, q float64) float64 {
+	return DefaultRegistry.Quantile(name, q)
+}
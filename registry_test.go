@@ -0,0 +1,50 @@
+package tdigest
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(100)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				r.Observe(fmt.Sprintf("metric%d", i%2), float64(i))
+				r.Quantile("metric0", 0.5)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"metric0", "metric1"}) {
+		t.Errorf("Unexpected names %v", names)
+	}
+	if got := r.Quantile("metric1", 1); got != 999 {
+		t.Errorf("Expected a maximum of 999, got %v", got)
+	}
+	if n := r.Digest("metric0").Snapshot().count; n != 2000 {
+		t.Errorf("Expected 2000 samples, got %d", n)
+	}
+	if got := r.Quantile("unknown", 0.5); !math.IsNaN(got) {
+		t.Errorf("Expected NaN for an unknown digest, got %v", got)
+	}
+	if _, ok := r.digests["unknown"]; ok {
+		t.Errorf("Expected queries not to register digests")
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	Observe("TestDefaultRegistry", 1)
+	Observe("TestDefaultRegistry", 3)
+	if got := Quantile("TestDefaultRegistry", 1); got != 3 {
+		t.Errorf("Expected a maximum of 3, got %v", got)
+	}
+}
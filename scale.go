@@ -0,0 +1,181 @@
+package tdigest
+
+import (
+	"errors"
+	"math"
+)
+
+// ScaleFunction maps quantiles into the k (scale) space used to bound the
+// size of centroids: a centroid may span at most one unit of k, so the
+// steeper the function is around a quantile, the smaller (and more
+// accurate) the centroids kept there.
+type ScaleFunction interface {
+	// K maps a quantile q in [0, 1] into k space for the given compression.
+	// It must be strictly increasing.
+	K(q, compression float64) float64
+
+	// Q is the inverse of K. Results outside of [0, 1] are clamped.
+	Q(k, compression float64) float64
+}
+
+// The scale functions of the t-digest paper, for WithScaleFunction. Their
+// serializations record them as "k0" to "k3", see RegisterScaleFunction.
+// All of them keep about as many centroids as the compression, whereas the
+// built-in bound keeps about 8 times as many at the same compression, and
+// is more accurate for it: raise the compression of digests using them to
+// make up for it. ScaleK2 and ScaleK3 stay within a few times its error at
+// the tails nonetheless, where ScaleK1 gets tens of times it.
+var (
+	// ScaleK0 sizes centroids uniformly, keeping the fewest of them at the
+	// cost of accuracy at the tails.
+	ScaleK0 ScaleFunction = scaleK0{}
+
+	// ScaleK1 shrinks centroids towards the tails, with
+	// k = compression / 2π · asin(2q - 1). Its tail centroids are larger
+	// than those of ScaleK2 and ScaleK3, which are more accurate there.
+	ScaleK1 ScaleFunction = scaleK1{}
+
+	// ScaleK2 shrinks centroids faster towards the tails than ScaleK1, for
+	// accuracy at extreme quantiles such as p99.99, with
+	// k = compression / Z · log(q / (1 - q)). As in the paper, digests
+	// normalize it by the number of samples n, with Z = 4 log(n /
+	// compression) + 24, which K and Q take to be 4.
+	ScaleK2 ScaleFunction = scaleK2{}
+
+	// ScaleK3 is like ScaleK2 but keeps centroids even smaller at the far
+	// tails at the cost of the center, with k = compression / Z · log(2q)
+	// below the median and -compression / Z · log(2(1 - q)) above it,
+	// where digests normalize Z to 4 log(n / compression) + 21.
+	ScaleK3 ScaleFunction = scaleK3{}
+)
+
+// normalizedScale is implemented by the scale functions that depend on the
+// number of samples of a digest, which ScaleFunction doesn't see.
+type normalizedScale interface {
+	// normalize returns the compression to pass to K and Q for a digest of
+	// n samples.
+	normalize(compression float64, n uint64) float64
+}
+
+// normalizeLog returns the compression scaled by 4 / Z for the Z = 4
+// log(n / compression) + offset of the paper.
+func normalizeLog(compression float64, n uint64, offset float64) float64 {
+	z := 4*math.Log(math.Max(1, float64(n)/compression)) + offset
+	return compression * 4 / z
+}
+
+func init() {
+	RegisterScaleFunction("k0", ScaleK0)
+	RegisterScaleFunction("k1", ScaleK1)
+	RegisterScaleFunction("k2", ScaleK2)
+	RegisterScaleFunction("k3", ScaleK3)
+}
+
+type scaleK0 struct{}
+
+func (scaleK0) K(q, compression float64) float64 { return compression / 2 * q }
+func (scaleK0) Q(k, compression float64) float64 { return 2 * k / compression }
+
+type scaleK1 struct{}
+
+func (scaleK1) K(q, compression float64) float64 {
+	return compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+func (scaleK1) Q(k, compression float64) float64 {
+	// Asin only covers a half period of Sin.
+	k = math.Max(-compression/4, math.Min(compression/4, k))
+	return (math.Sin(2*math.Pi*k/compression) + 1) / 2
+}
+
+type scaleK2 struct{}
+
+func (scaleK2) K(q, compression float64) float64 {
+	return compression / 4 * math.Log(q/(1-q))
+}
+
+func (scaleK2) Q(k, compression float64) float64 {
+	return 1 / (1 + math.Exp(-4*k/compression))
+}
+
+func (scaleK2) normalize(compression float64, n uint64) float64 {
+	return normalizeLog(compression, n, 24)
+}
+
+type scaleK3 struct{}
+
+func (scaleK3) K(q, compression float64) float64 {
+	if q <= 0.5 {
+		return compression / 4 * math.Log(2*q)
+	}
+	return -compression / 4 * math.Log(2*(1-q))
+}
+
+func (scaleK3) Q(k, compression float64) float64 {
+	if k <= 0 {
+		return math.Exp(4*k/compression) / 2
+	}
+	return 1 - math.Exp(-4*k/compression)/2
+}
+
+func (scaleK3) normalize(compression float64, n uint64) float64 {
+	return normalizeLog(compression, n, 21)
+}
+
+// WithScaleFunction sizes centroids by the supplied scale function instead
+// of the built-in bound. The function is sanity checked for monotonicity
+// and for K and Q being inverses of each other, New panics otherwise.
+func WithScaleFunction(scale ScaleFunction) Option {
+	return func(t *TDigest) error {
+		if scale == nil {
+			return errors.New("ScaleFunction must not be nil")
+		}
+		if err := validateScale(scale, t.compression); err != nil {
+			return err
+		}
+		t.scale = scale
+		return nil
+	}
+}
+
+func validateScale(scale ScaleFunction, compression float64) error {
+	const steps = 1000
+
+	prev := math.Inf(-1)
+	for i := 1; i < steps; i++ {
+		q := float64(i) / steps
+		k := scale.K(q, compression)
+
+		if math.IsNaN(k) || math.IsInf(k, 0) {
+			return errors.New("ScaleFunction.K must be finite inside (0, 1)")
+		}
+		if k <= prev {
+			return errors.New("ScaleFunction.K must be strictly increasing")
+		}
+		if math.Abs(scale.Q(k, compression)-q) > 1e-6 {
+			return errors.New("ScaleFunction.Q must be the inverse of ScaleFunction.K")
+		}
+		prev = k
+	}
+
+	return nil
+}
+
+// scaledWidth returns the quantile range covered by one unit of k
+// centered at quantile q.
+func scaledWidth(scale ScaleFunction, q, compression float64) float64 {
+	k := scale.K(q, compression)
+	lo := clampQuantile(scale.Q(k-0.5, compression))
+	hi := clampQuantile(scale.Q(k+0.5, compression))
+	return hi - lo
+}
+
+func clampQuantile(q float64) float64 {
+	if math.IsNaN(q) || q < 0 {
+		return 0
+	}
+	if q > 1 {
+		return 1
+	}
+	return q
+}
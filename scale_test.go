@@ -0,0 +1,120 @@
+package tdigest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+type logitScale struct{}
+
+func (logitScale) K(q, compression float64) float64 {
+	return compression / 4 * math.Log(q/(1-q))
+}
+
+func (logitScale) Q(k, compression float64) float64 {
+	return 1 / (1 + math.Exp(-4*k/compression))
+}
+
+type uniformScale struct{}
+
+func (uniformScale) K(q, compression float64) float64 { return q * compression / 2 }
+func (uniformScale) Q(k, compression float64) float64 { return 2 * k / compression }
+
+type brokenInverseScale struct{ uniformScale }
+
+func (brokenInverseScale) Q(k, compression float64) float64 { return k / compression }
+
+type decreasingScale struct{}
+
+func (decreasingScale) K(q, compression float64) float64 { return -q * compression }
+func (decreasingScale) Q(k, compression float64) float64 { return -k / compression }
+
+func TestScaleFunction(t *testing.T) {
+	tdigest := New(100, WithScaleFunction(logitScale{}))
+	for _, i := range rand.Perm(10000) {
+		tdigest.Add(float64(i)/10000, 1)
+	}
+
+	assertDifferenceSmallerThan(tdigest, 0.5, 0.02, t)
+	assertDifferenceSmallerThan(tdigest, 0.1, 0.01, t)
+	assertDifferenceSmallerThan(tdigest, 0.9, 0.01, t)
+	assertDifferenceSmallerThan(tdigest, 0.01, 0.005, t)
+	assertDifferenceSmallerThan(tdigest, 0.99, 0.005, t)
+	assertDifferenceSmallerThan(tdigest, 0.001, 0.001, t)
+	assertDifferenceSmallerThan(tdigest, 0.999, 0.001, t)
+}
+
+func TestUniformScaleFunction(t *testing.T) {
+	tdigest := New(10, WithScaleFunction(uniformScale{}))
+	for _, i := range rand.Perm(10000) {
+		tdigest.Add(float64(i)/10000, 1)
+	}
+	tdigest.Compress()
+
+	// A uniform scale doesn't shrink centroids at the tails, so the
+	// number of centroids stays close to the compression.
+	if tdigest.Len() > 40 {
+		t.Errorf("Expected a uniform scale to keep few centroids. Got %d", tdigest.Len())
+	}
+	if tdigest.summary.Min().count == 1 {
+		t.Errorf("Expected tail centroids to be merged with a uniform scale")
+	}
+	// Centroids are few and wide, so the median is coarse.
+	assertDifferenceSmallerThan(tdigest, 0.5, 0.1, t)
+}
+
+func TestScaleFunctionValidation(t *testing.T) {
+	shouldPanic(func() {
+		New(100, WithScaleFunction(nil))
+	}, t, "A nil scale function should panic!")
+
+	shouldPanic(func() {
+		New(100, WithScaleFunction(decreasingScale{}))
+	}, t, "A decreasing scale function should panic!")
+
+	shouldPanic(func() {
+		New(100, WithScaleFunction(brokenInverseScale{}))
+	}, t, "A scale function with a wrong inverse should panic!")
+}
+
+func TestBuiltinScaleFunctions(t *testing.T) {
+	build := func(options ...Option) *TDigest {
+		tdigest := New(100, options...)
+		for _, j := range rand.Perm(100000) {
+			tdigest.Add(float64(j)/100000, 1)
+		}
+		tdigest.Compress()
+		return tdigest
+	}
+	tailError := func(tdigest *TDigest) float64 {
+		return math.Max(math.Abs(tdigest.Quantile(0.001)-0.001), math.Abs(tdigest.Quantile(0.9999)-0.9999))
+	}
+
+	def := build()
+	if e := tailError(def); e > 5e-5 {
+		t.Fatalf("Expected the default bound to be accurate at the tails. Got an error of %v", e)
+	}
+	for _, c := range []struct {
+		name     string
+		scale    ScaleFunction
+		tailSlop float64
+	}{
+		{"K0", ScaleK0, 0.05},
+		{"K1", ScaleK1, 5e-3},
+		{"K2", ScaleK2, 5e-4},
+		{"K3", ScaleK3, 5e-4},
+	} {
+		tdigest := build(WithScaleFunction(c.scale))
+		assertDifferenceSmallerThan(tdigest, 0.5, 0.05, t)
+
+		// They keep a fraction of the centroids of the default bound, and
+		// K2 and K3 are about as accurate at the tails nonetheless.
+		if n := tdigest.Len(); n > 150 || n > def.Len()/4 {
+			t.Errorf("%s: expected about 100 centroids, a fraction of the %d of the default. Got %d", c.name, def.Len(), n)
+		}
+		if e := tailError(tdigest); e > c.tailSlop {
+			t.Errorf("%s: expected a tail error below %v. Got %v", c.name, c.tailSlop, e)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package tdigest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Options that change query results are serialized along with the
+// centroids, so that a deserialized digest answers queries as the original
+// did without being configured the same way out of band. Like metadata,
+// they go behind a marker after the centroids, and only when some differ
+// from the defaults, so readers unaware of them ignore them and digests
+// with default options keep their exact encoding.
+//
+// The compression is part of every encoding already. The recorded options
+// are the quantile convention, the scale function if it was registered
+// with RegisterScaleFunction, and the transform of digests belonging to a
+// CompositeDigest, ClampTransform bounds included. Options that only
+// affect how a digest is maintained, such as compaction or merge
+// policies, aren't recorded.
+var optionsMarker = []byte("tdop")
+
+var errBadOptions = errors.New("bad options in serialization")
+
+var scaleRegistry = struct {
+	sync.RWMutex
+	scales map[string]ScaleFunction
+}{scales: make(map[string]ScaleFunction)}
+
+// RegisterScaleFunction names scale so that serialized digests using it
+// record the name, and deserializing them restores it. Names must be
+// unique and scale must be of a comparable type, so it can be recognized.
+// It panics otherwise. Registration is typically done from an init
+// function, by every process reading or writing such digests.
+func RegisterScaleFunction(name string, scale ScaleFunction) {
+	if name == "" {
+		panic("scale function name must not be empty")
+	}
+	if scale == nil || !sameScale(scale, scale) {
+		panic("scale function must be non-nil and of a comparable type")
+	}
+
+	scaleRegistry.Lock()
+	defer scaleRegistry.Unlock()
+	if _, ok := scaleRegistry.scales[name]; ok {
+		panic(fmt.Sprintf("scale function %q registered twice", name))
+	}
+	scaleRegistry.scales[name] = scale
+}
+
+// scaleName returns the name scale was registered under, or "" if it
+// wasn't.
+func scaleName(scale ScaleFunction) string {
+	if scale == nil {
+		return ""
+	}
+	scaleRegistry.RLock()
+	defer scaleRegistry.RUnlock()
+	for name, s := range scaleRegistry.scales {
+		if sameScale(s, scale) {
+			return name
+		}
+	}
+	return ""
+}
+
+func lookupScale(name string) ScaleFunction {
+	scaleRegistry.RLock()
+	defer scaleRegistry.RUnlock()
+	return scaleRegistry.scales[name]
+}
+
+// Transform returns the transform of the CompositeDigest the digest
+// belongs (or, once deserialized, belonged) to, or nil if there is none.
+// Func is nil for deserialized transforms that aren't built-in.
+func (t *TDigest) Transform() *Transform {
+	if t.transform == nil {
+		return nil
+	}
+	tr := *t.transform
+	tr.params = append([]float64(nil), tr.params...)
+	return &tr
+}
+
+// appendOptions appends the serialized options, if any differ from the
+// defaults, to b.
+func (t *TDigest) appendOptions(b []byte) []byte {
+	scale := scaleName(t.scale)
+	if t.convention == Midpoint && scale == "" && t.transform == nil {
+		return b
+	}
+
+	var payload []byte
+	payload = binary.AppendUvarint(payload, uint64(t.convention))
+	payload = appendString(payload, scale)
+	if tr := t.transform; tr == nil {
+		payload = appendBool(payload, false)
+	} else {
+		payload = appendBool(payload, true)
+		payload = appendString(payload, tr.Name)
+		payload = appendBool(payload, tr.builtin)
+		payload = binary.AppendUvarint(payload, uint64(len(tr.params)))
+		for _, p := range tr.params {
+			payload = endianess.AppendUint64(payload, math.Float64bits(p))
+		}
+	}
+	return appendTrailer(b, optionsMarker, payload)
+}
+
+func appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+// applyOptions configures the digest as described by payload, which was
+// serialized by appendOptions.
+func (t *TDigest) applyOptions(payload []byte) error {
+	r := trailerReader{buf: payload, bad: errBadOptions}
+	convention := QuantileConvention(r.uvarint())
+	scale := r.string()
+	var transform *Transform
+	if r.uvarint() != 0 {
+		name := r.string()
+		builtin := r.uvarint() != 0
+		numParams := r.uvarint()
+		if numParams > uint64(len(r.buf)) {
+			return errBadOptions
+		}
+		params := make([]float64, 0, numParams)
+		for i := uint64(0); i < numParams && r.err == nil; i++ {
+			params = append(params, r.float64())
+		}
+
+		tr := Transform{Name: name, params: params}
+		if builtin {
+			tr = builtinTransform(name, params)
+		}
+		transform = &tr
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	if convention != Midpoint && convention != Sample {
+		return fmt.Errorf("unknown quantile convention in serialization: %d", convention)
+	}
+	t.convention = convention
+	t.scale = nil
+	if scale != "" {
+		if t.scale = lookupScale(scale); t.scale == nil {
+			return fmt.Errorf("unknown scale function %q in serialization, see RegisterScaleFunction", scale)
+		}
+	}
+	t.transform = transform
+	return nil
+}
@@ -0,0 +1,126 @@
+package tdigest
+
+import (
+	"bytes"
+	"testing"
+)
+
+func init() {
+	RegisterScaleFunction("uniform", uniformScale{})
+}
+
+func roundTrip(t *testing.T, d *TDigest) []*TDigest {
+	t.Helper()
+
+	fromMethod := &TDigest{}
+	if err := fromMethod.FromBytes(d.ToBytes(nil)); err != nil {
+		t.Fatal(err)
+	}
+	asBytes, err := d.AsBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromFunc, err := FromBytes(bytes.NewReader(asBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*TDigest{fromMethod, fromFunc}
+}
+
+func TestEmbeddedOptions(t *testing.T) {
+	plain := New(100)
+	d := New(100, WithQuantileConvention(Sample), WithScaleFunction(uniformScale{}),
+		WithMetadata(Metadata{Unit: "ms"}))
+	for _, x := range []float64{1, 2, 3, 4} {
+		plain.Add(x, 1)
+		d.Add(x, 1)
+	}
+
+	if bytes.Contains(plain.ToBytes(nil), optionsMarker) {
+		t.Errorf("Default options should not be serialized")
+	}
+
+	for _, got := range roundTrip(t, d) {
+		if got.convention != Sample {
+			t.Errorf("Expected the Sample convention to be restored")
+		}
+		if !sameScale(got.scale, uniformScale{}) {
+			t.Errorf("Expected the registered scale function to be restored, got %v", got.scale)
+		}
+		if got.Metadata() == nil || got.Metadata().Unit != "ms" {
+			t.Errorf("Expected the metadata to survive next to the options, got %+v", got.Metadata())
+		}
+		if got.Quantile(0.25) != d.Quantile(0.25) {
+			t.Errorf("Quantile(0.25) = %v, wanted %v", got.Quantile(0.25), d.Quantile(0.25))
+		}
+	}
+
+	// Options missing from the serialization are left alone.
+	reused := New(100, WithQuantileConvention(Sample))
+	if err := reused.FromBytes(plain.ToBytes(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if reused.convention != Sample {
+		t.Errorf("Expected the convention of the receiver to be kept")
+	}
+}
+
+func TestEmbeddedOptionsUnknownScale(t *testing.T) {
+	d := New(100, WithScaleFunction(uniformScale{}))
+	d.Add(1, 1)
+	buf := d.ToBytes(nil)
+
+	scaleRegistry.Lock()
+	delete(scaleRegistry.scales, "uniform")
+	scaleRegistry.Unlock()
+	defer func() {
+		scaleRegistry.Lock()
+		scaleRegistry.scales["uniform"] = uniformScale{}
+		scaleRegistry.Unlock()
+	}()
+
+	if err := new(TDigest).FromBytes(buf); err == nil {
+		t.Errorf("Expected an unregistered scale function to fail decoding")
+	}
+
+	// Unregistered scale functions aren't recorded at all.
+	if bytes.Contains(New(100, WithScaleFunction(logitScale{})).ToBytes(nil), optionsMarker) {
+		t.Errorf("Expected no options for an unregistered scale function")
+	}
+}
+
+func TestEmbeddedTransforms(t *testing.T) {
+	custom := Transform{Name: "double", Func: func(x float64) float64 { return 2 * x }}
+	c, err := NewComposite(100, []Transform{ClampTransform(0, 10), LogTransform, custom})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Observe(20)
+
+	for _, got := range roundTrip(t, c.Digest("clamp")) {
+		tr := got.Transform()
+		if tr == nil || tr.Name != "clamp" || tr.Func == nil || tr.Func(20) != 10 || tr.Func(-1) != 0 {
+			t.Errorf("Expected the clamp transform and its bounds to be restored, got %+v", tr)
+		}
+	}
+	for _, got := range roundTrip(t, c.Digest("log")) {
+		if tr := got.Transform(); tr == nil || tr.Name != "log" || tr.Func == nil || tr.Func(1) != 0 {
+			t.Errorf("Expected the log transform to be restored, got %+v", tr)
+		}
+	}
+	for _, got := range roundTrip(t, c.Digest("double")) {
+		if tr := got.Transform(); tr == nil || tr.Name != "double" || tr.Func != nil {
+			t.Errorf("Expected a custom transform to come back by name only, got %+v", tr)
+		}
+	}
+
+	if New(100).Transform() != nil {
+		t.Errorf("Expected no transform outside of a CompositeDigest")
+	}
+}
+
+func TestRegisterScaleFunction(t *testing.T) {
+	shouldPanic(func() { RegisterScaleFunction("", logitScale{}) }, t, "An empty name should panic")
+	shouldPanic(func() { RegisterScaleFunction("nil", nil) }, t, "A nil scale function should panic")
+	shouldPanic(func() { RegisterScaleFunction("uniform", uniformScale{}) }, t, "Registering a name twice should panic")
+}
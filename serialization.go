@@ -8,16 +8,76 @@ import (
 	"math"
 )
 
-const smallEncoding int32 = 2
+const (
+	smallEncoding int32 = 2
+	rleEncoding   int32 = 3
+)
+
+// Encoding is a binary serialization format for digests.
+type Encoding int32
+
+const (
+	// SmallEncoding is the "small" encoding of the Java AVLTreeDigest, with
+	// the centroid means stored as float32 deltas. It is the default.
+	SmallEncoding = Encoding(smallEncoding)
+
+	// RunLengthEncoding is like SmallEncoding, but stores runs of equal
+	// deltas between consecutive means once. Means of quantized
+	// measurements are mostly evenly spaced, so this shrinks their digests
+	// a lot. Other implementations can't read it.
+	RunLengthEncoding = Encoding(rleEncoding)
+)
+
+// WithEncoding selects the format ToBytes and AsBytes serialize to.
+// FromBytes reads any of them regardless.
+func WithEncoding(encoding Encoding) Option {
+	return func(t *TDigest) error {
+		if encoding == QuantizedEncoding {
+			return errors.New("QuantizedEncoding needs a step, use WithQuantizedEncoding")
+		}
+		if encoding != SmallEncoding && encoding != RunLengthEncoding {
+			return fmt.Errorf("unknown encoding: %d", encoding)
+		}
+		t.output = encoding
+		return nil
+	}
+}
+
+func (t *TDigest) outputEncoding() int32 {
+	if t.output == 0 {
+		return smallEncoding
+	}
+	return int32(t.output)
+}
 
 var endianess = binary.BigEndian
 
+// ErrCorrupt is returned, wrapped with the specific problem, when
+// deserializing input that isn't a valid serialization, be it truncated,
+// tampered with or not a digest at all.
+var ErrCorrupt = errors.New("corrupt serialization")
+
+// guardDecode wraps the error of a deserialization function with
+// ErrCorrupt. It also turns any panic into such an error, so that inputs
+// the checks of the function missed can't crash the caller. It must be
+// deferred.
+func guardDecode(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%w: %v", ErrCorrupt, r)
+	}
+	if *err != nil && !errors.Is(*err, ErrCorrupt) {
+		*err = fmt.Errorf("%w: %w", ErrCorrupt, *err)
+	}
+}
+
 // AsBytes serializes the digest into a byte array so it can be
 // saved to disk or sent over the wire.
-func (t TDigest) AsBytes() ([]byte, error) {
+func (d TDigest) AsBytes() ([]byte, error) {
+	t := d.settled()
 	buffer := new(bytes.Buffer)
 
-	err := binary.Write(buffer, endianess, smallEncoding)
+	encoding := t.outputEncoding()
+	err := binary.Write(buffer, endianess, encoding)
 
 	if err != nil {
 		return nil, err
@@ -35,16 +95,23 @@ func (t TDigest) AsBytes() ([]byte, error) {
 		return nil, err
 	}
 
-	var x float64
-	t.summary.Iterate(func(item centroid) bool {
-		delta := item.mean - x
-		x = item.mean
-		err = binary.Write(buffer, endianess, float32(delta))
-
-		return err == nil
-	})
-	if err != nil {
-		return nil, err
+	switch encoding {
+	case rleEncoding:
+		buffer.Write(appendRunLengthMeans(nil, t.summary.keys))
+	case quantizedEncoding:
+		buffer.Write(appendQuantizedMeans(nil, t.summary.keys, t.quantum))
+	default:
+		var x float64
+		t.summary.Iterate(func(item centroid) bool {
+			delta := item.mean - x
+			x = item.mean
+			err = binary.Write(buffer, endianess, float32(delta))
+
+			return err == nil
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	t.summary.Iterate(func(item centroid) bool {
@@ -55,13 +122,24 @@ func (t TDigest) AsBytes() ([]byte, error) {
 		return nil, err
 	}
 
+	buffer.Write(t.appendOptions(nil))
+	buffer.Write(t.metadata.appendTo(nil))
+
 	return buffer.Bytes(), nil
 }
 
 // ToBytes serializes into the supplied slice, avoiding allocation if the slice
 // is large enough. The result slice is returned.
 func (t *TDigest) ToBytes(b []byte) []byte {
+	t.settle()
 	requiredSize := 16 + (4 * len(t.summary.keys)) + (len(t.summary.counts) * binary.MaxVarintLen64)
+	switch t.outputEncoding() {
+	case rleEncoding:
+		// Every run takes a delta and a varint
+		requiredSize += len(t.summary.keys) * binary.MaxVarintLen64
+	case quantizedEncoding:
+		requiredSize += 8 + len(t.summary.keys)*binary.MaxVarintLen64
+	}
 
 	if cap(b) < requiredSize {
 		b = make([]byte, requiredSize)
@@ -72,35 +150,45 @@ func (t *TDigest) ToBytes(b []byte) []byte {
 	// we'll return it with the actual encoded length.
 	b = b[:cap(b)]
 
-	endianess.PutUint32(b[0:], uint32(smallEncoding))
+	encoding := t.outputEncoding()
+	endianess.PutUint32(b[0:], uint32(encoding))
 	endianess.PutUint64(b[4:], math.Float64bits(t.compression))
 	endianess.PutUint32(b[12:], uint32(t.summary.Len()))
 
-	var x float64
 	idx := 16
-	for _, mean := range t.summary.keys {
-		delta := mean - x
-		x = mean
-		endianess.PutUint32(b[idx:], math.Float32bits(float32(delta)))
-		idx += 4
+	switch encoding {
+	case rleEncoding:
+		idx += len(appendRunLengthMeans(b[idx:idx], t.summary.keys))
+	case quantizedEncoding:
+		idx += len(appendQuantizedMeans(b[idx:idx], t.summary.keys, t.quantum))
+	default:
+		var x float64
+		for _, mean := range t.summary.keys {
+			delta := mean - x
+			x = mean
+			endianess.PutUint32(b[idx:], math.Float32bits(float32(delta)))
+			idx += 4
+		}
 	}
 
 	for _, count := range t.summary.counts {
 		idx += binary.PutUvarint(b[idx:], count)
 	}
-	return b[:idx]
+	return t.metadata.appendTo(t.appendOptions(b[:idx]))
 }
 
 // FromBytes reads a byte buffer with a serialized digest (from AsBytes)
-// and deserializes it.
-func FromBytes(buf *bytes.Reader) (*TDigest, error) {
+// and deserializes it. Errors wrap ErrCorrupt.
+func FromBytes(buf *bytes.Reader) (_ *TDigest, err error) {
+	defer guardDecode(&err)
+
 	var encoding int32
-	err := binary.Read(buf, endianess, &encoding)
+	err = binary.Read(buf, endianess, &encoding)
 	if err != nil {
 		return nil, err
 	}
 
-	if encoding != smallEncoding {
+	if encoding != smallEncoding && encoding != rleEncoding && encoding != quantizedEncoding {
 		return nil, fmt.Errorf("Unsupported encoding version: %d", encoding)
 	}
 
@@ -110,7 +198,11 @@ func FromBytes(buf *bytes.Reader) (*TDigest, error) {
 		return nil, err
 	}
 
-	t := New(compression)
+	t, err := newWithOptions(compression, nil)
+	if err != nil {
+		return nil, err
+	}
+	t.encoding = encoding
 
 	var numCentroids int32
 	err = binary.Read(buf, endianess, &numCentroids)
@@ -123,73 +215,139 @@ func FromBytes(buf *bytes.Reader) (*TDigest, error) {
 	}
 
 	means := make([]float64, numCentroids)
-	var delta float32
-	var x float64
+	if encoding == quantizedEncoding {
+		err = readQuantizedMeans(buf, means)
+	} else {
+		err = readMeans(buf, means, encoding)
+	}
+	if err == nil {
+		err = checkMeans(means)
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	for i := 0; i < int(numCentroids); i++ {
-		err = binary.Read(buf, endianess, &delta)
+		decUint, err := decodeUint(buf)
 		if err != nil {
 			return nil, err
 		}
-		x += float64(delta)
-		means[i] = x
+
+		if err := t.add(means[i], decUint); err != nil {
+			return nil, err
+		}
 	}
+	t.moments.inexact = true
 
-	for i := 0; i < int(numCentroids); i++ {
-		decUint, err := decodeUint(buf)
-		if err != nil {
+	options, err := readTrailer(buf, optionsMarker, errBadOptions)
+	if err != nil {
+		return nil, err
+	}
+	if options != nil {
+		if err := t.applyOptions(options); err != nil {
 			return nil, err
 		}
+	}
 
-		t.Add(means[i], decUint)
+	t.metadata, err = readMetadata(buf)
+	if err != nil {
+		return nil, err
 	}
 
 	return t, nil
 }
 
 // FromBytes deserializes into the supplied TDigest struct, re-using and
-// overwriting any existing buffers.
+// overwriting any existing buffers. Options recorded in buf replace those
+// of t, which are kept otherwise, see RegisterScaleFunction. Errors wrap
+// ErrCorrupt, and leave t without any centroid.
 func (t *TDigest) FromBytes(buf []byte) error {
+	t.modified()
+	t.moments = moments{inexact: true}
+	t.resetDistinct()
+	err := t.decode(buf)
+	if err != nil {
+		t.count = 0
+		t.metadata = nil
+		if t.summary != nil {
+			t.summary.keys = t.summary.keys[:0]
+			t.summary.counts = t.summary.counts[:0]
+		}
+	}
+	return err
+}
+
+func (t *TDigest) decode(buf []byte) (err error) {
+	defer guardDecode(&err)
+
 	if len(buf) < 16 {
 		return errors.New("buffer too small for deserialization")
 	}
 
 	encoding := int32(endianess.Uint32(buf[0:]))
-	if encoding != smallEncoding {
+	if encoding != smallEncoding && encoding != rleEncoding && encoding != quantizedEncoding {
 		return fmt.Errorf("unsupported encoding version: %d", encoding)
 	}
 
 	compression := math.Float64frombits(endianess.Uint64(buf[4:]))
+	if err := checkCompression(compression); err != nil {
+		return err
+	}
 	numCentroids := int(endianess.Uint32(buf[12:]))
 	if numCentroids < 0 || numCentroids > 1<<22 {
 		return errors.New("bad number of centroids in serialization")
 	}
 
-	if len(buf) < 16+(4*numCentroids) {
+	if encoding == smallEncoding && len(buf) < 16+(4*numCentroids) {
 		return errors.New("buffer too small for deserialization")
 	}
 
+	t.settle()
 	t.count = 0
 	t.compression = compression
-	if t.summary == nil || cap(t.summary.keys) < numCentroids || cap(t.summary.counts) < numCentroids {
+	t.encoding = encoding
+	if t.summary == nil {
 		t.summary = newSummary(uint(numCentroids))
+	} else if cap(t.summary.keys) < numCentroids || cap(t.summary.counts) < numCentroids {
+		alloc := t.summary.alloc
+		t.summary.release()
+		t.summary = newAllocatedSummary(uint(numCentroids), alloc)
 	}
 	t.summary.keys = t.summary.keys[:numCentroids]
 	t.summary.counts = t.summary.counts[:numCentroids]
 
 	idx := 16
-	var delta float32
-	var x float64
-	for i := 0; i < int(numCentroids); i++ {
-		delta = math.Float32frombits(endianess.Uint32(buf[idx:]))
-		idx += 4
-		x += float64(delta)
-		t.summary.keys[i] = x
+	switch encoding {
+	case rleEncoding:
+		read, err := decodeRunLengthMeans(buf[idx:], t.summary.keys)
+		if err != nil {
+			return err
+		}
+		idx += read
+	case quantizedEncoding:
+		read, err := decodeQuantizedMeans(buf[idx:], t.summary.keys)
+		if err != nil {
+			return err
+		}
+		idx += read
+	default:
+		var delta float32
+		var x float64
+		for i := 0; i < int(numCentroids); i++ {
+			delta = math.Float32frombits(endianess.Uint32(buf[idx:]))
+			idx += 4
+			x += float64(delta)
+			t.summary.keys[i] = x
+		}
 	}
 
 	for i := 0; i < int(numCentroids); i++ {
 		count, read := binary.Uvarint(buf[idx:])
 		if read < 1 {
-			return errors.New("error decoding varint, this TDigest is now invalid")
+			return errors.New("error decoding varint")
+		}
+		if count == 0 || t.count+count < t.count {
+			return errors.New("bad centroid count in serialization")
 		}
 
 		idx += read
@@ -197,10 +355,126 @@ func (t *TDigest) FromBytes(buf []byte) error {
 		t.summary.counts[i] = count
 		t.count += count
 	}
+	if err := checkMeans(t.summary.keys); err != nil {
+		return err
+	}
+	// Quantization, or float32 deltas too small to be represented, can
+	// make neighbouring means equal.
+	t.summary.combineEqualMeans()
+
+	options, read, err := decodeTrailer(buf[idx:], optionsMarker, errBadOptions)
+	if err != nil {
+		return err
+	}
+	if options != nil {
+		if err := t.applyOptions(options); err != nil {
+			return err
+		}
+	}
+	idx += read
+
+	t.metadata, err = decodeMetadata(buf[idx:])
+	return err
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, serializing the
+// digest as ToBytes does.
+func (t *TDigest) MarshalBinary() ([]byte, error) {
+	return t.ToBytes(nil), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, deserializing
+// data as FromBytes does.
+func (t *TDigest) UnmarshalBinary(data []byte) error {
+	return t.FromBytes(data)
+}
+
+// readMeans reads the float32 mean deltas of the small and run-length
+// encodings.
+func readMeans(buf *bytes.Reader, means []float64, encoding int32) error {
+	var delta float32
+	var x float64
+	for i := 0; i < len(means); {
+		err := binary.Read(buf, endianess, &delta)
+		if err != nil {
+			return err
+		}
+
+		run := uint64(1)
+		if encoding == rleEncoding {
+			run, err = decodeUint(buf)
+			if err != nil {
+				return err
+			}
+			if run == 0 || run > uint64(len(means)-i) {
+				return errors.New("bad run length in serialization")
+			}
+		}
+		for ; run > 0; run-- {
+			x += float64(delta)
+			means[i] = x
+			i++
+		}
+	}
+	return nil
+}
 
+// checkMeans validates decoded means, which every encoding writes in
+// increasing order.
+func checkMeans(means []float64) error {
+	for i, mean := range means {
+		if math.IsNaN(mean) || (i > 0 && mean < means[i-1]) {
+			return errors.New("bad centroid mean in serialization")
+		}
+	}
 	return nil
 }
 
+// appendRunLengthMeans appends the float32 deltas between consecutive means
+// to b, as pairs of a delta and the varint number of times it repeats.
+func appendRunLengthMeans(b []byte, means []float64) []byte {
+	var x float64
+	for i := 0; i < len(means); {
+		delta := math.Float32bits(float32(means[i] - x))
+		x = means[i]
+		run := 1
+		for i+run < len(means) && math.Float32bits(float32(means[i+run]-x)) == delta {
+			x = means[i+run]
+			run++
+		}
+		b = endianess.AppendUint32(b, delta)
+		b = binary.AppendUvarint(b, uint64(run))
+		i += run
+	}
+	return b
+}
+
+// decodeRunLengthMeans fills means from runs written by
+// appendRunLengthMeans, returning the number of bytes read.
+func decodeRunLengthMeans(buf []byte, means []float64) (int, error) {
+	idx := 0
+	var x float64
+	for i := 0; i < len(means); {
+		if len(buf) < idx+4 {
+			return 0, errors.New("buffer too small for deserialization")
+		}
+		delta := float64(math.Float32frombits(endianess.Uint32(buf[idx:])))
+		idx += 4
+
+		run, read := binary.Uvarint(buf[idx:])
+		if read < 1 || run == 0 || run > uint64(len(means)-i) {
+			return 0, errors.New("bad run length in serialization")
+		}
+		idx += read
+		for ; run > 0; run-- {
+			x += delta
+			means[i] = x
+			i++
+		}
+	}
+	return idx, nil
+}
+
 func encodeUint(buf *bytes.Buffer, n uint64) error {
 	var b [binary.MaxVarintLen64]byte
 
@@ -2,7 +2,11 @@ package tdigest
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
 	"math"
 	"math/rand"
 	"reflect"
@@ -66,6 +70,8 @@ func TestSerialization(t *testing.T) {
 	if t1.count != t3.count || t1.summary.Len() != t3.summary.Len() || t1.compression != t3.compression {
 		t.Errorf("Deserialized to something different. t1=%v t3=%v serialized=%v", t1, t3, serialized)
 	}
+	// The two count their changes differently.
+	t3.generation = t2.generation
 	if !reflect.DeepEqual(t2, t3) {
 		t.Errorf("FromBytes method deserialized to something different from FromBytes function")
 	}
@@ -79,6 +85,7 @@ func TestSerialization(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	t3.generation = t2.generation
 	if !reflect.DeepEqual(t2, t3) {
 		t.Errorf("FromBytes method deserialized to something different from FromBytes function")
 	}
@@ -148,13 +155,13 @@ func TestJavaSmallBytesCompat(t *testing.T) {
 	tdigestAsBytes, err := base64.StdEncoding.DecodeString(serializedJavaTDigestB64)
 
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 
 	tdigest, err := FromBytes(bytes.NewReader(tdigestAsBytes))
 
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 
 	if tdigest.count != 100000 {
@@ -234,3 +241,201 @@ func BenchmarkFromBytesMethod(b *testing.B) {
 		t2.FromBytes(buf)
 	}
 }
+
+func TestRunLengthEncoding(t *testing.T) {
+	// A sensor with a resolution of 0.25, mostly evenly spaced centroids
+	means := make([]float64, 1000)
+	counts := make([]uint64, len(means))
+	for i := range means {
+		means[i] = float64(i) / 4
+		counts[i] = uint64(1 + rand.Intn(100))
+	}
+	means[500] += 0.1
+
+	small, err := FromCentroids(means, counts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rle, err := FromCentroids(means, counts, WithEncoding(RunLengthEncoding))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	smallBytes := small.ToBytes(nil)
+	rleBytes := rle.ToBytes(nil)
+	if len(rleBytes) >= len(smallBytes)/2 {
+		t.Errorf("Expected run-length encoding to be smaller. Got %d bytes, %d with the small encoding", len(rleBytes), len(smallBytes))
+	}
+
+	asBytes, err := rle.AsBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(asBytes, rleBytes) {
+		t.Errorf("AsBytes serialized to something else than ToBytes")
+	}
+
+	t2, err := FromBytes(bytes.NewReader(rleBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t3 := &TDigest{}
+	if err := t3.FromBytes(rleBytes); err != nil {
+		t.Fatal(err)
+	}
+	fromSmall := &TDigest{}
+	if err := fromSmall.FromBytes(smallBytes); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(t3.summary.keys, fromSmall.summary.keys) || !reflect.DeepEqual(t3.summary.counts, fromSmall.summary.counts) {
+		t.Errorf("Both encodings should decode to the same centroids")
+	}
+	for _, q := range []float64{0.1, 0.5, 0.9} {
+		if t2.Quantile(q) != fromSmall.Quantile(q) || t3.Quantile(q) != fromSmall.Quantile(q) {
+			t.Errorf("Decoded digests differ at quantile %v", q)
+		}
+	}
+
+	// Truncated runs must be rejected rather than read out of bounds.
+	if err := t3.FromBytes(rleBytes[:20]); err == nil {
+		t.Errorf("Expected truncated runs to fail decoding")
+	}
+
+	shouldPanic(func() { New(100, WithEncoding(42)) }, t, "Unknown encodings should panic!")
+}
+
+func TestBinaryMarshaler(t *testing.T) {
+	var _ encoding.BinaryMarshaler = &TDigest{}
+	var _ encoding.BinaryUnmarshaler = &TDigest{}
+
+	d := New(50, WithMetadata(Metadata{Unit: "ms"}))
+	for i := 0; i < 1000; i++ {
+		d.Add(rand.Float64(), 1)
+	}
+
+	type record struct {
+		Name   string
+		Digest *TDigest
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(record{"latency", d}); err != nil {
+		t.Fatal(err)
+	}
+	var got record
+	if err := gob.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := d.MarshalBinary()
+	if !bytes.Equal(want, d.ToBytes(nil)) {
+		t.Errorf("Expected MarshalBinary to match ToBytes")
+	}
+	if got.Name != "latency" || !bytes.Equal(got.Digest.ToBytes(nil), want) {
+		t.Errorf("Expected the digest to survive a gob stream, got %+v", got)
+	}
+	if got.Digest.Metadata().Unit != "ms" {
+		t.Errorf("Expected the metadata to survive a gob stream")
+	}
+
+	if err := new(TDigest).UnmarshalBinary([]byte{1, 2}); err == nil {
+		t.Errorf("Expected garbage to fail unmarshaling")
+	}
+}
+
+func TestCorruptSerialization(t *testing.T) {
+	d := New(100)
+	for i := 0; i < 100; i++ {
+		d.Add(float64(i), 1)
+	}
+	valid := d.ToBytes(nil)
+
+	corrupt := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), valid...))
+	}
+	for name, buf := range map[string][]byte{
+		"empty":             {},
+		"truncated":         valid[:len(valid)-1],
+		"header only":       valid[:16],
+		"NaN compression":   corrupt(func(b []byte) []byte { endianess.PutUint64(b[4:], math.Float64bits(math.NaN())); return b }),
+		"small compression": corrupt(func(b []byte) []byte { endianess.PutUint64(b[4:], math.Float64bits(0.5)); return b }),
+		"huge compression":  corrupt(func(b []byte) []byte { endianess.PutUint64(b[4:], math.Float64bits(math.Inf(1))); return b }),
+		"NaN mean":          corrupt(func(b []byte) []byte { endianess.PutUint32(b[20:], math.Float32bits(float32(math.NaN()))); return b }),
+		"decreasing means":  corrupt(func(b []byte) []byte { endianess.PutUint32(b[20:], math.Float32bits(-5)); return b }),
+		"zero count":        corrupt(func(b []byte) []byte { b[16+4*100] = 0; return b }),
+		"overflowing counts": corrupt(func(b []byte) []byte {
+			b = b[:16+4*2]
+			endianess.PutUint32(b[12:], 2)
+			b = binary.AppendUvarint(b, math.MaxUint64)
+			return binary.AppendUvarint(b, 1)
+		}),
+	} {
+		if _, err := FromBytes(bytes.NewReader(buf)); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: expected FromBytes to fail with ErrCorrupt, got %v", name, err)
+		}
+
+		into := New(100)
+		into.Add(1, 1)
+		if err := into.FromBytes(buf); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: expected the FromBytes method to fail with ErrCorrupt, got %v", name, err)
+		}
+		if into.count != 0 || into.Len() != 0 || !math.IsNaN(into.Quantile(0.5)) {
+			t.Errorf("%s: expected a failed FromBytes to leave the digest empty", name)
+		}
+	}
+
+	// Means too close together for their float32 deltas are combined.
+	tiny := math.SmallestNonzeroFloat64
+	d = New(100)
+	d.Add(0, 1)
+	d.Add(tiny, 1)
+	got := new(TDigest)
+	if err := got.FromBytes(d.ToBytes(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if got.Len() != 1 || got.count != 2 {
+		t.Errorf("Expected a single centroid of 2 samples, got %d of %d", got.Len(), got.count)
+	}
+}
+
+// FuzzFromBytes checks that no input makes deserialization panic, only
+// return ErrCorrupt, and that whatever it accepts can be queried and
+// serialized again.
+func FuzzFromBytes(f *testing.F) {
+	d := New(10)
+	for i := 0; i < 100; i++ {
+		d.Add(float64(i*i), uint64(i%3+1))
+	}
+	f.Add(d.ToBytes(nil))
+	d.SetMetadata(&Metadata{Unit: "ms", Tags: map[string]string{"host": "a"}})
+	WithEncoding(RunLengthEncoding)(d)
+	f.Add(d.ToBytes(nil))
+	WithQuantizedEncoding(1)(d)
+	f.Add(d.ToBytes(nil))
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		d, err := FromBytes(bytes.NewReader(buf))
+		checkDecoded(t, d, err)
+
+		d = new(TDigest)
+		err = d.FromBytes(buf)
+		checkDecoded(t, d, err)
+	})
+}
+
+// checkDecoded is the check of the fuzz tests of deserialization.
+func checkDecoded(t *testing.T, d *TDigest, err error) {
+	if err != nil {
+		if !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("Expected errors to wrap ErrCorrupt, got %v", err)
+		}
+		return
+	}
+	for _, q := range []float64{0, 0.5, 1} {
+		d.Quantile(q)
+		d.CDF(q)
+	}
+	d.TrimmedMean(0.1, 0.9)
+	d.ToBytes(nil)
+	d.Add(1, 1)
+	d.Compress()
+}
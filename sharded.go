@@ -0,0 +1,151 @@
+package tdigest
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// ShardedTDigest is a digest safe for concurrent use that scales with the
+// number of goroutines adding samples. Samples go to one of several shards,
+// each a digest with a lock of its own, so concurrent calls to Add rarely
+// wait for each other. Queries merge the shards first, which costs about
+// as much as merging that many digests: for several queries in a row, take
+// a Digest and query it instead.
+type ShardedTDigest struct {
+	compression float64
+	options     []Option
+	shards      []digestShard
+}
+
+type digestShard struct {
+	mu sync.Mutex
+	t  *TDigest
+
+	// Keeps shards on cache lines of their own.
+	_ [48]byte
+}
+
+// NewSharded creates a ShardedTDigest of the given number of shards, or
+// of GOMAXPROCS shards if shards < 1. The compression and options are those
+// of New, and apply to every shard as well as to the merged digests; it
+// panics like New too.
+func NewSharded(shards int, compression float64, options ...Option) *ShardedTDigest {
+	if shards < 1 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	s := &ShardedTDigest{
+		compression: compression,
+		options:     options,
+		shards:      make([]digestShard, shards),
+	}
+	for i := range s.shards {
+		s.shards[i].t = New(compression, options...)
+	}
+	return s
+}
+
+// shard locks and returns a random shard, spreading concurrent writers.
+func (s *ShardedTDigest) shard() *digestShard {
+	sh := &s.shards[rand.Intn(len(s.shards))]
+	sh.mu.Lock()
+	return sh
+}
+
+// Add registers a new sample in one of the shards, see TDigest.Add.
+func (s *ShardedTDigest) Add(value float64, count uint64) error {
+	sh := s.shard()
+	defer sh.mu.Unlock()
+	return sh.t.Add(value, count)
+}
+
+// AddWeighted registers a sample with a fractional weight in one of the
+// shards, see TDigest.AddWeighted.
+func (s *ShardedTDigest) AddWeighted(value, weight float64) error {
+	sh := s.shard()
+	defer sh.mu.Unlock()
+	return sh.t.AddWeighted(value, weight)
+}
+
+// AddBatch adds every given value with a count of 1 to one of the shards,
+// see TDigest.AddBatch.
+func (s *ShardedTDigest) AddBatch(values []float64) error {
+	sh := s.shard()
+	defer sh.mu.Unlock()
+	return sh.t.AddBatch(values)
+}
+
+// AddBatchWeighted adds every given value with the count at the same index
+// to one of the shards, see TDigest.AddBatchWeighted.
+func (s *ShardedTDigest) AddBatchWeighted(values []float64, counts []uint64) error {
+	sh := s.shard()
+	defer sh.mu.Unlock()
+	return sh.t.AddBatchWeighted(values, counts)
+}
+
+// Merge joins other into one of the shards, see TDigest.Merge. other must
+// not be used concurrently.
+func (s *ShardedTDigest) Merge(other *TDigest) error {
+	sh := s.shard()
+	defer sh.mu.Unlock()
+	return sh.t.Merge(other)
+}
+
+// Reset empties every shard, see TDigest.Reset. Samples added concurrently
+// may or may not survive it.
+func (s *ShardedTDigest) Reset() {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		sh.t.Reset()
+		sh.mu.Unlock()
+	}
+}
+
+// Digest returns a new digest merging every shard, which the caller may
+// then use freely.
+func (s *ShardedTDigest) Digest() *TDigest {
+	d := New(s.compression, s.options...)
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		err := d.Merge(sh.t)
+		sh.mu.Unlock()
+		if err != nil {
+			// Shards share the options of d, so they're always compatible.
+			panic(err)
+		}
+	}
+	return d
+}
+
+// Quantile returns the estimated value at quantile q of the merged shards,
+// see TDigest.Quantile.
+func (s *ShardedTDigest) Quantile(q float64) float64 {
+	return s.Digest().Quantile(q)
+}
+
+// Quantiles returns the estimated values at each of qs of the merged
+// shards, see TDigest.Quantiles.
+func (s *ShardedTDigest) Quantiles(qs []float64) ([]float64, error) {
+	return s.Digest().Quantiles(qs)
+}
+
+// CDF returns the estimated fraction of the samples of the merged shards
+// at or below x, see TDigest.CDF.
+func (s *ShardedTDigest) CDF(x float64) float64 {
+	return s.Digest().CDF(x)
+}
+
+// Generation returns the sum of the generations of the shards, which grows
+// every time one of them changes, see TDigest.Generation.
+func (s *ShardedTDigest) Generation() uint64 {
+	var generation uint64
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		generation += sh.t.Generation()
+		sh.mu.Unlock()
+	}
+	return generation
+}
@@ -0,0 +1,83 @@
+package tdigest
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestShardedTDigest(t *testing.T) {
+	s := NewSharded(4, 100, WithMetadata(Metadata{Unit: "ms"}))
+
+	const writers, samples = 8, 5000
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < samples; i++ {
+				s.Add(float64(i*writers+w), 1)
+			}
+		}(w)
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				s.Quantile(0.5)
+				s.CDF(1000)
+				s.Quantiles([]float64{0.1, 0.9})
+			}
+		}()
+	}
+	wg.Wait()
+
+	d := s.Digest()
+	if d.count != writers*samples {
+		t.Errorf("Expected %d samples, got %d", writers*samples, d.count)
+	}
+	if got, want := s.Quantile(0.5), float64(writers*samples)/2; math.Abs(got-want) > want*0.01 {
+		t.Errorf("Expected a median of about %v, got %v", want, got)
+	}
+	if d.Metadata().Unit != "ms" {
+		t.Errorf("Expected the merged digest to keep the options of the shards")
+	}
+
+	// The merged digest is the caller's own.
+	d.Add(-1, 1)
+	if s.Quantile(0) == -1 {
+		t.Errorf("Expected changes to the merged digest not to affect the shards")
+	}
+
+	if err := s.Merge(d); err != nil {
+		t.Fatal(err)
+	}
+	if s.Quantile(0) != -1 || s.Digest().count != 2*writers*samples+1 {
+		t.Errorf("Expected the digest to be merged into a shard")
+	}
+}
+
+func TestNewShardedDefaultsToGOMAXPROCS(t *testing.T) {
+	if s := NewSharded(0, 100); len(s.shards) < 1 {
+		t.Errorf("Expected at least one shard, got %d", len(s.shards))
+	}
+}
+
+func benchmarkParallelAdd(b *testing.B, add func(float64, uint64) error) {
+	b.RunParallel(func(pb *testing.PB) {
+		x := 0.0
+		for pb.Next() {
+			add(x, 1)
+			x++
+		}
+	})
+}
+
+func BenchmarkConcurrentAdd(b *testing.B) {
+	benchmarkParallelAdd(b, NewConcurrent(100).Add)
+}
+
+func BenchmarkShardedAdd(b *testing.B) {
+	benchmarkParallelAdd(b, NewSharded(0, 100).Add)
+}
@@ -0,0 +1,34 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// Value implements driver.Valuer, storing the digest as ToBytes does, for
+// BYTEA or BLOB columns. A nil digest is stored as NULL.
+func (t *TDigest) Value() (driver.Value, error) {
+	if t == nil {
+		return nil, nil
+	}
+	return t.MarshalBinary()
+}
+
+// Scan implements sql.Scanner, reading a column written through Value as
+// the FromBytes method does. Scan into a **TDigest for nullable columns:
+// NULL can't be scanned into a digest, and sets the pointer to nil then.
+func (t *TDigest) Scan(src any) error {
+	switch src := src.(type) {
+	case []byte:
+		return t.FromBytes(src)
+	case string:
+		return t.FromBytes([]byte(src))
+	case nil:
+		return errors.New("cannot scan NULL into a digest, scan into a **TDigest instead")
+	default:
+		return fmt.Errorf("cannot scan %T into a digest", src)
+	}
+}
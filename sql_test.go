@@ -0,0 +1,50 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+)
+
+var (
+	_ sql.Scanner   = (*TDigest)(nil)
+	_ driver.Valuer = (*TDigest)(nil)
+)
+
+func TestSQL(t *testing.T) {
+	d := New(100)
+	for i := 0; i < 1000; i++ {
+		d.Add(float64(i%97), 1)
+	}
+
+	v, err := d.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !driver.IsValue(v) {
+		t.Fatalf("Expected a valid driver value, got %T", v)
+	}
+
+	for _, src := range []any{v, string(v.([]byte))} {
+		got := New(10)
+		if err := got.Scan(src); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.ToBytes(nil), d.ToBytes(nil)) {
+			t.Errorf("Expected the digest to survive a round trip through a %T column", src)
+		}
+	}
+
+	var null *TDigest
+	if v, err := null.Value(); v != nil || err != nil {
+		t.Errorf("Expected a nil digest to be stored as NULL, got %v, %v", v, err)
+	}
+	for _, bad := range []any{nil, 42, []byte{1, 2, 3}} {
+		if err := New(10).Scan(bad); err == nil {
+			t.Errorf("Expected scanning %#v to fail", bad)
+		}
+	}
+}
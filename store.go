@@ -0,0 +1,269 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Store implementations when no digest is
+// stored for the requested key and time.
+var ErrNotFound = errors.New("digest not found")
+
+// Store persists digests by key and time, so they can be reloaded later or
+// shared between processes. Implementations for other backends (S3, GCS,
+// Badger...) only need to satisfy this interface.
+type Store interface {
+	// Put saves d under key at time ts, replacing any digest previously
+	// stored for the same key and time.
+	Put(key string, ts time.Time, d *TDigest) error
+
+	// Get returns the digest stored under key at time ts, or ErrNotFound.
+	Get(key string, ts time.Time) (*TDigest, error)
+
+	// List returns every digest stored under key with a time in the
+	// half-open range [from, to), ordered by time.
+	List(key string, from, to time.Time) ([]StoredDigest, error)
+}
+
+// StoredDigest is a digest returned by Store.List along with the key and
+// time it was stored under.
+type StoredDigest struct {
+	Key    string
+	Time   time.Time
+	Digest *TDigest
+}
+
+// MemoryStore is a Store that keeps serialized digests in memory. It is
+// safe for concurrent use.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string]map[int64][]byte
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string]map[int64][]byte)}
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(key string, ts time.Time, d *TDigest) error {
+	buf := d.ToBytes(nil)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, ok := s.data[key]
+	if !ok {
+		entries = make(map[int64][]byte)
+		s.data[key] = entries
+	}
+	entries[ts.UnixNano()] = buf
+
+	return nil
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(key string, ts time.Time) (*TDigest, error) {
+	s.mu.RLock()
+	buf, ok := s.data[key][ts.UnixNano()]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return decodeStored(buf)
+}
+
+// List implements Store.
+func (s *MemoryStore) List(key string, from, to time.Time) ([]StoredDigest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var stamps []int64
+	for ts := range s.data[key] {
+		if inRange(ts, from, to) {
+			stamps = append(stamps, ts)
+		}
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i] < stamps[j] })
+
+	result := make([]StoredDigest, 0, len(stamps))
+	for _, ts := range stamps {
+		d, err := decodeStored(s.data[key][ts])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, StoredDigest{Key: key, Time: time.Unix(0, ts).UTC(), Digest: d})
+	}
+
+	return result, nil
+}
+
+// FileStore is a Store that keeps each digest in its own file, laid out as
+// <dir>/<escaped key>/<unix nanoseconds>.tdigest.
+type FileStore struct {
+	dir string
+}
+
+const fileStoreExt = ".tdigest"
+
+// NewFileStore creates a FileStore rooted at dir, creating the directory
+// if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Put implements Store. The digest is written to a temporary file first
+// and then renamed, so readers never observe a partially written digest.
+func (s *FileStore) Put(key string, ts time.Time, d *TDigest) error {
+	keyDir := s.keyDir(key)
+	if err := os.MkdirAll(keyDir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(keyDir, ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(d.ToBytes(nil))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(key, ts.UnixNano()))
+}
+
+// Get implements Store.
+func (s *FileStore) Get(key string, ts time.Time) (*TDigest, error) {
+	buf, err := os.ReadFile(s.path(key, ts.UnixNano()))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeStored(buf)
+}
+
+// List implements Store.
+func (s *FileStore) List(key string, from, to time.Time) ([]StoredDigest, error) {
+	return s.ListContext(context.Background(), key, from, to)
+}
+
+// ListContext is like List, but gives up with the context error if ctx is
+// done before every digest has been loaded.
+func (s *FileStore) ListContext(ctx context.Context, key string, from, to time.Time) ([]StoredDigest, error) {
+	stamps, err := s.stamps(key, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]StoredDigest, 0, len(stamps))
+	for _, ts := range stamps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		buf, err := os.ReadFile(s.path(key, ts))
+		if err != nil {
+			return nil, err
+		}
+		d, err := decodeStored(buf)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, StoredDigest{Key: key, Time: time.Unix(0, ts).UTC(), Digest: d})
+	}
+
+	return result, nil
+}
+
+// Keys returns the keys of every digest in the store, sorted.
+func (s *FileStore) Keys() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		key, err := url.PathUnescape(e.Name())
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// stamps returns the sorted times, in unix nanoseconds, of the digests
+// stored under key within [from, to).
+func (s *FileStore) stamps(key string, from, to time.Time) ([]int64, error) {
+	files, err := os.ReadDir(s.keyDir(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stamps []int64
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, fileStoreExt) {
+			continue
+		}
+		ts, err := strconv.ParseInt(strings.TrimSuffix(name, fileStoreExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		if inRange(ts, from, to) {
+			stamps = append(stamps, ts)
+		}
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i] < stamps[j] })
+	return stamps, nil
+}
+
+func (s *FileStore) keyDir(key string) string {
+	// PathEscape leaves dots alone, which would let keys such as ".." escape
+	// the store directory.
+	return filepath.Join(s.dir, strings.Replace(url.PathEscape(key), ".", "%2E", -1))
+}
+
+func (s *FileStore) path(key string, ts int64) string {
+	return filepath.Join(s.keyDir(key), strconv.FormatInt(ts, 10)+fileStoreExt)
+}
+
+func decodeStored(buf []byte) (*TDigest, error) {
+	d := &TDigest{}
+	if err := d.FromBytes(buf); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func inRange(ts int64, from, to time.Time) bool {
+	return ts >= from.UnixNano() && ts < to.UnixNano()
+}
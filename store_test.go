@@ -0,0 +1,119 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testStore(s Store, t *testing.T) {
+	base := time.Unix(1500000000, 0).UTC()
+
+	if _, err := s.Get("latency", base); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a missing digest. Got %v", err)
+	}
+
+	digests := make([]*TDigest, 5)
+	for i := range digests {
+		digests[i] = New(100)
+		for j := 0; j < 100; j++ {
+			digests[i].Add(rand.Float64(), 1)
+		}
+		// Store out of order to make sure List sorts by time.
+		idx := (i * 3) % len(digests)
+		err := s.Put("latency", base.Add(time.Duration(idx)*time.Minute), digests[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Put("other/../key", base, New(10))
+
+	d, err := s.Get("latency", base.Add(3*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Means are stored as float32 deltas, so allow for a little precision loss.
+	if math.Abs(d.Quantile(0.5)-digests[1].Quantile(0.5)) > 1e-6 || d.count != digests[1].count {
+		t.Errorf("Get returned a different digest. Got p50=%.4f, wanted %.4f", d.Quantile(0.5), digests[1].Quantile(0.5))
+	}
+
+	listed, err := s.List("latency", base.Add(time.Minute), base.Add(4*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 3 {
+		t.Fatalf("Expected 3 digests in range, got %d", len(listed))
+	}
+	for i, item := range listed {
+		want := base.Add(time.Duration(i+1) * time.Minute)
+		if !item.Time.Equal(want) || item.Key != "latency" {
+			t.Errorf("List()[%d] = %s@%s, wanted latency@%s", i, item.Key, item.Time, want)
+		}
+	}
+
+	listed, err = s.List("missing", base, base.Add(time.Hour))
+	if err != nil || len(listed) != 0 {
+		t.Errorf("List() on a missing key should be empty. Got %v, %v", listed, err)
+	}
+
+	listed, err = s.List("other/../key", base, base.Add(time.Hour))
+	if err != nil || len(listed) != 1 {
+		t.Errorf("Keys with path separators should round-trip. Got %v, %v", listed, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(NewMemoryStore(), t)
+}
+
+func TestFileStore(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(s, t)
+}
+
+func TestFileStoreKeys(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Unix(1500000000, 0)
+	for _, key := range []string{"b", "a/../c", "a"} {
+		if err := s.Put(key, base, New(100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := s.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "a/../c", "b"}) {
+		t.Errorf("Expected the stored keys, got %v", keys)
+	}
+}
+
+func TestFileStoreListContext(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Unix(1500000000, 0)
+	s.Put("key", base, New(100))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.ListContext(ctx, "key", base, base.Add(time.Hour)); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package tdigest
+
+import "reflect"
+
+// IncompatibleError is returned when merging into a digest created
+// WithStrictMerge a digest whose settings make the combination
+// meaningless.
+type IncompatibleError struct {
+	// Setting names what differs between the digests.
+	Setting string
+}
+
+func (e *IncompatibleError) Error() string {
+	return "cannot merge digests with a different " + e.Setting
+}
+
+// WithStrictMerge makes Merge refuse, with an *IncompatibleError, digests
+// that use a different scale function, that hold values under a different
+// transform of a CompositeDigest or that were decoded from a different
+// serialization format, instead of silently combining sketches built
+// under different assumptions.
+func WithStrictMerge() Option {
+	return func(t *TDigest) error {
+		t.strict = true
+		return nil
+	}
+}
+
+func (t *TDigest) checkCompatible(other *TDigest) error {
+	if !sameScale(t.scale, other.scale) {
+		return &IncompatibleError{Setting: "scale function"}
+	}
+	if !sameTransform(t.transform, other.transform) {
+		return &IncompatibleError{Setting: "transform"}
+	}
+
+	// Digests built in memory have no format; only compare decoded ones.
+	if t.encoding != 0 && other.encoding != 0 && t.encoding != other.encoding {
+		return &IncompatibleError{Setting: "format version"}
+	}
+
+	return nil
+}
+
+// sameTransform reports whether a and b are the same transform, by name and
+// parameters. Digests without one hold raw values.
+func sameTransform(a, b *Transform) bool {
+	if a == nil {
+		a = &RawTransform
+	}
+	if b == nil {
+		b = &RawTransform
+	}
+	if a.Name != b.Name || len(a.params) != len(b.params) {
+		return false
+	}
+	for i := range a.params {
+		if a.params[i] != b.params[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameScale(a, b ScaleFunction) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	// Comparing interfaces holding uncomparable values panics.
+	typ := reflect.TypeOf(a)
+	if typ != reflect.TypeOf(b) {
+		return false
+	}
+	if !typ.Comparable() {
+		return false
+	}
+	return a == b
+}
@@ -0,0 +1,79 @@
+package tdigest
+
+import "testing"
+
+func TestStrictMerge(t *testing.T) {
+	strict := New(100, WithStrictMerge())
+	other := New(100)
+	other.Add(1, 1)
+
+	if err := strict.Merge(other); err != nil {
+		t.Errorf("Digests with the same settings should merge. Got %v", err)
+	}
+
+	scaled := New(100, WithScaleFunction(logitScale{}))
+	scaled.Add(2, 1)
+	err := strict.Merge(scaled)
+	if e, ok := err.(*IncompatibleError); !ok || e.Setting != "scale function" {
+		t.Errorf("Expected an IncompatibleError about the scale function. Got %v", err)
+	}
+	if strict.count != 1 {
+		t.Errorf("Nothing should be merged on error. Got count %d", strict.count)
+	}
+
+	if err := New(100).Merge(scaled); err != nil {
+		t.Errorf("Non strict digests should merge anything. Got %v", err)
+	}
+
+	sameScale := New(100, WithStrictMerge(), WithScaleFunction(logitScale{}))
+	if err := sameScale.Merge(scaled); err != nil {
+		t.Errorf("Digests with the same scale function should merge. Got %v", err)
+	}
+
+	decoded := &TDigest{}
+	decoded.FromBytes(other.ToBytes(nil))
+	decoded.strict = true
+	other.encoding = 42
+	err = decoded.Merge(other)
+	if e, ok := err.(*IncompatibleError); !ok || e.Setting != "format version" {
+		t.Errorf("Expected an IncompatibleError about the format version. Got %v", err)
+	}
+	if err := decoded.Merge(New(100)); err != nil {
+		t.Errorf("Digests built in memory have no format to compare. Got %v", err)
+	}
+}
+
+func TestStrictMergeTransforms(t *testing.T) {
+	c, err := NewComposite(100, []Transform{RawTransform, LogTransform}, WithStrictMerge())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Observe(10)
+
+	err = c.Digest("raw").Merge(c.Digest("log"))
+	if e, ok := err.(*IncompatibleError); !ok || e.Setting != "transform" {
+		t.Errorf("Expected an IncompatibleError about the transform. Got %v", err)
+	}
+
+	// Digests outside of a composite hold raw values.
+	plain := New(100, WithStrictMerge())
+	if err := plain.Merge(c.Digest("raw")); err != nil {
+		t.Errorf("Raw digests should merge into plain ones. Got %v", err)
+	}
+	if err := plain.Merge(c.Digest("log")); err == nil {
+		t.Errorf("Expected log digests not to merge into plain ones")
+	}
+
+	lo, err := NewComposite(100, []Transform{ClampTransform(0, 1)}, WithStrictMerge())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hi, err := NewComposite(100, []Transform{ClampTransform(0, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hi.Observe(1.5)
+	if err := lo.Digest("clamp").Merge(hi.Digest("clamp")); err == nil {
+		t.Errorf("Expected clamps of different bounds not to merge")
+	}
+}
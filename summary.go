@@ -19,7 +19,17 @@ func (c centroid) isValid() bool {
 
 func (c *centroid) Update(x float64, weight uint64) {
 	c.count += weight
-	c.mean += float64(weight) * (x - c.mean) / float64(c.count)
+	c.mean = shiftMean(c.mean, x, weight, c.count)
+}
+
+// shiftMean returns the mean of a centroid after adding weight samples of
+// x to it, for a total of count. Infinite means are kept as they are,
+// rather than turning into NaN.
+func shiftMean(mean, x float64, weight, count uint64) float64 {
+	if x == mean || math.IsInf(mean, 0) {
+		return mean
+	}
+	return mean + float64(weight)*(x-mean)/float64(count)
 }
 
 var invalidCentroid = centroid{mean: math.NaN(), count: 0}
@@ -27,13 +37,52 @@ var invalidCentroid = centroid{mean: math.NaN(), count: 0}
 type summary struct {
 	keys   []float64
 	counts []uint64
+	alloc  SliceAllocator
 }
 
 func newSummary(initialCapacity uint) *summary {
-	return &summary{
-		keys:   make([]float64, 0, initialCapacity),
-		counts: make([]uint64, 0, initialCapacity),
+	return newAllocatedSummary(initialCapacity, nil)
+}
+
+func newAllocatedSummary(initialCapacity uint, alloc SliceAllocator) *summary {
+	if alloc == nil {
+		return &summary{
+			keys:   make([]float64, 0, initialCapacity),
+			counts: make([]uint64, 0, initialCapacity),
+		}
 	}
+
+	keys, counts := alloc.Alloc(int(initialCapacity))
+	return &summary{keys: keys, counts: counts, alloc: alloc}
+}
+
+// reserve makes room for n more centroids. Without an allocator append
+// takes care of growing the slices, so this is only needed when the
+// backing arrays come from one.
+func (s *summary) reserve(n int) {
+	if s.alloc == nil || len(s.keys)+n <= cap(s.keys) {
+		return
+	}
+
+	size := 2 * cap(s.keys)
+	if size < len(s.keys)+n {
+		size = len(s.keys) + n
+	}
+
+	keys, counts := s.alloc.Alloc(size)
+	keys = append(keys, s.keys...)
+	counts = append(counts, s.counts...)
+	s.release()
+	s.keys, s.counts = keys, counts
+}
+
+// release hands the backing arrays back to the allocator, if any. The
+// summary must not be used afterwards.
+func (s *summary) release() {
+	if s.alloc != nil {
+		s.alloc.Free(s.keys[:0], s.counts[:0])
+	}
+	s.keys, s.counts = nil, nil
 }
 
 func (s summary) Len() int {
@@ -57,6 +106,7 @@ func (s *summary) Add(key float64, value uint64) error {
 		return nil
 	}
 
+	s.reserve(1)
 	s.keys = append(s.keys, math.NaN())
 	s.counts = append(s.counts, 0)
 
@@ -117,11 +167,6 @@ func (s summary) Max() centroid {
 	return s.At(s.Len() - 1)
 }
 
-func (s summary) successorAndPredecessorItems(mean float64) (centroid, centroid) {
-	idx := s.FindIndex(mean)
-	return s.At(idx + 1), s.At(idx - 1)
-}
-
 func (s summary) ceilingAndFloorItems(mean float64) (centroid, centroid) {
 	idx := s.FindIndex(mean)
 
@@ -219,3 +264,33 @@ func (s *summary) Swap(i, j int) {
 func (s *summary) Less(i, j int) bool {
 	return s.keys[i] < s.keys[j]
 }
+
+// Summary is a read-only view over the centroids of a digest, ordered by
+// mean. A Summary is only valid until the digest it was obtained from is
+// modified again.
+type Summary struct {
+	s *summary
+}
+
+// Len returns the number of centroids.
+func (v Summary) Len() int {
+	if v.s == nil {
+		return 0
+	}
+	return v.s.Len()
+}
+
+// At returns the mean and count of the i-th centroid. Like indexing a
+// slice, it panics if i is out of range.
+func (v Summary) At(i int) (mean float64, count uint64) {
+	return v.s.keys[i], v.s.counts[i]
+}
+
+// Search returns the index of the first centroid with a mean greater than
+// or equal to x, or Len() if there is none.
+func (v Summary) Search(x float64) int {
+	if v.s == nil {
+		return 0
+	}
+	return v.s.FindIndex(x)
+}
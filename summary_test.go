@@ -237,3 +237,43 @@ func TestAdjustLeftRight(t *testing.T) {
 		t.Errorf("adjustLeft should have fixed the keys/counts state. %v %v", s.keys, s.counts)
 	}
 }
+
+func TestSummaryView(t *testing.T) {
+	tdigest := New(100)
+
+	if tdigest.Summary().Len() != 0 {
+		t.Errorf("Expected an empty view for an empty digest")
+	}
+	if (&TDigest{}).Summary().Len() != 0 {
+		t.Errorf("Expected an empty view for a zero digest")
+	}
+
+	for _, x := range []float64{5, 1, 3, 3, 9} {
+		tdigest.Add(x, 1)
+	}
+
+	view := tdigest.Summary()
+	if view.Len() != 4 {
+		t.Fatalf("Expected 4 centroids, got %d", view.Len())
+	}
+
+	for i, want := range []float64{1, 3, 5, 9} {
+		mean, _ := view.At(i)
+		if mean != want {
+			t.Errorf("At(%d) = %.1f, wanted %.1f", i, mean, want)
+		}
+	}
+	if _, count := view.At(1); count != 2 {
+		t.Errorf("Expected the centroid at 3 to have count 2, got %d", count)
+	}
+
+	for x, want := range map[float64]int{0: 0, 3: 1, 4: 2, 9: 3, 10: 4} {
+		if got := view.Search(x); got != want {
+			t.Errorf("Search(%.1f) = %d, wanted %d", x, got, want)
+		}
+	}
+
+	shouldPanic(func() {
+		view.At(4)
+	}, t, "At() past the end should panic!")
+}
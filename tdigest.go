@@ -1,11 +1,23 @@
 // Package tdigest provides a highly accurate mergeable data-structure
 // for quantile estimation.
+//
+// Building with the tdigest_lite tag leaves out everything but the digest
+// itself and its binary serialization (stores, stream formats, the
+// benchmarks and the command line tool), for embedding in resource
+// constrained agents and sidecars:
+//
+//	go build -tags tdigest_lite
 package tdigest
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"iter"
 	"math"
 	"math/rand"
+	"sort"
+	"time"
 )
 
 // TDigest is a quantile approximation data structure.
@@ -18,8 +30,40 @@ type TDigest struct {
 	summary     *summary
 	compression float64
 	count       uint64
+	generation  uint64
+	compaction  CompactionPolicy
+	scale       ScaleFunction
+	recent      []int
+	convention  QuantileConvention
+	strict      bool
+	encoding    int32
+	output      Encoding
+	quantum     float64
+	transform   *Transform
+	weightScale float64
+
+	metadata       *Metadata
+	metadataPolicy MetadataMergePolicy
+
+	queryCompression QueryCompressionPolicy
+
+	background  bool
+	pending     *pendingCompression
+	compressing bool
+
+	buffer *summary
+	cache  *queryCache
+
+	moments moments
+
+	newDistinct func() CardinalityEstimator
+	distinct    CardinalityEstimator
 }
 
+// Option configures optional behaviour of a digest. Options are passed
+// to New and validated there.
+type Option func(*TDigest) error
+
 // New creates a new digest.
 // The compression parameter rules the threshold in which samples are
 // merged together - the more often distinct samples are merged the more
@@ -28,25 +72,82 @@ type TDigest struct {
 // compression value means holding more centroids in memory (thus: better
 // precision), which means a bigger serialization payload and higher
 // memory footprint.
-// Compression must be a value greater of equal to 1, will panic
-// otherwise.
-func New(compression float64) *TDigest {
-	if compression < 1 {
-		panic("Compression must be >= 1.0")
+// Compression must be a finite value greater of equal to 1, will panic
+// otherwise. New also panics if any of the supplied options is invalid.
+func New(compression float64, options ...Option) *TDigest {
+	t, err := newWithOptions(compression, options)
+	if err != nil {
+		panic(err.Error())
+	}
+	return t
+}
+
+// Compression overrides the compression given to New. It's mostly useful
+// with constructors that don't take a compression parameter, such as
+// FromSamples, and should be passed before any other option.
+func Compression(compression float64) Option {
+	return func(t *TDigest) error {
+		if err := checkCompression(compression); err != nil {
+			return err
+		}
+		alloc := t.summary.alloc
+		t.summary.release()
+		t.compression = compression
+		t.summary = newAllocatedSummary(estimateCapacity(compression), alloc)
+		return nil
+	}
+}
+
+func newWithOptions(compression float64, options []Option) (*TDigest, error) {
+	if err := checkCompression(compression); err != nil {
+		return nil, err
 	}
-	return &TDigest{
+	t := &TDigest{
 		compression: compression,
 		summary:     newSummary(estimateCapacity(compression)),
 		count:       0,
 	}
+	for _, option := range options {
+		if err := option(t); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func checkCompression(compression float64) error {
+	if !(compression >= 1) || math.IsInf(compression, 1) {
+		return errors.New("Compression must be >= 1.0")
+	}
+	return nil
 }
 
 // Quantile returns the desired percentile estimation.
 // Values of p must be between 0 and 1 (inclusive), will panic otherwise.
+// It returns NaN for an empty digest or a NaN q.
+// The digest may be compressed first, see WithQueryCompression, and the
+// result may come from a cache, see WithQueryCache.
 func (t *TDigest) Quantile(q float64) float64 {
 	if q < 0 || q > 1 {
 		panic("q must be between 0 and 1 (inclusive)")
 	}
+	if math.IsNaN(q) {
+		return math.NaN()
+	}
+
+	if t.cache == nil {
+		return t.quantile(q)
+	}
+	if value, ok := t.cache.get(q, t.generation); ok {
+		return value
+	}
+	value := t.quantile(q)
+	t.cache.put(q, value, t.generation)
+	return value
+}
+
+func (t *TDigest) quantile(q float64) float64 {
+	t.prepareQuery()
 
 	if t.summary.Len() == 0 {
 		return math.NaN()
@@ -54,54 +155,442 @@ func (t *TDigest) Quantile(q float64) float64 {
 		return t.summary.Min().mean
 	}
 
-	q *= float64(t.count)
-	var total float64
+	s := t.summary
+	whole, frac := t.quantileRank(q)
+	i, total := s.locate(0, 0, whole)
+	return s.valueAt(i, float64(whole-total)+frac)
+}
+
+// Quantiles returns the estimated values at each of qs, in the same order,
+// as Quantile would. The quantiles are answered in a single sweep over the
+// centroids, which is cheaper than calling Quantile for each of them when
+// asking for many percentiles at once. It returns an error if any of qs
+// isn't between 0 and 1 (inclusive).
+func (t *TDigest) Quantiles(qs []float64) ([]float64, error) {
+	order := make([]int, len(qs))
+	for i, q := range qs {
+		if !(q >= 0 && q <= 1) {
+			return nil, fmt.Errorf("quantile %v is not between 0 and 1", q)
+		}
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return qs[order[a]] < qs[order[b]] })
+
+	t.prepareQuery()
+
+	results := make([]float64, len(qs))
+	s := t.summary
+	if s.Len() < 2 {
+		value := math.NaN()
+		if s.Len() == 1 {
+			value = s.keys[0]
+		}
+		for i := range results {
+			results[i] = value
+		}
+		return results, nil
+	}
+
+	var total uint64
 	i := 0
+	for _, idx := range order {
+		whole, frac := t.quantileRank(qs[idx])
+		i, total = s.locate(i, total, whole)
+		results[idx] = s.valueAt(i, float64(whole-total)+frac)
+	}
+	return results, nil
+}
 
-	found := false
-	var result float64
+// QuantileMany returns the estimated value at quantile q of each of
+// digests, as Quantile would, for dashboards asking for the same
+// percentile of many digests at once. It walks the centroid arrays of each
+// digest directly, without any allocation per digest. Nil digests yield
+// NaN, like empty ones. It returns an error if q isn't between 0 and 1
+// (inclusive).
+func QuantileMany(digests []*TDigest, q float64) ([]float64, error) {
+	if !(q >= 0 && q <= 1) {
+		return nil, fmt.Errorf("quantile %v is not between 0 and 1", q)
+	}
 
-	t.summary.Iterate(func(item centroid) bool {
-		k := float64(item.count)
+	results := make([]float64, len(digests))
+	for n, t := range digests {
+		if t == nil {
+			results[n] = math.NaN()
+			continue
+		}
+		t.prepareQuery()
 
-		if q < total+k {
-			if i == 0 || i+1 == t.summary.Len() {
-				result = item.mean
-				found = true
-				return false
+		s := t.summary
+		if s.Len() < 2 {
+			results[n] = math.NaN()
+			if s.Len() == 1 {
+				results[n] = s.keys[0]
 			}
-			succ, pred := t.summary.successorAndPredecessorItems(item.mean)
-			delta := (succ.mean - pred.mean) / 2
-			result = item.mean + ((q-total)/k-0.5)*delta
-			found = true
-			return false
+			continue
+		}
+
+		whole, frac := t.quantileRank(q)
+		i, total := s.locate(0, 0, whole)
+		results[n] = s.valueAt(i, float64(whole-total)+frac)
+	}
+	return results, nil
+}
+
+// QuantileOfUnion estimates the value at quantile q of all the samples
+// of digests together, without building the digest merging them would
+// make, for ad-hoc queries across many digests. It searches for the
+// smallest value at which the CDFs of the digests, weighted by their
+// counts, reach q. Nil and empty digests are skipped, and it returns NaN
+// if none holds samples. It returns an error if q isn't between 0 and 1
+// (inclusive).
+func QuantileOfUnion(q float64, digests ...*TDigest) (float64, error) {
+	if !(q >= 0 && q <= 1) {
+		return 0, fmt.Errorf("quantile %v is not between 0 and 1", q)
+	}
+
+	var nonEmpty []*TDigest
+	var total float64
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, t := range digests {
+		if t == nil {
+			continue
+		}
+		t.prepareQuery()
+		s := t.summary
+		if s.Len() == 0 {
+			continue
+		}
+		nonEmpty = append(nonEmpty, t)
+		total += float64(t.count)
+		lo = math.Min(lo, s.keys[0])
+		hi = math.Max(hi, s.keys[s.Len()-1])
+	}
+	if nonEmpty == nil {
+		return math.NaN(), nil
+	}
+
+	cdf := func(x float64) float64 {
+		var below float64
+		for _, t := range nonEmpty {
+			below += float64(t.count) * t.CDF(x)
+		}
+		return below / total
+	}
+	if cdf(lo) >= q {
+		return lo, nil
+	}
+
+	// The CDF is below q at lo and reaches it at hi. Bisecting 100 times
+	// narrows the range far beyond the accuracy of the estimate.
+	for i := 0; i < 100; i++ {
+		mid := lo/2 + hi/2
+		if mid <= lo || mid >= hi {
+			break
+		}
+		if cdf(mid) >= q {
+			hi = mid
+		} else {
+			lo = mid
 		}
+	}
+	return hi, nil
+}
 
+// locate returns the index of the centroid holding the sample at rank
+// whole (counted from 0), along with the number of samples before it,
+// searching from the centroid at index i, preceded by total samples. It
+// returns the number of centroids if the rank is past the last one.
+// Counting in integers keeps ranks exact in digests holding more samples
+// than float64 can count.
+func (s *summary) locate(i int, total, whole uint64) (int, uint64) {
+	for i < s.Len() && whole >= total+s.counts[i] {
+		total += s.counts[i]
 		i++
+	}
+	return i, total
+}
+
+// valueAt interpolates the value in the centroid at index i at offset,
+// the rank counted from the start of the centroid, the way Quantile does.
+// An index past the last centroid yields the largest mean. The summary
+// must hold at least two centroids.
+func (s *summary) valueAt(i int, offset float64) float64 {
+	switch {
+	case i == s.Len():
+		return s.keys[s.Len()-1]
+	case i == 0 || i+1 == s.Len():
+		return s.keys[i]
+	}
+	k := float64(s.counts[i])
+	return s.keys[i] + (offset/k-0.5)*s.spread(i)
+}
+
+// spread returns the width of the interval Quantile maps the ranks of the
+// centroid at index i over, half the distance between its neighbours. It
+// is zero next to an infinite mean, where there is nothing to interpolate.
+func (s *summary) spread(i int) float64 {
+	delta := (s.keys[i+1] - s.keys[i-1]) / 2
+	if math.IsInf(delta, 0) {
+		// Halving first doesn't overflow for finite means.
+		delta = s.keys[i+1]/2 - s.keys[i-1]/2
+	}
+	if math.IsInf(delta, 0) || math.IsNaN(delta) {
+		return 0
+	}
+	return delta
+}
+
+// ValueAtRank returns the estimated value of the rank-th smallest sample,
+// ranks going from 1 to the number of samples, interpolating within
+// centroids the same way Quantile does. It inverts CDF by rank rather than
+// by fraction: centroids are located by exact integer counts, which keeps
+// ranks apart in digests holding more samples than a float64 quantile can
+// tell apart. Ranks out of range are clamped, and it returns
+// NaN for an empty digest. The digest may be compressed first, see
+// WithQueryCompression.
+func (t *TDigest) ValueAtRank(rank uint64) float64 {
+	t.prepareQuery()
+
+	s := t.summary
+	switch {
+	case s.Len() == 0:
+		return math.NaN()
+	case s.Len() == 1:
+		return s.keys[0]
+	}
+	rank = max(1, min(rank, t.count))
+
+	// The sample sits in the middle of its unit of the centroid ranks.
+	i, total := s.locate(0, 0, rank-1)
+	return s.valueAt(i, float64(rank-1-total)+0.5)
+}
+
+// CDF returns the estimated fraction of the samples that are less than or
+// equal to x, interpolating within centroids the same way Quantile does,
+// so that CDF(Quantile(q)) is about q. It returns NaN for an empty digest
+// or a NaN x. The digest may be compressed first, see WithQueryCompression.
+func (t *TDigest) CDF(x float64) float64 {
+	t.prepareQuery()
+	return t.cdf(x)
+}
+
+// cdf is CDF without preparing the digest for queries.
+func (t *TDigest) cdf(x float64) float64 {
+	s := t.summary
+	if s.Len() == 0 || math.IsNaN(x) {
+		return math.NaN()
+	}
+	if x < s.keys[0] {
+		return 0
+	}
+	if x >= s.keys[s.Len()-1] {
+		return 1
+	}
+	return t.rankQuantile(t.cdfRank(x))
+}
+
+// cdfRank returns the estimated number of samples less than or equal to
+// x, interpolated as CDF does, for a non-empty digest and a non-NaN x.
+func (t *TDigest) cdfRank(x float64) float64 {
+	s := t.summary
+	if x < s.keys[0] {
+		return 0
+	}
+	if x >= s.keys[s.Len()-1] {
+		return float64(t.count)
+	}
+
+	// Quantile maps the ranks of every centroid but the first and the last
+	// linearly over an interval around its mean, half as wide as the
+	// distance between its neighbours. Ranks between those intervals are
+	// never returned, so CDF is flat there.
+	total := float64(s.counts[0])
+	for i := 1; i < s.Len()-1; i++ {
+		k := float64(s.counts[i])
+		delta := s.spread(i)
+		lo := s.keys[i] - delta/2
+		if x < lo {
+			break
+		}
+		if x < lo+delta {
+			return total + k*(x-lo)/delta
+		}
+		total += k
+	}
+	return total
+}
+
+// Headroom locates a threshold within the distribution of a digest.
+type Headroom struct {
+	Threshold float64
+
+	// Quantile is the quantile the threshold currently sits at, i.e. the
+	// estimated fraction of samples at or below it.
+	Quantile float64
+}
+
+// Exceeding returns the estimated fraction of samples above the threshold.
+func (h Headroom) Exceeding() float64 {
+	return 1 - h.Quantile
+}
+
+// String describes the headroom the way runbooks usually do, e.g.
+// "750 is currently p99.3".
+func (h Headroom) String() string {
+	return fmt.Sprintf("%g is currently %s", h.Threshold, percentileLabel(h.Quantile))
+}
+
+// HeadroomToThreshold reports the quantile threshold currently sits at,
+// as estimated by CDF. The quantile is NaN for an empty digest.
+func (t *TDigest) HeadroomToThreshold(threshold float64) Headroom {
+	return Headroom{Threshold: threshold, Quantile: t.CDF(threshold)}
+}
+
+// TrimmedMean returns the estimated mean of the samples between quantiles
+// q1 and q2, e.g. TrimmedMean(0.05, 0.95) for the p5-p95 mean. Each
+// centroid counts as its samples all lying at its mean, and only the part
+// of its weight that falls between the cut points contributes to the
+// result. Cut points are taken at ranks q*n whatever the quantile
+// convention, so that TrimmedMean(0, 1) is the mean of the whole digest.
+// It returns NaN for an empty digest and Quantile(q1) when q1 == q2.
+func (t *TDigest) TrimmedMean(q1, q2 float64) float64 {
+	if q1 < 0 || q1 > 1 || q2 < 0 || q2 > 1 {
+		panic("q1 and q2 must be between 0 and 1 (inclusive)")
+	}
+	if q1 > q2 {
+		panic("q1 must not be greater than q2")
+	}
+
+	t.prepareQuery()
+
+	s := t.summary
+	if s.Len() == 0 {
+		return math.NaN()
+	}
+	if q1 == q2 {
+		return t.Quantile(q1)
+	}
+
+	lo, hi := q1*float64(t.count), q2*float64(t.count)
+	var total, sum, weight float64
+	for i := 0; i < s.Len() && total < hi; i++ {
+		k := float64(s.counts[i])
+		if w := math.Min(total+k, hi) - math.Max(total, lo); w > 0 {
+			sum += w * s.keys[i]
+			weight += w
+		}
 		total += k
-		return true
-	})
+	}
+	return sum / weight
+}
+
+// QuantileBreakpoints returns an iterator over n evenly spaced quantiles
+// from 0 to 1 (inclusive), yielding each quantile along with its estimated
+// value. A single breakpoint yields the median. Values are only computed
+// as the iteration reaches them.
+func (t *TDigest) QuantileBreakpoints(n int) iter.Seq2[float64, float64] {
+	return func(yield func(q, value float64) bool) {
+		for i := 0; i < n; i++ {
+			q := 0.5
+			if n > 1 {
+				q = float64(i) / float64(n-1)
+			}
+			if !yield(q, t.Quantile(q)) {
+				return
+			}
+		}
+	}
+}
+
+// CumulativeCentroid is a centroid along with the samples up to it.
+type CumulativeCentroid struct {
+	Centroid
+
+	// Cumulative is the number of samples of the centroid and of those
+	// before it, and Fraction the fraction of the samples of the digest
+	// they make up.
+	Cumulative uint64
+	Fraction   float64
+
+	// CDF is the estimated fraction of the samples at or below Mean, as
+	// CDF returns it, interpolated the same way.
+	CDF float64
+}
 
-	if found {
-		return result
+// Cumulative returns an iterator over the centroids of the digest, in
+// ascending order of mean, yielding each one along with the samples up to
+// it, so that exporters of cumulative distributions don't need to add the
+// counts up themselves. The CDF of a centroid is only computed as the
+// iteration reaches it. The digest may be compressed first, see
+// WithQueryCompression, and must not be modified during the iteration.
+func (t *TDigest) Cumulative() iter.Seq[CumulativeCentroid] {
+	return func(yield func(CumulativeCentroid) bool) {
+		t.prepareQuery()
+		s := t.summary
+		var total uint64
+		for i := 0; i < s.Len(); i++ {
+			total += s.counts[i]
+			c := CumulativeCentroid{
+				Centroid:   Centroid{Mean: s.keys[i], Count: s.counts[i]},
+				Cumulative: total,
+				Fraction:   float64(total) / float64(t.count),
+				CDF:        t.cdf(s.keys[i]),
+			}
+			if !yield(c) {
+				return
+			}
+		}
 	}
-	return t.summary.Max().mean
 }
 
 // Add registers a new sample in the digest.
 // It's the main entry point for the digest and very likely the only
 // method to be used for collecting samples. The count parameter is for
 // when you are registering a sample that occurred multiple times - the
-// most common value for this is 1.
+// most common value for this is 1. NaN values, zero counts and counts
+// overflowing the total of the digest are rejected.
 func (t *TDigest) Add(value float64, count uint64) error {
+	if err := t.add(value, count); err != nil {
+		return err
+	}
+	t.moments.add(value, count, t.count)
+	if t.distinct != nil {
+		t.distinct.Insert(value)
+	}
+	return nil
+}
 
-	if count == 0 {
+// add is Add without tracking moments, for samples the digest already
+// accounted for, such as its own centroids when compressing.
+func (t *TDigest) add(value float64, count uint64) error {
+	if count == 0 || math.IsNaN(value) {
 		return fmt.Errorf("Illegal datapoint <value: %.4f, count: %d>", value, count)
 	}
+	if t.count+count < t.count {
+		return fmt.Errorf("count %d overflows the %d samples of the digest", count, t.count)
+	}
+	t.modified()
+
+	// Compress adds the centroids back one by one.
+	if t.buffer != nil && !t.compressing {
+		t.addBuffered(value, count)
+		return nil
+	}
+
+	if t.pending != nil && t.addPending(value, count) {
+		return nil
+	}
+
+	if t.recent != nil {
+		if t.addRecent(value, count) {
+			return nil
+		}
+		defer t.rememberRecent(value)
+	}
 
 	if t.summary.Len() == 0 {
 		t.summary.Add(value, count)
-		t.count = count
+		t.count += count
 		return nil
 	}
 
@@ -121,7 +610,7 @@ func (t *TDigest) Add(value float64, count uint64) error {
 
 		quantile := t.computeCentroidQuantile(&chosen)
 
-		if float64(chosen.count+count) > t.threshold(quantile) {
+		if !t.allowWeight(quantile, float64(chosen.count+count)) {
 			candidates = append(candidates[:j], candidates[j+1:]...)
 			continue
 		}
@@ -136,8 +625,14 @@ func (t *TDigest) Add(value float64, count uint64) error {
 		t.count += count
 	}
 
-	if float64(t.summary.Len()) > 20*t.compression {
-		t.Compress()
+	// Compress adds every centroid back, which must not compress again
+	// when the centroids can't be merged any further.
+	if float64(t.summary.Len()) > 20*t.compression && !t.compressing {
+		if t.background {
+			t.compressInBackground()
+		} else {
+			t.Compress()
+		}
 	}
 
 	return nil
@@ -149,17 +644,47 @@ func (t *TDigest) Add(value float64, count uint64) error {
 // automatically after a certain amount of distinct samples have been
 // stored.
 func (t *TDigest) Compress() {
+	t.settle()
 	if t.summary.Len() <= 1 {
 		return
 	}
 
+	t.compressing = true
+	defer func() { t.compressing = false }()
+
 	oldTree := t.summary
 	oldTree.shuffle()
-	t.summary = newSummary(estimateCapacity(t.compression))
+	t.summary = newAllocatedSummary(estimateCapacity(t.compression), oldTree.alloc)
 	t.count = 0
 
 	for i := range oldTree.keys {
-		t.Add(oldTree.keys[i], oldTree.counts[i])
+		t.add(oldTree.keys[i], oldTree.counts[i])
+	}
+	oldTree.release()
+}
+
+// Reset empties the digest, keeping its options and metadata as well as
+// the memory it allocated for centroids, so that digests emptied after
+// every reporting interval don't need to grow again. It waits for a
+// background compression to finish first.
+func (t *TDigest) Reset() {
+	if p := t.pending; p != nil {
+		// The summary was handed over to the compression.
+		<-p.done
+		t.summary = p.compressed.summary
+		p.staging.summary.release()
+		t.pending = nil
+	}
+	t.modified()
+	t.count = 0
+	t.moments = moments{}
+	t.resetDistinct()
+	t.summary.keys = t.summary.keys[:0]
+	t.summary.counts = t.summary.counts[:0]
+	t.recent = t.recent[:0]
+	if t.buffer != nil {
+		t.buffer.keys = t.buffer.keys[:0]
+		t.buffer.counts = t.buffer.counts[:0]
 	}
 }
 
@@ -167,33 +692,148 @@ func (t *TDigest) Compress() {
 // Merging is useful when you have multiple TDigest instances running
 // in separate threads and you want to compute quantiles over all the
 // samples. This is particularly important on a scatter-gather/map-reduce
-// scenario.
-func (t *TDigest) Merge(other *TDigest) {
-	t.MergeDestructive(other)
+// scenario. Merge only fails for digests created WithStrictMerge, with
+// metadata of a different unit (see MetadataMergePolicy), or with
+// cardinality estimators that fail to merge (see CardinalityMerger).
+func (t *TDigest) Merge(other *TDigest) error {
+	if err := t.MergeDestructive(other); err != nil {
+		return err
+	}
 
 	other.summary.unshuffle()
+	return nil
 }
 
 // As Merge, above, but leaves other in a scrambled state
-func (t *TDigest) MergeDestructive(other *TDigest) {
+func (t *TDigest) MergeDestructive(other *TDigest) error {
+	t.settle()
+	other.settle()
+
+	if t.strict {
+		if err := t.checkCompatible(other); err != nil {
+			return err
+		}
+	}
+	if err := t.checkMetadata(other); err != nil {
+		return err
+	}
+	if err := t.mergeDistinct(other); err != nil {
+		return err
+	}
+	t.modified()
+	t.mergeMetadata(other)
+
 	if other.summary.Len() == 0 {
-		return
+		return nil
 	}
 
+	t.moments.combine(other.exactMoments(), t.count, other.count)
 	other.summary.shuffle()
 
 	for i := range other.summary.keys {
-		t.Add(other.summary.keys[i], other.summary.counts[i])
+		t.add(other.summary.keys[i], other.summary.counts[i])
+	}
+	return nil
+}
+
+// MergeMany merges every given digest into t, as calling Merge for each of
+// them would.
+func (t *TDigest) MergeMany(others ...*TDigest) error {
+	return t.MergeManyContext(context.Background(), others)
+}
+
+// MergeManyContext is like MergeMany, but stops early with the context
+// error if ctx is done before all digests are merged. The digests merged
+// until then remain part of t.
+func (t *TDigest) MergeManyContext(ctx context.Context, others []*TDigest) error {
+	return t.MergeManyProgress(ctx, others, nil)
+}
+
+// MergeProgressFunc is notified of the progress of MergeManyProgress, with
+// the number of digests merged so far and the time elapsed since the
+// merge started.
+type MergeProgressFunc func(processed int, elapsed time.Duration)
+
+// MergeManyProgress is like MergeManyContext, but calls progress, unless
+// nil, after merging each digest so that long merges can be monitored.
+func (t *TDigest) MergeManyProgress(ctx context.Context, others []*TDigest, progress MergeProgressFunc) error {
+	start := time.Now()
+	for i, other := range others {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := t.Merge(other); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(i+1, time.Since(start))
+		}
 	}
+	return nil
+}
+
+// Compression returns the compression the digest was created with.
+func (t *TDigest) Compression() float64 {
+	return t.compression
 }
 
 // Len returns the number of centroids in the TDigest.
-func (t *TDigest) Len() int { return t.summary.Len() }
+func (t *TDigest) Len() int {
+	t.settle()
+	return t.summary.Len()
+}
+
+// Summary returns a read-only view of the digest centroids, for callers
+// that need direct, indexed access to them.
+func (t *TDigest) Summary() Summary {
+	t.settle()
+	return Summary{t.summary}
+}
+
+// WeightedSamples returns the means of the centroids, in ascending order,
+// and their counts as fractions of the total, summing to 1. Weighted
+// statistics functions, such as those of gonum/stat, take them as is:
+//
+//	x, w := d.WeightedSamples()
+//	stddev := stat.StdDev(x, w)
+//
+// Both slices are new, and nil for an empty digest.
+func (t *TDigest) WeightedSamples() (means, weights []float64) {
+	t.settle()
+	s := t.summary
+	if s.Len() == 0 {
+		return nil, nil
+	}
+	means = append([]float64(nil), s.keys...)
+	weights = make([]float64, s.Len())
+	total := float64(t.count)
+	for i, c := range s.counts {
+		weights[i] = float64(c) / total
+	}
+	return means, weights
+}
+
+// Centroids returns a copy of the centroids of the digest, in ascending
+// order of mean, or nil for an empty digest.
+func (t *TDigest) Centroids() []Centroid {
+	t.settle()
+	s := t.summary
+	if s.Len() == 0 {
+		return nil
+	}
+	centroids := make([]Centroid, s.Len())
+	for i := range centroids {
+		centroids[i] = Centroid{Mean: s.keys[i], Count: s.counts[i]}
+	}
+	return centroids
+}
 
 // ForEachCentroid calls the specified function for each centroid.
 // Iteration stops when the supplied function returns false, or when all
-// centroids have been iterated.
+// centroids have been iterated. All does the same for range-over-func
+// loops.
 func (t *TDigest) ForEachCentroid(f func(mean float64, count uint64) bool) {
+	t.settle()
 	s := t.summary
 	for i := 0; i < s.Len(); i++ {
 		if !f(s.keys[i], s.counts[i]) {
@@ -202,14 +842,78 @@ func (t *TDigest) ForEachCentroid(f func(mean float64, count uint64) bool) {
 	}
 }
 
+// All returns an iterator over the centroids of the digest, in ascending
+// order of mean, along with their index, for range-over-func loops:
+//
+//	for i, c := range d.All() {
+//		fmt.Println(i, c.Mean, c.Count)
+//	}
+//
+// The digest must not be modified during the iteration.
+func (t *TDigest) All() iter.Seq2[int, Centroid] {
+	return func(yield func(int, Centroid) bool) {
+		t.settle()
+		s := t.summary
+		for i := 0; i < s.Len(); i++ {
+			if !yield(i, Centroid{Mean: s.keys[i], Count: s.counts[i]}) {
+				return
+			}
+		}
+	}
+}
+
+// IterateDescending is like ForEachCentroid, but walks the centroids from
+// the largest mean to the smallest.
+func (t *TDigest) IterateDescending(f func(mean float64, count uint64) bool) {
+	t.settle()
+	s := t.summary
+	for i := s.Len() - 1; i >= 0; i-- {
+		if !f(s.keys[i], s.counts[i]) {
+			break
+		}
+	}
+}
+
+// IterateRange is like ForEachCentroid, but only visits the centroids with
+// a mean within [lo, hi].
+func (t *TDigest) IterateRange(lo, hi float64, f func(mean float64, count uint64) bool) {
+	t.settle()
+	s := t.summary
+	for i := s.FindIndex(lo); i < s.Len() && s.keys[i] <= hi; i++ {
+		if !f(s.keys[i], s.counts[i]) {
+			break
+		}
+	}
+}
+
+// maxCapacity bounds the centroids preallocated for a digest, so that
+// huge compressions read from untrusted serializations can't exhaust
+// memory before any centroid is added.
+const maxCapacity = 1 << 20
+
 func estimateCapacity(compression float64) uint {
-	return uint(compression) * 10
+	return uint(math.Min(compression, maxCapacity/10)) * 10
 }
 
 func (t *TDigest) threshold(q float64) float64 {
+	if t.scale != nil {
+		compression := t.compression
+		if s, ok := t.scale.(normalizedScale); ok {
+			compression = s.normalize(compression, t.count)
+		}
+		return float64(t.count) * scaledWidth(t.scale, q, compression)
+	}
 	return (4 * float64(t.count) * q * (1 - q)) / t.compression
 }
 
+func (t *TDigest) allowWeight(q float64, weight float64) bool {
+	limit := t.threshold(q)
+	if t.compaction == nil {
+		return weight <= limit
+	}
+	return t.compaction.Allow(q, weight, limit)
+}
+
 func (t *TDigest) computeCentroidQuantile(c *centroid) float64 {
 	cumSum := t.summary.sumUntilIndex(c.index)
 	return (float64(c.count)/2.0 + float64(cumSum)) / float64(t.count)
@@ -1,11 +1,13 @@
 package tdigest
 
 import (
+	"context"
 	"math"
 	"math/rand"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 )
 
 // Test of tdigest internals and accuracy. Note no t.Parallel():
@@ -354,7 +356,7 @@ func shouldPanic(f func(), t *testing.T, message string) {
 	defer func() {
 		tryRecover := recover()
 		if tryRecover == nil {
-			t.Errorf(message)
+			t.Error(message)
 		}
 	}()
 	f()
@@ -365,6 +367,14 @@ func TestPanic(t *testing.T) {
 		New(0.5)
 	}, t, "Compression < 1 should panic!")
 
+	shouldPanic(func() {
+		New(math.NaN())
+	}, t, "NaN compression should panic!")
+
+	shouldPanic(func() {
+		New(math.Inf(1))
+	}, t, "Infinite compression should panic!")
+
 	tdigest := New(100)
 
 	shouldPanic(func() {
@@ -412,6 +422,113 @@ func TestForEachCentroid(t *testing.T) {
 	}
 }
 
+func TestReset(t *testing.T) {
+	for name, options := range map[string][]Option{
+		"default":                {},
+		"background compression": {WithBackgroundCompression()},
+		"buffered":               {WithBufferedAdd(100)},
+		"recent values":          {WithRecentValueCache(4)},
+	} {
+		tdigest := New(10, append(options, WithMetadata(Metadata{Unit: "ms"}))...)
+		for i := 0; i < 10000; i++ {
+			tdigest.Add(rand.Float64(), 1)
+		}
+		tdigest.Len() // settles a background compression
+		keys := tdigest.summary.keys[:1]
+
+		generation := tdigest.Generation()
+		tdigest.Reset()
+		if tdigest.count != 0 || tdigest.Len() != 0 || !math.IsNaN(tdigest.Quantile(0.5)) {
+			t.Errorf("%s: expected an empty digest after Reset", name)
+		}
+		if tdigest.Generation() <= generation {
+			t.Errorf("%s: expected Reset to change the generation", name)
+		}
+		if tdigest.Metadata().Unit != "ms" {
+			t.Errorf("%s: expected Reset to keep the metadata", name)
+		}
+		if &tdigest.summary.keys[:1][0] != &keys[0] {
+			t.Errorf("%s: expected Reset to keep the centroid slices", name)
+		}
+
+		tdigest.Add(1, 1)
+		tdigest.Add(2, 1)
+		if tdigest.count != 2 || tdigest.Quantile(1) != 2 {
+			t.Errorf("%s: expected the digest to be usable after Reset", name)
+		}
+	}
+}
+
+func TestWeightedSamples(t *testing.T) {
+	if means, weights := New(10).WeightedSamples(); means != nil || weights != nil {
+		t.Errorf("Expected nothing for an empty digest")
+	}
+
+	tdigest := New(100)
+	tdigest.Add(2, 3)
+	tdigest.Add(1, 1)
+	means, weights := tdigest.WeightedSamples()
+	if !reflect.DeepEqual(means, []float64{1, 2}) || !reflect.DeepEqual(weights, []float64{0.25, 0.75}) {
+		t.Errorf("Unexpected samples %v with weights %v", means, weights)
+	}
+
+	means[0] = 100
+	if tdigest.Quantile(0) != 1 {
+		t.Errorf("Expected the samples to be a copy")
+	}
+}
+
+func TestCentroids(t *testing.T) {
+	if New(10).Centroids() != nil {
+		t.Errorf("Expected no centroids for an empty digest")
+	}
+
+	tdigest := New(100)
+	tdigest.Add(2, 3)
+	tdigest.Add(1, 1)
+	centroids := tdigest.Centroids()
+	if !reflect.DeepEqual(centroids, []Centroid{{1, 1}, {2, 3}}) {
+		t.Errorf("Unexpected centroids %v", centroids)
+	}
+
+	centroids[0].Mean = 100
+	if tdigest.Quantile(0) != 1 {
+		t.Errorf("Expected the centroids to be a copy")
+	}
+	if c := tdigest.Freeze().Centroids(); !reflect.DeepEqual(c, []Centroid{{1, 1}, {2, 3}}) {
+		t.Errorf("Expected frozen digests to have the same centroids, got %v", c)
+	}
+}
+
+func TestAll(t *testing.T) {
+	tdigest := New(100)
+	for i := 0; i < 1000; i++ {
+		tdigest.Add(rand.Float64(), 1)
+	}
+
+	var centroids []Centroid
+	for i, c := range tdigest.All() {
+		if i != len(centroids) {
+			t.Errorf("Expected index %d, got %d", len(centroids), i)
+		}
+		centroids = append(centroids, c)
+	}
+	if !reflect.DeepEqual(centroids, tdigest.Centroids()) {
+		t.Errorf("Expected All to yield the centroids")
+	}
+
+	seen := 0
+	for range tdigest.Freeze().All() {
+		seen++
+		if seen == 3 {
+			break
+		}
+	}
+	if seen != 3 {
+		t.Errorf("Expected the iteration to stop after 3 centroids, got %d", seen)
+	}
+}
+
 func TestQuantilesDontOverflow(t *testing.T) {
 	tdigest := New(100)
 	// Add slightly more than math.MaxUint32 samples uniformly in the range
@@ -423,8 +540,8 @@ func TestQuantilesDontOverflow(t *testing.T) {
 	assertDifferenceSmallerThan(tdigest, 0.5, .02, t)
 }
 
-func benchmarkAdd(compression float64, b *testing.B) {
-	t := New(compression)
+func benchmarkAdd(compression float64, b *testing.B, options ...Option) {
+	t := New(compression, options...)
 
 	data := make([]float64, b.N)
 	for n := 0; n < b.N; n++ {
@@ -499,3 +616,549 @@ func BenchmarkMergeDestructive(b *testing.B) {
 		dest.MergeDestructive(t)
 	}
 }
+
+func TestIterateDescendingAndRange(t *testing.T) {
+	tdigest := New(100)
+	for i := 0; i < 10; i++ {
+		tdigest.Add(float64(i), 1)
+	}
+
+	means := []float64{}
+	tdigest.IterateDescending(func(mean float64, count uint64) bool {
+		means = append(means, mean)
+		return len(means) < 3
+	})
+	if !reflect.DeepEqual(means, []float64{9, 8, 7}) {
+		t.Errorf("IterateDescending visited %v, wanted [9 8 7]", means)
+	}
+
+	means = []float64{}
+	tdigest.IterateRange(2.5, 6, func(mean float64, count uint64) bool {
+		means = append(means, mean)
+		return true
+	})
+	if !reflect.DeepEqual(means, []float64{3, 4, 5, 6}) {
+		t.Errorf("IterateRange visited %v, wanted [3 4 5 6]", means)
+	}
+
+	means = []float64{}
+	tdigest.IterateRange(20, 30, func(mean float64, count uint64) bool {
+		means = append(means, mean)
+		return true
+	})
+	if len(means) != 0 {
+		t.Errorf("IterateRange outside of the data should visit nothing. Got %v", means)
+	}
+}
+
+func TestCumulative(t *testing.T) {
+	tdigest := New(100)
+	for i := 0; i < 1000; i++ {
+		tdigest.Add(rand.Float64(), 1)
+	}
+
+	var total uint64
+	seen := 0
+	for c := range tdigest.Cumulative() {
+		mean, count := tdigest.Summary().At(seen)
+		total += count
+		if c.Mean != mean || c.Count != count || c.Cumulative != total {
+			t.Errorf("Centroid %d: expected %v, %d up to %d, got %+v", seen, mean, count, total, c)
+		}
+		if c.Fraction != float64(total)/1000 || c.CDF != tdigest.CDF(mean) {
+			t.Errorf("Centroid %d: unexpected fractions %+v", seen, c)
+		}
+		seen++
+	}
+	if seen != tdigest.Len() || total != 1000 {
+		t.Errorf("Expected all %d centroids, got %d with %d samples", tdigest.Len(), seen, total)
+	}
+
+	seen = 0
+	for range tdigest.Cumulative() {
+		seen++
+		if seen == 3 {
+			break
+		}
+	}
+	if seen != 3 {
+		t.Errorf("Expected the iteration to stop after 3 centroids, got %d", seen)
+	}
+
+	for range New(10).Cumulative() {
+		t.Errorf("Expected no centroids for an empty digest")
+	}
+}
+
+func TestQuantileBreakpoints(t *testing.T) {
+	tdigest := New(100)
+	for i := 0; i < 1000; i++ {
+		tdigest.Add(rand.Float64(), 1)
+	}
+
+	qs := []float64{}
+	for q, v := range tdigest.QuantileBreakpoints(5) {
+		qs = append(qs, q)
+		if v != tdigest.Quantile(q) {
+			t.Errorf("Breakpoint at %.2f = %.4f, wanted %.4f", q, v, tdigest.Quantile(q))
+		}
+	}
+	if !reflect.DeepEqual(qs, []float64{0, 0.25, 0.5, 0.75, 1}) {
+		t.Errorf("Unexpected breakpoints %v", qs)
+	}
+
+	for q := range tdigest.QuantileBreakpoints(1) {
+		if q != 0.5 {
+			t.Errorf("A single breakpoint should be the median. Got %.2f", q)
+		}
+	}
+
+	seen := 0
+	for range tdigest.QuantileBreakpoints(100) {
+		seen++
+		if seen == 3 {
+			break
+		}
+	}
+	if seen != 3 {
+		t.Errorf("Breaking out of the iteration should stop it")
+	}
+
+	for range tdigest.QuantileBreakpoints(0) {
+		t.Errorf("No breakpoints should be yielded for n=0")
+	}
+}
+
+func TestMergeMany(t *testing.T) {
+	// Interleaved, evenly spaced samples keep sampling error out of the
+	// median.
+	subs := make([]*TDigest, 4)
+	for i := range subs {
+		subs[i] = New(100)
+		for _, j := range rand.Perm(1000) {
+			subs[i].Add(float64(4*j+i)/4000, 1)
+		}
+	}
+
+	tdigest := New(100)
+	tdigest.MergeMany(subs...)
+	if tdigest.count != 4000 {
+		t.Errorf("Expected count 4000 after MergeMany, got %d", tdigest.count)
+	}
+	assertDifferenceSmallerThan(tdigest, 0.5, 0.02, t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tdigest = New(100)
+	if err := tdigest.MergeManyContext(ctx, subs); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if tdigest.count != 0 {
+		t.Errorf("Nothing should be merged with a cancelled context")
+	}
+}
+
+func TestMergeManyProgress(t *testing.T) {
+	subs := make([]*TDigest, 3)
+	for i := range subs {
+		subs[i] = New(100)
+		subs[i].Add(float64(i), 1)
+	}
+
+	var reported []int
+	var last time.Duration
+	tdigest := New(100)
+	err := tdigest.MergeManyProgress(context.Background(), subs, func(processed int, elapsed time.Duration) {
+		reported = append(reported, processed)
+		if elapsed < last {
+			t.Errorf("Elapsed time should not decrease. Got %v after %v", elapsed, last)
+		}
+		last = elapsed
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reported, []int{1, 2, 3}) {
+		t.Errorf("Expected progress after each digest, got %v", reported)
+	}
+	if tdigest.count != 3 {
+		t.Errorf("Expected count 3 after MergeManyProgress, got %d", tdigest.count)
+	}
+}
+
+func TestCDF(t *testing.T) {
+	tdigest := New(100)
+	if !math.IsNaN(tdigest.CDF(0)) {
+		t.Errorf("Expected NaN for an empty digest")
+	}
+
+	for _, i := range rand.Perm(10000) {
+		tdigest.Add(float64(i)/10000, 1)
+	}
+
+	if tdigest.CDF(-1) != 0 || tdigest.CDF(2) != 1 {
+		t.Errorf("Expected 0 below the minimum and 1 above the maximum")
+	}
+
+	last := 0.0
+	for x := 0.0; x <= 1; x += 0.001 {
+		got := tdigest.CDF(x)
+		if got < last {
+			t.Fatalf("CDF should be non-decreasing. CDF(%v) = %v after %v", x, got, last)
+		}
+		last = got
+	}
+
+	for _, x := range []float64{0.01, 0.1, 0.5, 0.9, 0.99} {
+		if got := tdigest.CDF(x); math.Abs(got-x) > 0.01 {
+			t.Errorf("CDF(%v) = %v, wanted about %v", x, got, x)
+		}
+	}
+
+	for _, q := range []float64{0.05, 0.25, 0.5, 0.75, 0.95} {
+		if got := tdigest.CDF(tdigest.Quantile(q)); math.Abs(got-q) > 0.001 {
+			t.Errorf("CDF(Quantile(%v)) = %v, wanted %v", q, got, q)
+		}
+	}
+
+	single := New(100)
+	single.Add(5, 3)
+	if single.CDF(4.9) != 0 || single.CDF(5) != 1 {
+		t.Errorf("Expected a step at the single centroid")
+	}
+}
+
+func TestTrimmedMean(t *testing.T) {
+	tdigest := New(100)
+	if !math.IsNaN(tdigest.TrimmedMean(0, 1)) {
+		t.Errorf("Expected NaN for an empty digest")
+	}
+
+	var sum float64
+	for _, i := range rand.Perm(10000) {
+		x := float64(i) / 10000
+		sum += x
+		tdigest.Add(x, 1)
+	}
+
+	if got, want := tdigest.TrimmedMean(0, 1), sum/10000; math.Abs(got-want) > 1e-9 {
+		t.Errorf("TrimmedMean(0, 1) = %v, wanted the mean %v", got, want)
+	}
+
+	// The mean of a uniform distribution between two quantiles is the
+	// midpoint between them.
+	for _, qs := range [][2]float64{{0.05, 0.95}, {0, 0.5}, {0.5, 1}, {0.9, 0.99}} {
+		want := (qs[0] + qs[1]) / 2
+		if got := tdigest.TrimmedMean(qs[0], qs[1]); math.Abs(got-want) > 0.01 {
+			t.Errorf("TrimmedMean(%v, %v) = %v, wanted about %v", qs[0], qs[1], got, want)
+		}
+	}
+
+	if got, want := tdigest.TrimmedMean(0.3, 0.3), tdigest.Quantile(0.3); got != want {
+		t.Errorf("TrimmedMean(0.3, 0.3) = %v, wanted Quantile(0.3) = %v", got, want)
+	}
+
+	// Cut points within a centroid only count part of its weight.
+	partial := New(100)
+	partial.Add(1, 10)
+	partial.Add(2, 10)
+	if got := partial.TrimmedMean(0.25, 1); math.Abs(got-5.0/3) > 1e-9 {
+		t.Errorf("TrimmedMean(0.25, 1) = %v, wanted 5/3", got)
+	}
+
+	shouldPanic(func() { tdigest.TrimmedMean(-0.1, 0.5) }, t, "Negative quantile should panic")
+	shouldPanic(func() { tdigest.TrimmedMean(0.6, 0.5) }, t, "Reversed quantiles should panic")
+}
+
+func TestQuantiles(t *testing.T) {
+	tdigest := New(100)
+	got, err := tdigest.Quantiles([]float64{0.5, 0.9})
+	if err != nil || len(got) != 2 || !math.IsNaN(got[0]) || !math.IsNaN(got[1]) {
+		t.Errorf("Expected NaNs for an empty digest, got %v (%v)", got, err)
+	}
+
+	for i := 0; i < 10000; i++ {
+		tdigest.Add(rand.NormFloat64(), 1)
+	}
+
+	qs := []float64{0.99, 0.5, 0, 0.9, 1, 0.5, 0.001, 0.95}
+	got, err = tdigest.Quantiles(qs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, q := range qs {
+		if want := tdigest.Quantile(q); got[i] != want {
+			t.Errorf("Quantiles()[%d] = %v, but Quantile(%v) = %v", i, got[i], q, want)
+		}
+	}
+
+	sample := New(100, WithQuantileConvention(Sample))
+	sample.Add(1, 1)
+	sample.Add(2, 1)
+	sample.Add(3, 1)
+	got, _ = sample.Quantiles([]float64{1, 0, 0.5})
+	for i, q := range []float64{1, 0, 0.5} {
+		if want := sample.Quantile(q); got[i] != want {
+			t.Errorf("Quantiles()[%d] = %v, but Quantile(%v) = %v", i, got[i], q, want)
+		}
+	}
+
+	if _, err := tdigest.Quantiles([]float64{0.5, 1.1}); err == nil {
+		t.Errorf("Expected an error for a quantile above 1")
+	}
+	if _, err := tdigest.Quantiles([]float64{math.NaN()}); err == nil {
+		t.Errorf("Expected an error for a NaN quantile")
+	}
+}
+
+func TestQuantileMany(t *testing.T) {
+	digests := make([]*TDigest, 50)
+	for i := range digests {
+		digests[i] = New(100)
+		for j := 0; j < i*20; j++ {
+			digests[i].Add(rand.ExpFloat64(), 1)
+		}
+	}
+	digests[10] = nil
+
+	for _, q := range []float64{0, 0.5, 0.99, 1} {
+		got, err := QuantileMany(digests, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, d := range digests {
+			if d == nil || d.Len() == 0 {
+				if !math.IsNaN(got[i]) {
+					t.Errorf("Expected NaN for digest %d, got %v", i, got[i])
+				}
+				continue
+			}
+			if want := d.Quantile(q); got[i] != want {
+				t.Errorf("QuantileMany(%v)[%d] = %v, but Quantile(%v) = %v", q, i, got[i], q, want)
+			}
+		}
+	}
+
+	if _, err := QuantileMany(digests, -0.5); err == nil {
+		t.Errorf("Expected an error for a negative quantile")
+	}
+}
+
+func TestQuantileOfUnion(t *testing.T) {
+	// Interleaved and disjoint ranges, of different sizes.
+	perm := rand.Perm(30000)
+	a, b, c := New(100), New(100), New(100)
+	merged := New(100)
+	for _, i := range perm {
+		x := float64(i)
+		switch {
+		case i%2 == 0 && i < 20000:
+			a.Add(x, 1)
+		case i < 20000:
+			b.Add(x, 1)
+		default:
+			c.Add(x, 1)
+		}
+		merged.Add(x, 1)
+	}
+
+	for _, q := range []float64{0, 0.01, 0.25, 0.5, 0.75, 0.99, 1} {
+		got, err := QuantileOfUnion(q, a, nil, b, New(100), c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := merged.Quantile(q); math.Abs(got-want) > 30 {
+			t.Errorf("QuantileOfUnion(%v) = %v, but the merged digest says %v", q, got, want)
+		}
+	}
+	if got, _ := QuantileOfUnion(0, a, b, c); got != 0 {
+		t.Errorf("Expected the minimum at q = 0, got %v", got)
+	}
+	if got, _ := QuantileOfUnion(1, a, b, c); got != 29999 {
+		t.Errorf("Expected the maximum at q = 1, got %v", got)
+	}
+
+	// A single digest answers about what its own Quantile does.
+	for _, q := range []float64{0.1, 0.5, 0.9} {
+		got, _ := QuantileOfUnion(q, c)
+		if want := c.Quantile(q); math.Abs(got-want) > 20 {
+			t.Errorf("QuantileOfUnion(%v) of a single digest = %v, but Quantile says %v", q, got, want)
+		}
+	}
+
+	if got, err := QuantileOfUnion(0.5, nil, New(100)); err != nil || !math.IsNaN(got) {
+		t.Errorf("Expected NaN without samples, got %v, %v", got, err)
+	}
+	if _, err := QuantileOfUnion(1.5, a); err == nil {
+		t.Errorf("Expected an error for a quantile above 1")
+	}
+}
+
+func TestValueAtRank(t *testing.T) {
+	d := New(100)
+	for _, i := range rand.Perm(10000) {
+		d.Add(float64(i), 1)
+	}
+	for _, rank := range []uint64{1, 2, 100, 5000, 9999, 10000} {
+		want := d.Quantile((float64(rank) - 0.5) / 10000)
+		if got := d.ValueAtRank(rank); math.Abs(got-want) > 1e-9 {
+			t.Errorf("ValueAtRank(%d) = %v, but Quantile says %v", rank, got, want)
+		}
+	}
+	if d.ValueAtRank(0) != d.ValueAtRank(1) || d.ValueAtRank(1e9) != d.ValueAtRank(10000) {
+		t.Errorf("Expected ranks out of range to be clamped")
+	}
+
+	// Next to a centroid of 2^62 samples, a float64 quantile can't tell the
+	// following ranks apart, but ranks can.
+	means := []float64{0, 1, 2, 3, 4, 5}
+	counts := []uint64{1 << 62, 1, 1, 1, 1, 1}
+	big, err := FromCentroids(means, counts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := uint64(1); k <= 5; k++ {
+		if got := big.ValueAtRank(1<<62 + k); got != float64(k) {
+			t.Errorf("ValueAtRank(2^62 + %d) = %v, wanted %d", k, got, k)
+		}
+	}
+
+	if !math.IsNaN(New(100).ValueAtRank(1)) {
+		t.Errorf("Expected NaN for an empty digest")
+	}
+	single := New(100)
+	single.Add(7, 3)
+	if single.ValueAtRank(2) != 7 {
+		t.Errorf("Expected the mean of a single centroid")
+	}
+}
+
+func BenchmarkQuantileMany(b *testing.B) {
+	digests := make([]*TDigest, 1000)
+	for i := range digests {
+		digests[i] = New(100)
+		for j := 0; j < 1000; j++ {
+			digests[i].Add(rand.Float64(), 1)
+		}
+	}
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		QuantileMany(digests, 0.99)
+	}
+}
+
+func TestHeadroomToThreshold(t *testing.T) {
+	tdigest := New(100)
+	for _, i := range rand.Perm(10000) {
+		tdigest.Add(float64(i)/10, 1)
+	}
+
+	h := tdigest.HeadroomToThreshold(750)
+	if h.Threshold != 750 || h.Quantile != tdigest.CDF(750) {
+		t.Errorf("Expected the quantile estimated by CDF, got %+v", h)
+	}
+	if math.Abs(h.Quantile-0.75) > 0.01 || math.Abs(h.Exceeding()-0.25) > 0.01 {
+		t.Errorf("Expected 750 to sit around p75, got %+v", h)
+	}
+
+	if got := (Headroom{Threshold: 750, Quantile: 0.993}).String(); got != "750 is currently p99.3" {
+		t.Errorf("Unexpected description %q", got)
+	}
+	if !math.IsNaN(New(100).HeadroomToThreshold(1).Quantile) {
+		t.Errorf("Expected NaN for an empty digest")
+	}
+}
+
+func TestQueryEdgeCases(t *testing.T) {
+	tiny := math.SmallestNonzeroFloat64
+	inf := math.Inf(1)
+	nan := math.NaN()
+
+	for _, test := range []struct {
+		name    string
+		samples []float64
+
+		// Expected Quantile(0), Quantile(0.5) and Quantile(1) and CDF(0).
+		quantiles [3]float64
+		cdf       float64
+	}{
+		{"empty", nil, [3]float64{nan, nan, nan}, nan},
+		{"single", []float64{5}, [3]float64{5, 5, 5}, 0},
+		{"single centroid", []float64{3, 3, 3}, [3]float64{3, 3, 3}, 0},
+		{"two", []float64{-1, 2}, [3]float64{-1, 2, 2}, 0.5},
+		{"denormals", []float64{-tiny, 0, tiny, 2 * tiny, 3 * tiny}, [3]float64{-tiny, tiny, 3 * tiny}, 0.2},
+		{"huge", []float64{-math.MaxFloat64, 0, math.MaxFloat64}, [3]float64{-math.MaxFloat64, 0, math.MaxFloat64}, 0.5},
+		{"infinities", []float64{-inf, -inf, 1, 2, 3, inf, inf}, [3]float64{-inf, 2, inf}, 2.0 / 7},
+		{"only infinities", []float64{inf, inf}, [3]float64{inf, inf, inf}, 0},
+	} {
+		d := New(100)
+		for _, x := range test.samples {
+			if err := d.Add(x, 1); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+		}
+
+		for i, q := range []float64{0, 0.5, 1} {
+			if got, want := d.Quantile(q), test.quantiles[i]; !sameFloat(got, want) {
+				t.Errorf("%s: expected Quantile(%v) = %v, got %v", test.name, q, want, got)
+			}
+		}
+		if got := d.CDF(0); !sameFloat(got, test.cdf) {
+			t.Errorf("%s: expected CDF(0) = %v, got %v", test.name, test.cdf, got)
+		}
+
+		// None of these may panic, and NaN arguments yield NaN.
+		if got := d.Quantile(nan); !math.IsNaN(got) {
+			t.Errorf("%s: expected Quantile(NaN) to be NaN, got %v", test.name, got)
+		}
+		if got := d.CDF(nan); !math.IsNaN(got) {
+			t.Errorf("%s: expected CDF(NaN) to be NaN, got %v", test.name, got)
+		}
+		d.TrimmedMean(0, 1)
+		d.TrimmedMean(0.5, 0.5)
+		if _, err := d.Quantiles([]float64{0, 1, 0.5}); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if _, err := d.Quantiles([]float64{nan}); err == nil {
+			t.Errorf("%s: expected Quantiles to reject NaN", test.name)
+		}
+		d.Compress()
+		if err := New(10).Merge(d); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+}
+
+func TestAddRejectsBadSamples(t *testing.T) {
+	d := New(100)
+	if err := d.Add(math.NaN(), 1); err == nil {
+		t.Errorf("Expected NaN to be rejected")
+	}
+	if err := d.Add(1, math.MaxUint64); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Add(2, 1); err == nil {
+		t.Errorf("Expected a count overflowing the digest to be rejected")
+	}
+	if d.count != math.MaxUint64 || d.Len() != 1 {
+		t.Errorf("Expected rejected samples to leave the digest alone, got %d samples in %d centroids", d.count, d.Len())
+	}
+
+	// Centroids that can't be merged any further mustn't make Compress
+	// recurse forever.
+	d = New(1)
+	for i := 0; i < 30; i++ {
+		d.Add(float64(i), 1<<58)
+	}
+	d.Compress()
+	if d.count != 30<<58 {
+		t.Errorf("Expected Compress to keep every sample, got %d", d.count)
+	}
+}
+
+// sameFloat compares floats, with NaN equal to itself.
+func sameFloat(a, b float64) bool {
+	return a == b || (math.IsNaN(a) && math.IsNaN(b))
+}
@@ -0,0 +1,196 @@
+//go:build !tdigest_lite
+
+// Package tdigestpb carries digests in protocol buffers, following the
+// schema of tdigest.proto, so that they can travel inside gRPC telemetry
+// messages as proper fields instead of opaque byte blobs.
+//
+// TDigest mirrors the message and encodes to the same wire format as code
+// generated from the schema, without depending on a protobuf runtime.
+// Services using generated code can import tdigest.proto in their own
+// schemas and exchange the bytes freely.
+package tdigestpb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/honeycombio/go-tdigest"
+)
+
+// TDigest is the tdigest.TDigest message.
+type TDigest struct {
+	Compression float64
+	Means       []float64
+	Counts      []uint64
+}
+
+// ToProto converts d into a message.
+func ToProto(d *tdigest.TDigest) *TDigest {
+	p := &TDigest{
+		Compression: d.Compression(),
+		Means:       make([]float64, 0, d.Len()),
+		Counts:      make([]uint64, 0, d.Len()),
+	}
+	d.ForEachCentroid(func(mean float64, count uint64) bool {
+		p.Means = append(p.Means, mean)
+		p.Counts = append(p.Counts, count)
+		return true
+	})
+	return p
+}
+
+// FromProto converts a message into a digest, created with the given
+// options. A zero compression stands for tdigest.DefaultCompression. See
+// tdigest.FromCentroids for how centroids are validated.
+func FromProto(p *TDigest, options ...tdigest.Option) (*tdigest.TDigest, error) {
+	if p.Compression != 0 {
+		options = append([]tdigest.Option{tdigest.Compression(p.Compression)}, options...)
+	}
+	return tdigest.FromCentroids(p.Means, p.Counts, options...)
+}
+
+// Protobuf field numbers and wire types of the message.
+const (
+	compressionField = 1
+	meansField       = 2
+	countsField      = 3
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Marshal encodes the message in the protobuf wire format, with packed
+// repeated fields as proto3 does.
+func (p *TDigest) Marshal() []byte {
+	var b []byte
+	if p.Compression != 0 {
+		b = binary.AppendUvarint(b, compressionField<<3|wireFixed64)
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p.Compression))
+	}
+	if len(p.Means) > 0 {
+		b = binary.AppendUvarint(b, meansField<<3|wireBytes)
+		b = binary.AppendUvarint(b, uint64(8*len(p.Means)))
+		for _, m := range p.Means {
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(m))
+		}
+	}
+	if len(p.Counts) > 0 {
+		var packed []byte
+		for _, c := range p.Counts {
+			packed = binary.AppendUvarint(packed, c)
+		}
+		b = binary.AppendUvarint(b, countsField<<3|wireBytes)
+		b = binary.AppendUvarint(b, uint64(len(packed)))
+		b = append(b, packed...)
+	}
+	return b
+}
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// Unmarshal decodes a message in the protobuf wire format, replacing the
+// contents of p. Repeated fields may be packed or not, and unknown fields
+// are skipped, as protobuf parsers do.
+func (p *TDigest) Unmarshal(b []byte) error {
+	*p = TDigest{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n < 1 {
+			return errTruncated
+		}
+		b = b[n:]
+		field, wire := key>>3, key&7
+
+		switch {
+		case field == compressionField && wire == wireFixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			p.Compression = math.Float64frombits(binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case field == meansField && wire == wireFixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			p.Means = append(p.Means, math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			b = b[8:]
+		case field == meansField && wire == wireBytes:
+			packed, rest, err := lengthDelimited(b)
+			if err != nil {
+				return err
+			}
+			if len(packed)%8 != 0 {
+				return fmt.Errorf("packed means take %d bytes, not a multiple of 8", len(packed))
+			}
+			for ; len(packed) > 0; packed = packed[8:] {
+				p.Means = append(p.Means, math.Float64frombits(binary.LittleEndian.Uint64(packed)))
+			}
+			b = rest
+		case field == countsField && wire == wireVarint:
+			c, n := binary.Uvarint(b)
+			if n < 1 {
+				return errTruncated
+			}
+			p.Counts = append(p.Counts, c)
+			b = b[n:]
+		case field == countsField && wire == wireBytes:
+			packed, rest, err := lengthDelimited(b)
+			if err != nil {
+				return err
+			}
+			for len(packed) > 0 {
+				c, n := binary.Uvarint(packed)
+				if n < 1 {
+					return errTruncated
+				}
+				p.Counts = append(p.Counts, c)
+				packed = packed[n:]
+			}
+			b = rest
+		default:
+			rest, err := skipField(b, wire)
+			if err != nil {
+				return fmt.Errorf("field %d: %v", field, err)
+			}
+			b = rest
+		}
+	}
+	return nil
+}
+
+func lengthDelimited(b []byte) (value, rest []byte, err error) {
+	size, n := binary.Uvarint(b)
+	if n < 1 || size > uint64(len(b)-n) {
+		return nil, nil, errTruncated
+	}
+	return b[n : n+int(size)], b[n+int(size):], nil
+}
+
+func skipField(b []byte, wire uint64) ([]byte, error) {
+	switch wire {
+	case wireVarint:
+		_, n := binary.Uvarint(b)
+		if n < 1 {
+			return nil, errTruncated
+		}
+		return b[n:], nil
+	case wireFixed64:
+		if len(b) < 8 {
+			return nil, errTruncated
+		}
+		return b[8:], nil
+	case wireBytes:
+		_, rest, err := lengthDelimited(b)
+		return rest, err
+	case wireFixed32:
+		if len(b) < 4 {
+			return nil, errTruncated
+		}
+		return b[4:], nil
+	}
+	return nil, fmt.Errorf("unsupported wire type %d", wire)
+}
@@ -0,0 +1,84 @@
+//go:build !tdigest_lite
+
+package tdigestpb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/honeycombio/go-tdigest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	d := tdigest.New(50)
+	for i := 0; i < 1000; i++ {
+		d.Add(float64(i%97)*1.5, 1)
+	}
+
+	var p TDigest
+	if err := p.Unmarshal(ToProto(d).Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	got, err := FromProto(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Compression() != 50 || !bytes.Equal(got.ToBytes(nil), d.ToBytes(nil)) {
+		t.Errorf("Expected the digest to survive a round trip")
+	}
+	for _, q := range []float64{0, 0.5, 0.99} {
+		if got.Quantile(q) != d.Quantile(q) {
+			t.Errorf("Quantile(%v) = %v, wanted %v", q, got.Quantile(q), d.Quantile(q))
+		}
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	p := &TDigest{Compression: 100, Means: []float64{1, 2}, Counts: []uint64{1, 300}}
+
+	// As protoc generated code encodes it
+	want := []byte{
+		0x09, 0, 0, 0, 0, 0, 0, 0x59, 0x40, // compression = 100
+		0x12, 16, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0, 0, 0, 0, 0, 0, 0, 0x40, // packed means
+		0x1a, 3, 1, 0xac, 0x02, // packed counts
+	}
+	if got := p.Marshal(); !bytes.Equal(got, want) {
+		t.Errorf("Unexpected encoding:\n%x\n%x", got, want)
+	}
+
+	// Unpacked repeated fields and unknown fields are accepted too.
+	unpacked := []byte{
+		0x11, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // means = 1
+		0x18, 1, // counts = 1
+		0x20, 7, // unknown varint field 4
+		0x2a, 2, 'h', 'i', // unknown bytes field 5
+		0x11, 0, 0, 0, 0, 0, 0, 0, 0x40, // means = 2
+		0x18, 0xac, 0x02, // counts = 300
+	}
+	var got TDigest
+	if err := got.Unmarshal(unpacked); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, TDigest{Means: []float64{1, 2}, Counts: []uint64{1, 300}}) {
+		t.Errorf("Unexpected message %+v", got)
+	}
+
+	if err := got.Unmarshal(want[:len(want)-1]); err == nil {
+		t.Errorf("Expected a truncated message to fail")
+	}
+}
+
+func TestFromProto(t *testing.T) {
+	d, err := FromProto(&TDigest{Means: []float64{1}, Counts: []uint64{2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Compression() != tdigest.DefaultCompression {
+		t.Errorf("Expected the default compression, got %v", d.Compression())
+	}
+
+	if _, err := FromProto(&TDigest{Means: []float64{1, 2}, Counts: []uint64{2}}); err == nil {
+		t.Errorf("Expected mismatched centroids to be rejected")
+	}
+}
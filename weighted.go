@@ -0,0 +1,70 @@
+package tdigest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// WithWeightScale makes AddWeighted multiply weights by scale before
+// rounding them to counts, so that the counts of the digest are in units
+// of 1/scale. Quantiles and CDFs only depend on relative weights, so they
+// are unaffected, but rounding is much finer: with weights far below 1, as
+// in importance sampling, a scale of 1<<20 or so keeps the rounding noise
+// negligible. Add takes counts in the scaled units.
+func WithWeightScale(scale float64) Option {
+	return func(t *TDigest) error {
+		if !(scale > 0) || math.IsInf(scale, 1) {
+			return errors.New("weight scale must be positive and finite")
+		}
+		t.weightScale = scale
+		return nil
+	}
+}
+
+// AddWeighted registers a sample with a fractional weight, for data that
+// is importance-sampled, decayed or otherwise weighted. Since centroids
+// hold integer counts, the weight (scaled, see WithWeightScale) is rounded
+// stochastically: up with a probability equal to its fractional part, and
+// down otherwise. The expected count added is therefore exactly the
+// weight, and the digest stays unbiased over many samples. Weights must
+// be finite and non-negative, and samples whose weight rounds to 0 are
+// dropped.
+func (t *TDigest) AddWeighted(value, weight float64) error {
+	w := weight
+	if t.weightScale != 0 {
+		w *= t.weightScale
+	}
+	return t.addScaled(value, w, weight)
+}
+
+// addScaled is AddWeighted for a weight w already scaled to counts, for
+// callers that need the count before adding it. The unscaled weight is
+// only used in errors.
+func (t *TDigest) addScaled(value, w, weight float64) error {
+	if !(w >= 0) || w >= math.MaxUint64 {
+		return fmt.Errorf("Illegal datapoint <value: %.4f, weight: %v>", value, weight)
+	}
+
+	count := roundStochastically(w)
+	if count == 0 {
+		if math.IsNaN(value) {
+			return fmt.Errorf("Illegal datapoint <value: %.4f, weight: %v>", value, weight)
+		}
+		return nil
+	}
+	return t.Add(value, count)
+}
+
+// roundStochastically rounds w, which must be non-negative and below
+// 2^64, up with a probability equal to its fractional part, and down
+// otherwise.
+func roundStochastically(w float64) uint64 {
+	whole, frac := math.Modf(w)
+	n := uint64(whole)
+	if frac > 0 && rand.Float64() < frac {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,69 @@
+package tdigest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAddWeighted(t *testing.T) {
+	tdigest := New(100)
+	for i := 0; i < 100000; i++ {
+		if err := tdigest.AddWeighted(rand.Float64(), 0.25); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Counts follow a binomial distribution of mean 25000 and standard
+	// deviation about 137.
+	if math.Abs(float64(tdigest.count)-25000) > 1000 {
+		t.Errorf("Expected about 25000 samples, got %d", tdigest.count)
+	}
+	assertDifferenceSmallerThan(tdigest, 0.5, 0.02, t)
+
+	tdigest = New(100)
+	tdigest.AddWeighted(1, 3)
+	if tdigest.count != 3 {
+		t.Errorf("Expected whole weights to be added as is, got count %d", tdigest.count)
+	}
+	if err := tdigest.AddWeighted(2, 0); err != nil || tdigest.count != 3 {
+		t.Errorf("Expected a zero weight to add nothing, got %v and count %d", err, tdigest.count)
+	}
+
+	for _, tc := range []struct{ value, weight float64 }{
+		{1, -1},
+		{1, math.NaN()},
+		{1, math.Inf(1)},
+		{1, 1e20},
+		{math.NaN(), 0},
+		{math.NaN(), 1},
+	} {
+		if err := tdigest.AddWeighted(tc.value, tc.weight); err == nil {
+			t.Errorf("Expected %v with weight %v to be rejected", tc.value, tc.weight)
+		}
+	}
+}
+
+func TestWeightScale(t *testing.T) {
+	tdigest := New(100, WithWeightScale(1<<20))
+
+	// Weights spanning orders of magnitude, all below 1.
+	for i := 0; i < 1000; i++ {
+		tdigest.AddWeighted(float64(i), 0.001)
+		tdigest.AddWeighted(float64(i+1000), 0.003)
+	}
+
+	// Three quarters of the weight is above 1000.
+	if got := tdigest.Quantile(0.25); math.Abs(got-1000) > 20 {
+		t.Errorf("Expected p25 to be about 1000, got %v", got)
+	}
+	if got, want := float64(tdigest.count)/(1<<20), 4.0; math.Abs(got-want) > 0.001 {
+		t.Errorf("Expected a total weight of %v, got %v", want, got)
+	}
+
+	for _, scale := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		if _, err := newWithOptions(100, []Option{WithWeightScale(scale)}); err == nil {
+			t.Errorf("Expected a weight scale of %v to be rejected", scale)
+		}
+	}
+}
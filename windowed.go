@@ -0,0 +1,464 @@
+package tdigest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// WindowedTDigest answers queries over the samples of a recent period of
+// time, say "p99 over the last 5 minutes". Samples go to the bucket of the
+// time they're added at, out of a ring of buckets spanning the window;
+// queries merge the buckets still within the window, so that older samples
+// expire on their own, a bucket at a time. MergeRange and QuantileSince
+// query shorter periods, for dashboards showing several. Like TDigest, it
+// is not safe for concurrent use.
+//
+// Bucket boundaries fall on multiples of the bucket width since the Unix
+// epoch, which are whole minutes, hours or days of UTC for widths dividing
+// them, so that the buckets match those of query backends. SetAlignment
+// moves them, and SetGracePeriod keeps buckets open for samples reported
+// late with AddAt. SetLatePolicy rules what happens to samples later still,
+// and Completeness and Final tell whether a bucket may still change.
+// OnWindowSealed hands out every bucket once it can't anymore.
+type WindowedTDigest struct {
+	compression float64
+	options     []Option
+	width       int64 // of every bucket, in nanoseconds
+	offset      int64 // of the bucket boundaries, in nanoseconds
+	grace       time.Duration
+	latePolicy  LatePolicy
+	late        LateCounts
+	buckets     []windowBucket
+
+	// The watermark is the latest time samples happened at so far, and
+	// lateness holds how far behind it samples were, in nanoseconds.
+	watermark time.Time
+	lateness  *TDigest
+
+	onSealed func(start time.Time, d *TDigest)
+}
+
+// LatePolicy rules what a WindowedTDigest does with the samples added with
+// AddAt after their bucket closed.
+type LatePolicy int
+
+const (
+	// LateDrop drops late samples. It is the default.
+	LateDrop LatePolicy = iota
+
+	// LateMergeIntoCurrent adds late samples to the current bucket, which
+	// keeps them in the window at the cost of skewing the bucket they
+	// land in.
+	LateMergeIntoCurrent
+
+	// LateMergeIntoBucket adds late samples to the bucket they happened
+	// in, even though it's sealed, as long as it's within the window. It
+	// drops them otherwise.
+	LateMergeIntoBucket
+)
+
+// LateCounts counts the late samples of a WindowedTDigest by the outcome
+// of its LatePolicy.
+type LateCounts struct {
+	// Dropped counts the samples that were dropped.
+	Dropped uint64
+
+	// Current counts the samples added to the current bucket.
+	Current uint64
+
+	// Bucket counts the samples added to the bucket they happened in.
+	Bucket uint64
+}
+
+type windowBucket struct {
+	// epoch numbers the bucket since the Unix epoch, in bucket widths.
+	epoch int64
+	t     *TDigest
+
+	// sealed is set once the bucket was passed to the OnWindowSealed hook.
+	sealed bool
+}
+
+// NewWindowed creates a WindowedTDigest over the given window, split into
+// the given number of buckets. Queries cover between window minus one
+// bucket and the whole window, so more buckets make the window sharper at
+// the cost of merging more digests. The compression and options are those
+// of New, and apply to every bucket as well as to the merged digests. To
+// keep k buckets of a given width, pass a window of k times the width.
+func NewWindowed(window time.Duration, buckets int, compression float64, options ...Option) (*WindowedTDigest, error) {
+	if buckets < 1 {
+		return nil, errors.New("a window needs at least one bucket")
+	}
+	if window < time.Duration(buckets) {
+		return nil, errors.New("window must be at least a nanosecond per bucket")
+	}
+	if _, err := newWithOptions(compression, options); err != nil {
+		return nil, err
+	}
+	return &WindowedTDigest{
+		compression: compression,
+		options:     options,
+		width:       int64(window) / int64(buckets),
+		buckets:     make([]windowBucket, buckets),
+		lateness:    New(DefaultCompression),
+	}, nil
+}
+
+// SetAlignment moves the bucket boundaries offset past the multiples of
+// the bucket width since the Unix epoch. With hour buckets, an offset of
+// 30 minutes aligns them to the hours of UTC+5:30, say. It clears the
+// buckets, so it's meant to be called right after NewWindowed.
+func (w *WindowedTDigest) SetAlignment(offset time.Duration) {
+	w.offset = (int64(offset)%w.width + w.width) % w.width
+	for i := range w.buckets {
+		w.buckets[i] = windowBucket{}
+	}
+}
+
+// SetGracePeriod keeps every bucket open for samples added with AddAt for
+// grace after it ends, so that samples reported a little late still count
+// towards the bucket they happened in. Buckets past the window are closed
+// regardless. Open buckets aren't sealed, see QuantileAt. It panics if
+// grace is negative.
+func (w *WindowedTDigest) SetGracePeriod(grace time.Duration) {
+	if grace < 0 {
+		panic("grace period must not be negative")
+	}
+	w.grace = grace
+}
+
+// SetLatePolicy sets what AddAt does with samples whose bucket closed. It
+// panics on an unknown policy.
+func (w *WindowedTDigest) SetLatePolicy(policy LatePolicy) {
+	if policy != LateDrop && policy != LateMergeIntoCurrent && policy != LateMergeIntoBucket {
+		panic("unknown late policy")
+	}
+	w.latePolicy = policy
+}
+
+// LateCounts returns the number of late samples of each outcome so far.
+func (w *WindowedTDigest) LateCounts() LateCounts {
+	return w.late
+}
+
+// epoch returns the number of the bucket holding time ts.
+func (w *WindowedTDigest) epoch(ts time.Time) int64 {
+	n := ts.UnixNano() - w.offset
+	e := n / w.width
+	if n%w.width < 0 {
+		e--
+	}
+	return e
+}
+
+// start returns the start of the bucket of epoch e, in nanoseconds since
+// the Unix epoch.
+func (w *WindowedTDigest) start(e int64) int64 {
+	return e*w.width + w.offset
+}
+
+// open reports whether the bucket of epoch e, which must not be after the
+// current one, still receives samples as of now.
+func (w *WindowedTDigest) open(e int64, now time.Time) bool {
+	current := w.epoch(now)
+	if e <= current-int64(len(w.buckets)) {
+		return false
+	}
+	return e == current || now.UnixNano() < w.start(e+1)+int64(w.grace)
+}
+
+// bucket returns the digest of the bucket holding time ts, clearing the
+// slot if it holds an older bucket.
+func (w *WindowedTDigest) bucket(ts time.Time) *TDigest {
+	e := w.epoch(ts)
+	n := int64(len(w.buckets))
+	b := &w.buckets[(e%n+n)%n]
+	if b.t == nil || b.epoch != e {
+		*b = windowBucket{epoch: e, t: New(w.compression, w.options...)}
+	}
+	return b.t
+}
+
+// OnWindowSealed sets a hook called with the start and a copy of the
+// digest of every bucket holding samples once it's final, see Final, so
+// that buckets can be shipped or persisted exactly once. Buckets are
+// passed oldest first, and whatever the hook does with the digest won't
+// affect the WindowedTDigest. The hook is called from Add, AddAt, Backfill
+// and the queries, when they first notice a bucket became final, so a
+// WindowedTDigest receiving no samples needs to be queried now and then.
+// A nil hook removes it.
+func (w *WindowedTDigest) OnWindowSealed(hook func(start time.Time, d *TDigest)) {
+	w.onSealed = hook
+}
+
+// seal passes the buckets that became final as of now to the
+// OnWindowSealed hook, if any.
+func (w *WindowedTDigest) seal(now time.Time) {
+	if w.onSealed == nil {
+		return
+	}
+	var final []*windowBucket
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if b.t != nil && !b.sealed && b.t.count > 0 && w.finalAt(now, time.Unix(0, w.start(b.epoch))) {
+			final = append(final, b)
+		}
+	}
+	sort.Slice(final, func(i, j int) bool { return final[i].epoch < final[j].epoch })
+	for _, b := range final {
+		b.sealed = true
+		d := New(w.compression, w.options...)
+		if err := d.Merge(b.t); err != nil {
+			panic(err)
+		}
+		w.onSealed(time.Unix(0, w.start(b.epoch)), d)
+	}
+}
+
+// Add registers a new sample at the current time, see TDigest.Add.
+func (w *WindowedTDigest) Add(value float64, count uint64) error {
+	return w.addAt(time.Now(), value, count)
+}
+
+func (w *WindowedTDigest) addAt(ts time.Time, value float64, count uint64) error {
+	return w.addEventAt(ts, ts, value, count)
+}
+
+// AddAt registers count samples of value that happened at time ts, for
+// samples reported after the fact. They go to the bucket of ts if it's
+// still open, see SetGracePeriod, and are late otherwise, see
+// SetLatePolicy. Samples from the future, as clocks drift, go to the
+// current bucket.
+func (w *WindowedTDigest) AddAt(ts time.Time, value float64, count uint64) error {
+	return w.addEventAt(time.Now(), ts, value, count)
+}
+
+func (w *WindowedTDigest) addEventAt(now, ts time.Time, value float64, count uint64) error {
+	if count == 0 || math.IsNaN(value) {
+		return fmt.Errorf("Illegal datapoint <value: %.4f, count: %d>", value, count)
+	}
+	w.seal(now)
+	if ts.After(now) {
+		ts = now
+	}
+	if err := w.observe(ts, count); err != nil {
+		return err
+	}
+	if e := w.epoch(ts); !w.open(e, now) {
+		switch {
+		case w.latePolicy == LateMergeIntoCurrent:
+			w.late.Current += count
+			ts = now
+		case w.latePolicy == LateMergeIntoBucket && e > w.epoch(now)-int64(len(w.buckets)):
+			w.late.Bucket += count
+		default:
+			w.late.Dropped += count
+			return nil
+		}
+	}
+	return w.bucket(ts).Add(value, count)
+}
+
+// observe records count samples that happened at time ts, advancing the
+// watermark or recording how late they are.
+func (w *WindowedTDigest) observe(ts time.Time, count uint64) error {
+	var lateness float64
+	if ts.Before(w.watermark) {
+		lateness = float64(w.watermark.Sub(ts))
+	} else {
+		w.watermark = ts
+	}
+	return w.lateness.Add(lateness, count)
+}
+
+// Watermark returns the latest time samples happened at so far, or the
+// zero time if none was added. Samples added with AddAt for earlier times
+// are late, by how far behind the watermark they are.
+func (w *WindowedTDigest) Watermark() time.Time {
+	return w.watermark
+}
+
+// Final reports whether the bucket holding time ts can no longer change,
+// because it closed and the late policy doesn't add to closed buckets, or
+// because it's past the window.
+func (w *WindowedTDigest) Final(ts time.Time) bool {
+	return w.finalAt(time.Now(), ts)
+}
+
+func (w *WindowedTDigest) finalAt(now, ts time.Time) bool {
+	e := w.epoch(ts)
+	if e > w.epoch(now) || w.open(e, now) {
+		return false
+	}
+	return w.latePolicy != LateMergeIntoBucket || e <= w.epoch(now)-int64(len(w.buckets))
+}
+
+// completenessSteps is the number of times within a bucket Completeness
+// averages the arrival probability of the samples over.
+const completenessSteps = 16
+
+// Completeness estimates the fraction of the samples that happened within
+// the bucket holding time ts that were added so far, so that consumers can
+// tell whether its quantiles are still subject to late samples. It
+// assumes samples arrive as late as those so far: a sample that happened
+// at time x counts as added with the probability that a sample is at most
+// as late as the watermark is ahead of x. It is 1 for final buckets, and 0
+// before any sample was added.
+func (w *WindowedTDigest) Completeness(ts time.Time) float64 {
+	return w.completenessAt(time.Now(), ts)
+}
+
+func (w *WindowedTDigest) completenessAt(now, ts time.Time) float64 {
+	if w.finalAt(now, ts) {
+		return 1
+	}
+	if w.lateness.count == 0 {
+		return 0
+	}
+	start, watermark := w.start(w.epoch(ts)), w.watermark.UnixNano()
+	var sum float64
+	for i := 0; i < completenessSteps; i++ {
+		x := start + int64((float64(i)+0.5)*float64(w.width)/completenessSteps)
+		if x <= watermark {
+			sum += w.lateness.CDF(float64(watermark - x))
+		}
+	}
+	return sum / completenessSteps
+}
+
+// Digest returns a new digest merging the buckets within the window that
+// ends now, which the caller may then use freely.
+func (w *WindowedTDigest) Digest() *TDigest {
+	return w.digestAt(time.Now())
+}
+
+func (w *WindowedTDigest) digestAt(now time.Time) *TDigest {
+	w.seal(now)
+	d := New(w.compression, w.options...)
+	last := w.epoch(now)
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if b.t == nil || b.epoch > last || b.epoch <= last-int64(len(w.buckets)) {
+			continue
+		}
+		if err := d.Merge(b.t); err != nil {
+			// Buckets share the options of d, so they're always compatible.
+			panic(err)
+		}
+	}
+	return d
+}
+
+// MergeRange returns a new digest merging the buckets of the times between
+// from and to, inclusive, out of those within the window that ends now,
+// which the caller may then use freely. Buckets are included whole, so the
+// range is rounded outwards to bucket boundaries.
+func (w *WindowedTDigest) MergeRange(from, to time.Time) *TDigest {
+	return w.mergeRangeAt(time.Now(), from, to)
+}
+
+func (w *WindowedTDigest) mergeRangeAt(now, from, to time.Time) *TDigest {
+	w.seal(now)
+	d := New(w.compression, w.options...)
+	first := max(w.epoch(from), w.epoch(now)-int64(len(w.buckets))+1)
+	last := w.epoch(to)
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if b.t == nil || b.epoch < first || b.epoch > last {
+			continue
+		}
+		if err := d.Merge(b.t); err != nil {
+			panic(err)
+		}
+	}
+	return d
+}
+
+// QuantileSince returns the estimated value at quantile q of the samples
+// added over the last d, which is rounded up to whole buckets and limited
+// to the buckets within the window. See TDigest.Quantile.
+func (w *WindowedTDigest) QuantileSince(d time.Duration, q float64) float64 {
+	return w.quantileSinceAt(time.Now(), d, q)
+}
+
+func (w *WindowedTDigest) quantileSinceAt(now time.Time, d time.Duration, q float64) float64 {
+	return w.mergeRangeAt(now, now.Add(-d), now).Quantile(q)
+}
+
+// QuantileAt returns the estimated value at quantile q at time ts, for
+// smooth dashboard lines and point-in-time queries. The value at quantile
+// q of every sealed bucket, one within the window that no longer receives
+// samples (see SetGracePeriod), is taken to be that of the middle of its period, and values
+// are interpolated linearly between those of the sealed buckets closest
+// to ts on either side, skipping empty ones. Before the middle of the
+// oldest sealed bucket and after that of the newest, their own values are
+// used. It returns NaN when ts isn't within a sealed bucket, or between
+// two.
+func (w *WindowedTDigest) QuantileAt(ts time.Time, q float64) float64 {
+	return w.quantileAt(time.Now(), ts, q)
+}
+
+func (w *WindowedTDigest) quantileAt(now, ts time.Time, q float64) float64 {
+	if q < 0 || q > 1 {
+		panic("q must be between 0 and 1 (inclusive)")
+	}
+	w.seal(now)
+	current := w.epoch(now)
+	var sealed []*windowBucket
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		expired := b.epoch <= current-int64(len(w.buckets))
+		if b.t != nil && b.epoch <= current && !expired && !w.open(b.epoch, now) && b.t.count > 0 {
+			sealed = append(sealed, b)
+		}
+	}
+	if len(sealed) == 0 {
+		return math.NaN()
+	}
+	sort.Slice(sealed, func(i, j int) bool { return sealed[i].epoch < sealed[j].epoch })
+
+	first, last := sealed[0], sealed[len(sealed)-1]
+	e := w.epoch(ts)
+	if e < first.epoch || e > last.epoch {
+		return math.NaN()
+	}
+
+	// Times are in nanoseconds since the start of the first bucket, which
+	// float64 holds exactly, unlike nanoseconds since the Unix epoch.
+	middle := func(b *windowBucket) float64 {
+		return float64(b.epoch-first.epoch)*float64(w.width) + float64(w.width)/2
+	}
+	x := float64(e-first.epoch)*float64(w.width) + float64(ts.UnixNano()-w.start(e))
+	i := sort.Search(len(sealed), func(i int) bool { return middle(sealed[i]) >= x })
+	switch {
+	case i == 0:
+		return first.t.Quantile(q)
+	case i == len(sealed):
+		return last.t.Quantile(q)
+	}
+	before, after := sealed[i-1], sealed[i]
+	lo, hi := before.t.Quantile(q), after.t.Quantile(q)
+	frac := (x - middle(before)) / (middle(after) - middle(before))
+	return lo + frac*(hi-lo)
+}
+
+// Quantile returns the estimated value at quantile q of the samples within
+// the window, see TDigest.Quantile.
+func (w *WindowedTDigest) Quantile(q float64) float64 {
+	return w.Digest().Quantile(q)
+}
+
+// Quantiles returns the estimated values at each of qs of the samples
+// within the window, see TDigest.Quantiles.
+func (w *WindowedTDigest) Quantiles(qs []float64) ([]float64, error) {
+	return w.Digest().Quantiles(qs)
+}
+
+// CDF returns the estimated fraction of the samples within the window at
+// or below x, see TDigest.CDF.
+func (w *WindowedTDigest) CDF(x float64) float64 {
+	return w.Digest().CDF(x)
+}
@@ -0,0 +1,30 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import "time"
+
+// Backfill loads the digests stored under key in s for the times within
+// the window that ends now, merging each into the bucket of the time it
+// was stored at, so that a process picks up where it left off on restart
+// instead of taking a whole window to warm up. Digests are expected to be
+// stored a bucket at a time, at times within their bucket; older ones are
+// left out, as are those stored for a time after now.
+func (w *WindowedTDigest) Backfill(s Store, key string) error {
+	return w.backfillAt(time.Now(), s, key)
+}
+
+func (w *WindowedTDigest) backfillAt(now time.Time, s Store, key string) error {
+	w.seal(now)
+	from := time.Unix(0, w.start(w.epoch(now)-int64(len(w.buckets))+1))
+	stored, err := s.List(key, from, now.Add(1))
+	if err != nil {
+		return err
+	}
+	for _, sd := range stored {
+		if err := w.bucket(sd.Time).Merge(sd.Digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build !tdigest_lite
+
+package tdigest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowedBackfill(t *testing.T) {
+	store := NewMemoryStore()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for m := 0; m < 10; m++ {
+		d := New(100)
+		for i := 0; i < 100; i++ {
+			d.Add(float64(m), 1)
+		}
+		if err := store.Put("latency", start.Add(time.Duration(m)*time.Minute), d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Put("other", start.Add(8*time.Minute), New(100))
+
+	w, err := NewWindowed(5*time.Minute, 5, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Restarting at 00:08:30, minutes 4 to 8 are within the window, and
+	// the digest of minute 9 isn't due yet.
+	now := start.Add(8*time.Minute + 30*time.Second)
+	if err := w.backfillAt(now, store, "latency"); err != nil {
+		t.Fatal(err)
+	}
+	w.addAt(now, 8, 10)
+
+	d := w.digestAt(now)
+	if d.count != 510 || d.Quantile(0) != 4 || d.Quantile(1) != 8 {
+		t.Errorf("Expected minutes 4 to 8, got %d samples from %v to %v", d.count, d.Quantile(0), d.Quantile(1))
+	}
+	if got := w.quantileAt(now, start.Add(5*time.Minute+30*time.Second), 0.5); got != 5 {
+		t.Errorf("Expected backfilled buckets to be sealed, got %v at minute 5", got)
+	}
+}
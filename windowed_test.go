@@ -0,0 +1,380 @@
+package tdigest
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWindowedTDigest(t *testing.T) {
+	w, err := NewWindowed(5*time.Minute, 5, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for m := 0; m < 10; m++ {
+		ts := start.Add(time.Duration(m) * time.Minute)
+		for i := 0; i < 100; i++ {
+			w.addAt(ts.Add(time.Duration(i)*time.Second/2), float64(m), 1)
+		}
+	}
+
+	// At 00:09:30, the window holds minutes 5 to 9.
+	d := w.digestAt(start.Add(9*time.Minute + 30*time.Second))
+	if d.count != 500 {
+		t.Errorf("Expected 500 samples in the window, got %d", d.count)
+	}
+	if lo, hi := d.Quantile(0), d.Quantile(1); lo != 5 || hi != 9 {
+		t.Errorf("Expected the window to span minutes 5 to 9, got %v to %v", lo, hi)
+	}
+
+	// Ranges cover whole buckets.
+	now := start.Add(9*time.Minute + 30*time.Second)
+	d = w.mergeRangeAt(now, start.Add(6*time.Minute+10*time.Second), start.Add(7*time.Minute))
+	if d.count != 200 || d.Quantile(0) != 6 || d.Quantile(1) != 7 {
+		t.Errorf("Expected minutes 6 and 7, got %d samples from %v to %v", d.count, d.Quantile(0), d.Quantile(1))
+	}
+	if d := w.mergeRangeAt(now, start, start.Add(4*time.Minute)); d.count != 0 {
+		t.Errorf("Expected overwritten buckets to be gone, got %d samples", d.count)
+	}
+
+	// A minute later, minute 5 expired.
+	d = w.digestAt(start.Add(10*time.Minute + 30*time.Second))
+	if d.count != 400 || d.Quantile(0) != 6 {
+		t.Errorf("Expected minute 5 to expire, got %d samples from %v", d.count, d.Quantile(0))
+	}
+
+	// Long after, every bucket expired.
+	if d := w.digestAt(start.Add(time.Hour)); d.count != 0 {
+		t.Errorf("Expected every bucket to expire, got %d samples", d.count)
+	}
+
+	// Adding to a slot of an expired bucket starts it over.
+	w.addAt(start.Add(time.Hour), 42, 1)
+	if d := w.digestAt(start.Add(time.Hour)); d.count != 1 || d.Quantile(0.5) != 42 {
+		t.Errorf("Expected a single sample of 42, got %d samples", d.count)
+	}
+
+	// Times before the epoch fall in buckets too.
+	w.addAt(time.Unix(0, -1), 1, 1)
+	if d := w.digestAt(time.Unix(0, -1)); d.count != 1 {
+		t.Errorf("Expected the sample before the epoch to be found, got %d samples", d.count)
+	}
+}
+
+func TestWindowedTDigestNow(t *testing.T) {
+	w, err := NewWindowed(time.Minute, 6, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Add(1, 1)
+	w.Add(2, 1)
+	if q := w.Quantile(1); q != 2 {
+		t.Errorf("Expected a maximum of 2, got %v", q)
+	}
+	if c := w.CDF(1); c != 0.5 {
+		t.Errorf("Expected a CDF of 0.5 at 1, got %v", c)
+	}
+	if q := w.QuantileSince(time.Second, 0); q != 1 {
+		t.Errorf("Expected a minimum of 1 over the last second, got %v", q)
+	}
+}
+
+func TestWindowedMergeRangeExpiry(t *testing.T) {
+	w, err := NewWindowed(5*time.Minute, 5, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for m := 0; m < 3; m++ {
+		for i := 0; i < 10; i++ {
+			w.addAt(start.Add(time.Duration(m)*time.Minute+time.Duration(i)*time.Second), float64(m), 1)
+		}
+	}
+
+	// At 00:06:30, minutes 0 and 1 expired, though they are still in the
+	// ring.
+	now := start.Add(6*time.Minute + 30*time.Second)
+	if d := w.mergeRangeAt(now, start, now); d.count != 10 || d.Quantile(0) != 2 {
+		t.Errorf("Expected only minute 2, got %d samples from %v", d.count, d.Quantile(0))
+	}
+	if q := w.quantileSinceAt(now, time.Hour, 0); q != 2 {
+		t.Errorf("Expected a minimum of 2 over the last hour, got %v", q)
+	}
+
+	// Long after, every bucket expired.
+	if d := w.mergeRangeAt(start.Add(time.Hour), start, start.Add(time.Hour)); d.count != 0 {
+		t.Errorf("Expected every bucket to expire, got %d samples", d.count)
+	}
+}
+
+func TestWindowedAlignment(t *testing.T) {
+	w, err := NewWindowed(5*time.Hour, 5, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetAlignment(30 * time.Minute)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, m := range []int{20, 29, 31, 40} {
+		w.addAt(start.Add(time.Duration(m)*time.Minute), float64(m), 1)
+	}
+	now := start.Add(40 * time.Minute)
+	if d := w.mergeRangeAt(now, start, start); d.count != 2 || d.Quantile(1) != 29 {
+		t.Errorf("Expected the bucket up to 00:30 to hold 20 and 29, got %d samples up to %v", d.count, d.Quantile(1))
+	}
+	if d := w.mergeRangeAt(now, now, now); d.count != 2 || d.Quantile(0) != 31 {
+		t.Errorf("Expected the bucket from 00:30 to hold 31 and 40, got %d samples from %v", d.count, d.Quantile(0))
+	}
+}
+
+func TestWindowedGracePeriod(t *testing.T) {
+	w, err := NewWindowed(5*time.Minute, 5, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetGracePeriod(10 * time.Second)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	minute := start.Add(30 * time.Second)
+	w.addAt(minute, 1, 1)
+
+	// At 00:01:05, minute 0 is still open.
+	now := start.Add(time.Minute + 5*time.Second)
+	if err := w.addEventAt(now, minute, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.quantileAt(now, minute, 0.5); !math.IsNaN(got) {
+		t.Errorf("Expected minute 0 not to be sealed during its grace period, got %v", got)
+	}
+
+	// At 00:01:15, it's closed.
+	now = start.Add(time.Minute + 15*time.Second)
+	if err := w.addEventAt(now, minute, 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	if d := w.mergeRangeAt(now, start, start); d.count != 2 || d.Quantile(1) != 2 {
+		t.Errorf("Expected the late sample within the grace period only, got %d samples up to %v", d.count, d.Quantile(1))
+	}
+	if got := w.quantileAt(now, minute, 1); got != 2 {
+		t.Errorf("Expected minute 0 to be sealed, got %v", got)
+	}
+
+	// Samples from the future go to the current bucket.
+	w.addEventAt(now, now.Add(time.Hour), 4, 1)
+	if d := w.mergeRangeAt(now, now, now); d.count != 1 || d.Quantile(0) != 4 {
+		t.Errorf("Expected the sample from the future in the current bucket, got %d samples", d.count)
+	}
+
+	if w.AddAt(time.Now(), math.NaN(), 1) == nil {
+		t.Errorf("Expected NaN to be rejected")
+	}
+}
+
+func TestWindowedLatePolicy(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(2*time.Minute + 30*time.Second)
+
+	for _, c := range []struct {
+		policy        LatePolicy
+		minute0, last uint64
+		counts        LateCounts
+	}{
+		{LateDrop, 1, 1, LateCounts{Dropped: 4}},
+		{LateMergeIntoCurrent, 1, 5, LateCounts{Current: 4}},
+		{LateMergeIntoBucket, 3, 1, LateCounts{Bucket: 2, Dropped: 2}},
+	} {
+		w, err := NewWindowed(3*time.Minute, 3, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.SetLatePolicy(c.policy)
+		w.addAt(start, 0, 1)
+		w.addAt(now, 2, 1)
+
+		// Minute 0 is sealed but within the window, the previous hour
+		// isn't.
+		w.addEventAt(now, start.Add(10*time.Second), 0, 2)
+		w.addEventAt(now, start.Add(-time.Hour), -1, 2)
+
+		if d := w.mergeRangeAt(now, start, start); d.count != c.minute0 {
+			t.Errorf("Policy %d: expected %d samples in minute 0, got %d", c.policy, c.minute0, d.count)
+		}
+		if d := w.mergeRangeAt(now, now, now); d.count != c.last {
+			t.Errorf("Policy %d: expected %d samples in the current bucket, got %d", c.policy, c.last, d.count)
+		}
+		if got := w.LateCounts(); got != c.counts {
+			t.Errorf("Policy %d: expected late counts %+v, got %+v", c.policy, c.counts, got)
+		}
+	}
+}
+
+func TestWindowedCompleteness(t *testing.T) {
+	w, err := NewWindowed(5*time.Minute, 5, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetGracePeriod(time.Minute)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if c := w.completenessAt(start, start); c != 0 {
+		t.Errorf("Expected a completeness of 0 without samples, got %v", c)
+	}
+
+	// Every second for 3 minutes, a sample happens, and half of the
+	// samples arrive 30 seconds late.
+	var now time.Time
+	for s := 0; s < 180; s++ {
+		now = start.Add(time.Duration(s) * time.Second)
+		w.addEventAt(now, now, 0, 1)
+		if s >= 30 {
+			w.addEventAt(now, now.Add(-30*time.Second), 0, 1)
+		}
+	}
+	if !w.Watermark().Equal(now) {
+		t.Errorf("Expected the watermark at %v, got %v", now, w.Watermark())
+	}
+
+	// At 00:02:59, minute 0 is final, minute 1 is in its grace period but
+	// has all its samples, and minute 2 misses the late samples of its
+	// last 30 seconds and is still open.
+	for _, c := range []struct {
+		minute int
+		final  bool
+		lo, hi float64
+	}{
+		{0, true, 1, 1},
+		{1, false, 0.99, 1},
+		{2, false, 0.7, 0.8},
+		{3, false, 0, 0},
+	} {
+		ts := start.Add(time.Duration(c.minute) * time.Minute)
+		if f := w.finalAt(now, ts); f != c.final {
+			t.Errorf("Minute %d: expected final to be %v", c.minute, c.final)
+		}
+		if got := w.completenessAt(now, ts); got < c.lo || got > c.hi {
+			t.Errorf("Minute %d: expected a completeness between %v and %v, got %v", c.minute, c.lo, c.hi, got)
+		}
+	}
+
+	// Buckets merged into with late samples are only final once past the
+	// window.
+	w.SetLatePolicy(LateMergeIntoBucket)
+	if w.finalAt(now, start) || !w.finalAt(start.Add(time.Hour), start) {
+		t.Errorf("Expected minute 0 to be final only once past the window")
+	}
+}
+
+func TestWindowedOnWindowSealed(t *testing.T) {
+	for _, policy := range []LatePolicy{LateDrop, LateMergeIntoBucket} {
+		w, err := NewWindowed(3*time.Minute, 3, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.SetLatePolicy(policy)
+		w.SetGracePeriod(10 * time.Second)
+		type sealed struct {
+			start time.Time
+			count uint64
+		}
+		var got []sealed
+		w.OnWindowSealed(func(start time.Time, d *TDigest) {
+			got = append(got, sealed{start.UTC(), d.count})
+		})
+
+		// Minutes 0, 1 and 3 hold samples, then nothing happens for an
+		// hour but a query now and then.
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for _, m := range []int{0, 1, 3} {
+			for i := 0; i <= m; i++ {
+				w.addAt(start.Add(time.Duration(m)*time.Minute+time.Duration(i)*time.Second), 1, 1)
+			}
+		}
+		for s := 0; s < 3600; s += 5 {
+			w.digestAt(start.Add(time.Duration(s) * time.Second))
+		}
+
+		want := []sealed{
+			{start, 1},
+			{start.Add(time.Minute), 2},
+			{start.Add(3 * time.Minute), 4},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Policy %d: expected sealed buckets %v, got %v", policy, want, got)
+		}
+	}
+}
+
+func TestNewWindowed(t *testing.T) {
+	for _, tc := range []struct {
+		window      time.Duration
+		buckets     int
+		compression float64
+	}{
+		{time.Minute, 0, 100},
+		{3, 5, 100},
+		{time.Minute, 5, 0},
+	} {
+		if _, err := NewWindowed(tc.window, tc.buckets, tc.compression); err == nil {
+			t.Errorf("Expected %+v to be rejected", tc)
+		}
+	}
+}
+
+func TestWindowedQuantileAt(t *testing.T) {
+	w, err := NewWindowed(5*time.Minute, 5, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Minutes 0, 1 and 3 hold samples of their number, minute 2 is empty
+	// and minute 4 is still open.
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, m := range []int{0, 1, 3, 4} {
+		for i := 0; i < 10; i++ {
+			w.addAt(start.Add(time.Duration(m)*time.Minute+time.Duration(i)*time.Second), float64(m), 1)
+		}
+	}
+	now := start.Add(4*time.Minute + 30*time.Second)
+
+	for _, c := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{10 * time.Second, 0},
+		{30 * time.Second, 0},
+		{time.Minute, 0.5},
+		{90 * time.Second, 1},
+		{2 * time.Minute, 1.5},
+		{150 * time.Second, 2},
+		{210 * time.Second, 3},
+		{235 * time.Second, 3},
+	} {
+		if got := w.quantileAt(now, start.Add(c.at), 0.5); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("At %v: expected %v, got %v", c.at, c.want, got)
+		}
+	}
+
+	for _, at := range []time.Duration{-time.Second, 4 * time.Minute, 10 * time.Minute} {
+		if got := w.quantileAt(now, start.Add(at), 0.5); !math.IsNaN(got) {
+			t.Errorf("At %v: expected NaN outside of the sealed buckets, got %v", at, got)
+		}
+	}
+
+	// At 00:07:30, minutes 0 to 2 expired, though minutes 0 and 1 are
+	// still in the ring.
+	later := start.Add(7*time.Minute + 30*time.Second)
+	if got := w.quantileAt(later, start.Add(30*time.Second), 0.5); !math.IsNaN(got) {
+		t.Errorf("Expected NaN for expired buckets, got %v", got)
+	}
+	if got := w.quantileAt(later, start.Add(3*time.Minute), 0.5); got != 3 {
+		t.Errorf("Expected minute 3 to be the oldest sealed bucket, got %v", got)
+	}
+
+	empty, _ := NewWindowed(time.Minute, 2, 100)
+	if got := empty.QuantileAt(time.Now(), 0.5); !math.IsNaN(got) {
+		t.Errorf("Expected NaN without sealed buckets, got %v", got)
+	}
+}